@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/cache"
+	"github.com/spf13/cobra"
+)
+
+var Cache = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the persistent translation cache",
+	Long:  "The translate command stores every translation in a persistent cache keyed by content, languages, prompt and model, so re-running it after a crash does not pay for the same content twice. These commands inspect and maintain that cache.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var cacheStats = &cobra.Command{
+	Use:     "stats",
+	Short:   "Show the number and size of cached translations",
+	Example: "epubtrans cache stats",
+	Args:    cobra.NoArgs,
+	RunE:    runCacheStats,
+}
+
+var cachePrune = &cobra.Command{
+	Use:     "prune",
+	Short:   "Remove old cached translations",
+	Example: "epubtrans cache prune --older-than 720h --model anthropic/claude-3-5-sonnet-20241022",
+	Args:    cobra.NoArgs,
+	RunE:    runCachePrune,
+}
+
+var cacheExport = &cobra.Command{
+	Use:     "export",
+	Short:   "Export cached translations as JSON lines",
+	Example: "epubtrans cache export -o translations.jsonl",
+	Args:    cobra.NoArgs,
+	RunE:    runCacheExport,
+}
+
+func init() {
+	Cache.PersistentFlags().String("cache-dir", "", "translation cache directory (default is the user cache directory)")
+
+	cachePrune.Flags().Duration("older-than", 30*24*time.Hour, "remove entries older than this duration")
+	cachePrune.Flags().String("model", "", "only remove entries produced by this provider/model")
+
+	cacheExport.Flags().StringP("output", "o", "", "output file path (default is stdout)")
+
+	Cache.AddCommand(cacheStats)
+	Cache.AddCommand(cachePrune)
+	Cache.AddCommand(cacheExport)
+}
+
+// openCacheStore opens the cache in dir, or in the default location when dir is empty.
+func openCacheStore(dir string) (*cache.Store, error) {
+	if dir == "" {
+		defaultDir, err := cache.DefaultDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = defaultDir
+	}
+
+	store, err := cache.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open translation cache: %w", err)
+	}
+
+	return store, nil
+}
+
+func runCacheStats(cmd *cobra.Command, args []string) error {
+	store, err := openCacheStore(cmd.Flag("cache-dir").Value.String())
+	if err != nil {
+		return err
+	}
+
+	stats, err := store.Stats()
+	if err != nil {
+		return fmt.Errorf("failed to read cache: %w", err)
+	}
+
+	cmd.Printf("Cache directory: %s\n", store.Dir())
+	cmd.Printf("Entries: %d\n", stats.Entries)
+	cmd.Printf("Size: %.2f MB\n", float64(stats.Bytes)/(1024*1024))
+	if stats.Entries == 0 {
+		return nil
+	}
+
+	cmd.Printf("Oldest entry: %s\n", stats.Oldest.Format(time.RFC3339))
+	cmd.Printf("Newest entry: %s\n", stats.Newest.Format(time.RFC3339))
+
+	models := make([]string, 0, len(stats.Models))
+	for model := range stats.Models {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	cmd.Println("Entries by model:")
+	for _, model := range models {
+		cmd.Printf("  %s: %d\n", model, stats.Models[model])
+	}
+
+	return nil
+}
+
+func runCachePrune(cmd *cobra.Command, args []string) error {
+	store, err := openCacheStore(cmd.Flag("cache-dir").Value.String())
+	if err != nil {
+		return err
+	}
+
+	olderThan, err := cmd.Flags().GetDuration("older-than")
+	if err != nil {
+		return fmt.Errorf("invalid older-than flag: %w", err)
+	}
+	model, _ := cmd.Flags().GetString("model")
+
+	removed, err := store.Prune(time.Now().Add(-olderThan), model)
+	if err != nil {
+		return fmt.Errorf("failed to prune cache: %w", err)
+	}
+
+	cmd.Printf("Removed %d cached translations\n", removed)
+	return nil
+}
+
+func runCacheExport(cmd *cobra.Command, args []string) error {
+	store, err := openCacheStore(cmd.Flag("cache-dir").Value.String())
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if outputPath, _ := cmd.Flags().GetString("output"); outputPath != "" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	exported, err := store.Export(out)
+	if err != nil {
+		return fmt.Errorf("failed to export cache: %w", err)
+	}
+
+	cmd.PrintErrf("Exported %d cached translations\n", exported)
+	return nil
+}
@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// defaultContextTokens is the default size of the read-only context sent
+// with each batch
+const defaultContextTokens = 400
+
+// contextPair is an element translated before a batch, with its translation.
+type contextPair struct {
+	source string
+	target string
+}
+
+// batchContext returns the read-only context of batch for the system prompt:
+// the heading of its chapter and the translated elements just before it, up to
+// contextTokens. When its own file has too few, the last translated elements
+// of the previous file fill the rest.
+func (p *translationPipeline) batchContext(filePath string, batch translationBatch) string {
+	if p.contextTokens <= 0 || len(batch.elements) == 0 {
+		return ""
+	}
+	first := batch.elements[0]
+
+	// Other batches of the file write their translations into the same document
+	fileLock := getFileLock(filePath)
+	fileLock.Lock()
+	heading := chapterHeading(first.doc, first.contentEl)
+	own := translatedPairs(first.doc, first.contentEl)
+	fileLock.Unlock()
+
+	pairs, remaining := fitPairs(own, p.contextTokens-translator.EstimateTokens(heading))
+
+	if previous := p.previousFile(filePath); previous != "" && remaining > 0 && len(pairs) == len(own) {
+		earlier, _ := fitPairs(p.filePairs(previous), remaining)
+		pairs = append(earlier, pairs...)
+	}
+
+	if heading == "" && len(pairs) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("PRECEDING CONTEXT:\nThe text just before the segments, for consistent names, pronouns, terminology and tone. It is read-only: do not translate it and do not include it in your response.\n")
+	if heading != "" {
+		fmt.Fprintf(&b, "\nChapter: %s\n", heading)
+	}
+	for _, pair := range pairs {
+		fmt.Fprintf(&b, "\nSource: %s\nTranslation: %s\n", pair.source, pair.target)
+	}
+	return b.String()
+}
+
+// previousFile returns the content file translated before filePath, or an
+// empty string for the first one.
+func (p *translationPipeline) previousFile(filePath string) string {
+	i := slices.Index(p.files, filePath)
+	if i <= 0 {
+		return ""
+	}
+	return p.files[i-1]
+}
+
+// filePairs returns the translated elements of the file at filePath.
+func (p *translationPipeline) filePairs(filePath string) []contextPair {
+	fileLock := getFileLock(filePath)
+	fileLock.Lock()
+	defer fileLock.Unlock()
+
+	doc, err := util.OpenAndReadFile(filePath)
+	if err != nil {
+		fmt.Printf("Warning: no context from %s: %v\n", path.Base(filePath), err)
+		return nil
+	}
+	return translatedPairs(doc, nil)
+}
+
+// fitPairs keeps the last pairs that fit in tokens and returns the tokens left.
+func fitPairs(pairs []contextPair, tokens float32) ([]contextPair, float32) {
+	start := len(pairs)
+	for start > 0 {
+		size := translator.EstimateTokens(pairs[start-1].source) + translator.EstimateTokens(pairs[start-1].target)
+		if size > tokens {
+			break
+		}
+		tokens -= size
+		start--
+	}
+	return pairs[start:], tokens
+}
+
+// headingSelector matches the headings of a document
+const headingSelector = "h1, h2, h3, h4, h5, h6"
+
+// chapterHeading returns the text of the last heading before el in doc, or the
+// title of doc when there is none.
+func chapterHeading(doc *goquery.Document, el *goquery.Selection) string {
+	heading := ""
+	doc.Find(headingSelector + ", [" + util.ContentIdKey + "]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if s.IsSelection(el) {
+			return false
+		}
+		// Translated copies are not the chapter's own headings
+		if s.Is(headingSelector) && s.AttrOr(util.TranslationIdKey, "") == "" {
+			heading = strings.TrimSpace(s.Text())
+		}
+		return true
+	})
+
+	if heading == "" {
+		heading = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+	return strings.Join(strings.Fields(heading), " ")
+}
+
+// translatedPairs returns the translated elements of doc that come before el,
+// or all of them when el is nil, in document order.
+func translatedPairs(doc *goquery.Document, el *goquery.Selection) []contextPair {
+	var pairs []contextPair
+	doc.Find("[" + util.ContentIdKey + "]").EachWithBreak(func(i int, s *goquery.Selection) bool {
+		if el != nil && s.IsSelection(el) {
+			return false
+		}
+
+		translationID := s.AttrOr(util.TranslationByIdKey, "")
+		if translationID == "" {
+			return true
+		}
+		source, err := s.Html()
+		if err != nil {
+			return true
+		}
+		target, err := doc.Find(fmt.Sprintf("[%s=%q]", util.TranslationIdKey, translationID)).First().Html()
+		if err != nil || strings.TrimSpace(target) == "" {
+			return true
+		}
+
+		pairs = append(pairs, contextPair{source: strings.TrimSpace(source), target: strings.TrimSpace(target)})
+		return true
+	})
+	return pairs
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/budget"
+	"github.com/nguyenvanduocit/epubtrans/pkg/cache"
+	"github.com/nguyenvanduocit/epubtrans/pkg/processor"
+	"github.com/nguyenvanduocit/epubtrans/pkg/ratelimit"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+func TestBatchContext(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--cache-dir", t.TempDir())
+
+	files, _, err := processor.ContentFiles(unpackedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chapter2 := files[1]
+	doc, err := util.OpenAndReadFile(chapter2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	marked := doc.Find("[" + util.ContentIdKey + "]")
+	batchAt := func(i int) translationBatch {
+		return translationBatch{elements: []elementToTranslate{{doc: doc, contentEl: marked.Eq(i)}}}
+	}
+
+	outside := "Outside, even through the shut window, the world looked cold."
+	nobody := "Nobody noticed &amp; nobody cared."
+
+	tests := []struct {
+		name     string
+		tokens   float32
+		batch    translationBatch
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:   "preceding pairs of the file and the previous file",
+			tokens: 1000,
+			batch:  batchAt(2),
+			want: []string{
+				"Chapter: The second chapter\n",
+				"\nSource: " + nobody + "\nTranslation: " + translator.PseudoLocalize(nobody) + "\n",
+				"\nSource: " + outside + "\nTranslation: " + translator.PseudoLocalize(outside) + "\n",
+			},
+			unwanted: []string{"Down in the street"},
+		},
+		{
+			name:     "only the last pairs that fit",
+			tokens:   translator.EstimateTokens("The second chapter") + translator.EstimateTokens(outside) + translator.EstimateTokens(translator.PseudoLocalize(outside)),
+			batch:    batchAt(2),
+			want:     []string{"Source: " + outside},
+			unwanted: []string{"Source: The second chapter", nobody},
+		},
+		{
+			name:     "first element of a file",
+			tokens:   1000,
+			batch:    batchAt(0),
+			want:     []string{"Chapter: Chapter Two\n", "Source: " + nobody},
+			unwanted: []string{outside},
+		},
+		{
+			name:     "disabled",
+			tokens:   0,
+			batch:    batchAt(2),
+			unwanted: []string{"PRECEDING CONTEXT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &translationPipeline{contextTokens: tt.tokens, files: files}
+			got := p.batchContext(chapter2, tt.batch)
+
+			for _, want := range tt.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("context does not contain %q:\n%s", want, got)
+				}
+			}
+			for _, unwanted := range tt.unwanted {
+				if strings.Contains(got, unwanted) {
+					t.Errorf("context contains %q:\n%s", unwanted, got)
+				}
+			}
+			if strings.Index(got, nobody) > strings.Index(got, outside) && strings.Contains(got, outside) {
+				t.Errorf("previous file comes after the preceding pairs:\n%s", got)
+			}
+		})
+	}
+}
+
+func TestBatchContextKeepsCacheHits(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--cache-dir", t.TempDir())
+
+	files, _, err := processor.ContentFiles(unpackedPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chapter2 := files[1]
+	doc, err := util.OpenAndReadFile(chapter2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	el := doc.Find("[" + util.ContentIdKey + "]").Eq(2)
+	content, err := el.Html()
+	if err != nil {
+		t.Fatal(err)
+	}
+	batch := translationBatch{elements: []elementToTranslate{{contentID: "c", content: content, doc: doc, contentEl: el}}}
+
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.Open() error = %v", err)
+	}
+	mock, _ := translator.NewMock(nil)
+	p := newTranslationPipeline(translator.NewCached(mock, store, "mock"), ratelimit.New(0, 0), "Book", "technical", 1)
+	p.files = files
+	prompt, err := batchPrompt(p.protocol, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A re-run sees different preceding context, here a smaller window
+	var contexts []string
+	for _, tokens := range []float32{1000, 20} {
+		p.contextTokens = tokens
+		contexts = append(contexts, p.batchContext(chapter2, batch))
+		if _, err := p.translateBatch(p.withBatchNotes(context.Background(), chapter2, batch), chapter2, batch, prompt, &budget.Spend{}); err != nil {
+			t.Fatalf("translateBatch() error = %v", err)
+		}
+	}
+
+	if contexts[0] == contexts[1] {
+		t.Fatalf("both runs had the same context:\n%s", contexts[0])
+	}
+	if mock.Calls() != 1 {
+		t.Errorf("made %d calls, want the second run to hit the cache", mock.Calls())
+	}
+}
@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/glossary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/processor"
+	"github.com/nguyenvanduocit/epubtrans/pkg/summary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// estimatedOutputTokensPerSecond is a typical generation speed of hosted
+// models, used to bound the run time when no rate limit applies.
+const estimatedOutputTokensPerSecond = 50
+
+// defaultOutputRatio is the expected output tokens per source token of the
+// translated content, shared by estimate and the budget reserved by translate
+const defaultOutputRatio = 1.2
+
+var Estimate = &cobra.Command{
+	Use:   "estimate [unpackedEpubPath]",
+	Short: "Estimate the tokens, time and cost of translating an unpacked EPUB file",
+	Long: `This command walks the same untranslated elements and batches as translate, without translating anything.
+It counts tokens with the provider's tokenizer, or with an offline heuristic when --offline is set,
+and prints the projected input and output tokens, requests, cost and time per chapter and in total.
+Each request counts the system prompt, the batch in the protocol translate would use, the glossary entries
+and chapter summaries sent with it, and the full --context-tokens of preceding context. Translation memory
+examples and the retries and repairs of failed segments are not counted.`,
+	Example: `epubtrans estimate path/to/unpacked/epub --provider anthropic
+epubtrans estimate path/to/unpacked/epub --provider openai --model gpt-4o-mini --offline`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("unpackedEpubPath is required. Please provide the path to the unpacked EPUB directory.")
+		}
+
+		return util.ValidateEpubPath(args[0])
+	},
+	RunE: runEstimate,
+}
+
+func init() {
+	Estimate.Flags().String("source", "English", "source language")
+	Estimate.Flags().String("target", "Vietnamese", "target language")
+	Estimate.Flags().String("provider", "anthropic", fmt.Sprintf("translation provider to use %v", translator.Providers()))
+	Estimate.Flags().String("model", "", "model to use, defaults to the provider's recommended model")
+	Estimate.Flags().String("base-url", "", "API base URL for OpenAI-compatible or local (ollama, llamacpp) servers")
+	Estimate.Flags().String("prompt", "technical", "Prompt preset to use")
+	Estimate.Flags().String("protocol", protocolAuto, "batch protocol translate would use: json, tags or auto")
+	Estimate.Flags().Int("context-tokens", defaultContextTokens, "tokens of read-only context translate would send with each batch")
+	Estimate.Flags().Bool("offline", false, "count tokens with a local heuristic instead of the provider's tokenizer")
+	Estimate.Flags().Float64("output-ratio", defaultOutputRatio, "expected output tokens per source token of the translated content")
+	Estimate.Flags().Int("concurrency", 1, "number of batches translated in parallel")
+	Estimate.Flags().Int("rpm", 50, "maximum requests per minute, 0 for no limit")
+	Estimate.Flags().Int("tpm", 0, "maximum tokens per minute, 0 for no limit")
+}
+
+// offlineCounter counts tokens without calling a provider.
+type offlineCounter struct{}
+
+func (offlineCounter) CountTokens(ctx context.Context, content string) (float32, error) {
+	return translator.EstimateTokens(content), nil
+}
+
+type chapterEstimate struct {
+	file         string
+	segments     int
+	requests     int
+	inputTokens  float64
+	outputTokens float64
+	cost         float64
+}
+
+func runEstimate(cmd *cobra.Command, args []string) error {
+	unzipPath := args[0]
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	bookName, err := extractBookName(unzipPath)
+	if err != nil {
+		return fmt.Errorf("error extracting book name: %v", err)
+	}
+
+	provider, _ := cmd.Flags().GetString("provider")
+	model, _ := cmd.Flags().GetString("model")
+	source, _ := cmd.Flags().GetString("source")
+	target, _ := cmd.Flags().GetString("target")
+	promptPreset, _ := cmd.Flags().GetString("prompt")
+	offline, _ := cmd.Flags().GetBool("offline")
+	outputRatio, _ := cmd.Flags().GetFloat64("output-ratio")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	requestsPerMinute, _ := cmd.Flags().GetInt("rpm")
+	tokensPerMinute, _ := cmd.Flags().GetInt("tpm")
+	if concurrency <= 0 {
+		return fmt.Errorf("concurrency must be greater than 0")
+	}
+
+	// Count the guidelines translate would send, without generating new ones
+	guidelines := ""
+	if content, err := os.ReadFile(path.Join(unzipPath, "META-INF", "guidelines.txt")); err == nil {
+		guidelines = string(content)
+	}
+
+	translatorConfig := &translator.Config{
+		BaseURL:               cmd.Flag("base-url").Value.String(),
+		Model:                 model,
+		TranslationGuidelines: guidelines,
+	}
+	var counter tokenCounter = offlineCounter{}
+	t, err := translator.New(provider, translatorConfig)
+	switch {
+	case err == nil && !offline:
+		counter = t
+	case err != nil && !offline:
+		return fmt.Errorf("error getting translator: %v (use --offline to estimate without the provider)", err)
+	case err != nil:
+		fmt.Fprintf(cmd.ErrOrStderr(), "Warning: %v, cost is priced by --model only\n", err)
+	}
+	model = translatorConfig.Model
+
+	protocol, err := resolveProtocol(cmd.Flag("protocol").Value.String(), t)
+	if err != nil {
+		return err
+	}
+	contextTokens, _ := cmd.Flags().GetInt("context-tokens")
+
+	countTokens := func(content string) (float64, error) {
+		count, err := counter.CountTokens(ctx, content)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count tokens: %w (use --offline to estimate without the provider)", err)
+		}
+		return float64(count), nil
+	}
+
+	systemTokens, err := countTokens(translator.TranslationSystem(source, target, guidelines, bookName, promptPreset))
+	if err != nil {
+		return err
+	}
+
+	files, _, err := processor.ContentFiles(unzipPath)
+	if err != nil {
+		return err
+	}
+
+	// The notes translate adds to each batch, except the preceding context,
+	// which is counted at its cap because it comes from translations not made yet
+	bookGlossary, err := glossary.Load(unzipPath)
+	if err != nil {
+		return err
+	}
+	summaries, err := summary.Load(unzipPath)
+	if err != nil {
+		return err
+	}
+	notes := &translationPipeline{
+		unzipPath: unzipPath,
+		glossary:  bookGlossary,
+		summaries: summaries,
+		order:     bookRelativePaths(unzipPath, files),
+	}
+
+	b := newBatcher(counter)
+	b.quiet = true
+
+	var chapters []chapterEstimate
+	var total chapterEstimate
+	for _, filePath := range files {
+		doc, err := util.OpenAndReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to open and read file: %w", err)
+		}
+
+		chapter := chapterEstimate{file: filePath}
+		if rel, err := filepath.Rel(unzipPath, filePath); err == nil {
+			chapter.file = filepath.ToSlash(rel)
+		}
+
+		for _, batch := range b.batches(ctx, filePath, doc, doc.Find(untranslatedSelector)) {
+			prompt, err := batchPrompt(protocol, batch)
+			if err != nil {
+				return err
+			}
+			promptTokens, err := countTokens(prompt)
+			if err != nil {
+				return err
+			}
+
+			var noteTokens float64
+			batchNotes := slices.DeleteFunc(notes.batchNotes(filePath, batch), func(note string) bool { return note == "" })
+			if len(batchNotes) > 0 {
+				if noteTokens, err = countTokens(strings.Join(batchNotes, "\n\n")); err != nil {
+					return err
+				}
+			}
+
+			contentTokens, err := countTokens(batchText(batch))
+			if err != nil {
+				return err
+			}
+
+			chapter.segments += len(batch.elements)
+			chapter.requests++
+			chapter.inputTokens += systemTokens + promptTokens + noteTokens + float64(contextTokens)
+			chapter.outputTokens += contentTokens * outputRatio
+		}
+
+		usage := translator.Usage{InputTokens: int(chapter.inputTokens), OutputTokens: int(chapter.outputTokens)}
+		chapter.cost = usage.Cost(model)
+
+		total.segments += chapter.segments
+		total.requests += chapter.requests
+		total.inputTokens += chapter.inputTokens
+		total.outputTokens += chapter.outputTokens
+		total.cost += chapter.cost
+		chapters = append(chapters, chapter)
+	}
+
+	out := cmd.OutOrStdout()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAPTER\tSEGMENTS\tREQUESTS\tINPUT TOKENS\tOUTPUT TOKENS\tCOST")
+	for _, chapter := range chapters {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.0f\t%.0f\t$%.4f\n", chapter.file, chapter.segments, chapter.requests, chapter.inputTokens, chapter.outputTokens, chapter.cost)
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%.0f\t%.0f\t$%.4f\n", total.segments, total.requests, total.inputTokens, total.outputTokens, total.cost)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out)
+	if price, ok := translator.PriceFor(model); ok {
+		fmt.Fprintf(out, "Model: %s/%s ($%.2f input, $%.2f output per million tokens)\n", provider, model, price.InputPerMillion, price.OutputPerMillion)
+	} else {
+		fmt.Fprintf(out, "Model: %s/%s (no known price, cost shown as $0)\n", provider, model)
+	}
+	duration := estimateDuration(total.requests, total.inputTokens+total.outputTokens, total.outputTokens, requestsPerMinute, tokensPerMinute, concurrency)
+	fmt.Fprintf(out, "Estimated time: %s at %d rpm, %d tpm and concurrency %d\n", duration.Round(time.Second), requestsPerMinute, tokensPerMinute, concurrency)
+	fmt.Fprintf(out, "Counted: the %s batch protocol, glossary and summary notes, and up to %d context tokens per request. Not counted: translation memory examples and retries of failed segments.\n", protocol, contextTokens)
+
+	return nil
+}
+
+// estimateDuration returns the longest of the time the rate limits allow for
+// the run and the time spent generating output with concurrent requests.
+func estimateDuration(requests int, tokens, outputTokens float64, requestsPerMinute, tokensPerMinute, concurrency int) time.Duration {
+	var minutes float64
+	if requestsPerMinute > 0 {
+		minutes = max(minutes, float64(requests)/float64(requestsPerMinute))
+	}
+	if tokensPerMinute > 0 {
+		minutes = max(minutes, tokens/float64(tokensPerMinute))
+	}
+	generating := outputTokens / estimatedOutputTokensPerSecond / float64(concurrency) / 60
+	minutes = max(minutes, generating)
+
+	return time.Duration(minutes * float64(time.Minute))
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// estimateTotal runs estimate with args and returns its output and the
+// fields of its total row: TOTAL, segments, requests, input tokens, output
+// tokens and cost.
+func estimateTotal(t *testing.T, args ...string) (string, []string) {
+	t.Helper()
+
+	var out bytes.Buffer
+	Root.SetOut(&out)
+	t.Cleanup(func() { Root.SetOut(nil) })
+
+	runCommand(t, append([]string{"estimate"}, args...)...)
+
+	var total []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "TOTAL") {
+			total = strings.Fields(line)
+		}
+	}
+	if len(total) != 6 {
+		t.Fatalf("unexpected total row %q in:\n%s", total, out.String())
+	}
+	return out.String(), total
+}
+
+func TestEstimateOffline(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	out, total := estimateTotal(t, unpackedPath, "--provider", "mock", "--offline")
+	if total[1] != "7" || total[2] != "2" {
+		t.Fatalf("unexpected total row %q in:\n%s", total, out)
+	}
+	if !strings.Contains(out, "Model: mock/mock (no known price") {
+		t.Errorf("estimate output does not name the model:\n%s", out)
+	}
+	if !strings.Contains(out, "Counted: the json batch protocol") {
+		t.Errorf("estimate output does not name the protocol translate would use:\n%s", out)
+	}
+}
+
+func TestEstimateCountsBatchNotes(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	inputTokens := func(args ...string) int {
+		t.Helper()
+		_, total := estimateTotal(t, append([]string{unpackedPath, "--provider", "mock", "--offline"}, args...)...)
+		tokens, err := strconv.Atoi(total[3])
+		if err != nil {
+			t.Fatalf("input tokens %q: %v", total[3], err)
+		}
+		return tokens
+	}
+
+	without := inputTokens("--context-tokens", "0")
+	if got := inputTokens("--context-tokens", "100"); got != without+2*100 {
+		t.Errorf("input tokens with context = %d, want %d plus the context of 2 requests", got, without)
+	}
+
+	glossaryPath := filepath.Join(unpackedPath, "META-INF", "glossary.csv")
+	if err := os.WriteFile(glossaryPath, []byte("source,target,pos,notes,do_not_translate\nApril,,noun,,true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := inputTokens("--context-tokens", "0"); got <= without {
+		t.Errorf("input tokens with a glossary = %d, want more than %d", got, without)
+	}
+}
+
+func TestEstimateDuration(t *testing.T) {
+	tests := []struct {
+		name        string
+		requests    int
+		rpm, tpm    int
+		concurrency int
+		want        time.Duration
+	}{
+		{name: "request limit", requests: 100, rpm: 50, concurrency: 1, want: 2 * time.Minute},
+		{name: "token limit", requests: 1, tpm: 1000, concurrency: 1, want: 10 * time.Minute},
+		{name: "generation", requests: 1, concurrency: 2, want: 30 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := estimateDuration(tt.requests, 10000, 3000, tt.rpm, tt.tpm, tt.concurrency)
+			if got.Round(time.Second) != tt.want {
+				t.Errorf("estimateDuration() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/segment"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+	"github.com/nguyenvanduocit/epubtrans/pkg/xliff"
+	"github.com/spf13/cobra"
+)
+
+var Export = &cobra.Command{
+	Use:   "export",
+	Short: "Export the segments of an unpacked EPUB for translation tools",
+	Long:  "Every marked element of the book is exported as a segment keyed by its content ID, together with its translation when it has one.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var exportXliff = &cobra.Command{
+	Use:   "xliff [unpackedEpubPath]",
+	Short: "Export the segments as XLIFF 2.0 for CAT tools",
+	Long: `This command writes the marked elements of the book as XLIFF 2.0 units, one file per spine document, or a single
+file for the whole book with --per-book. Inline HTML becomes pc and ph codes, and existing translations become targets
+with their review state.`,
+	Example: `epubtrans export xliff path/to/unpacked/epub --target "Vietnamese"
+epubtrans export xliff path/to/unpacked/epub --per-book -o book.xlf`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("unpackedEpubPath is required. Please provide the path to the unpacked EPUB directory.")
+		}
+
+		return util.ValidateEpubPath(args[0])
+	},
+	RunE: runExportXliff,
+}
+
+// segmentFormat is a file format segments can be exported to and imported from.
+type segmentFormat struct {
+	name      string
+	extension string
+	short     string
+	languages bool // whether the format records the source and target languages
+	write     func(w io.Writer, sourceLang, targetLang string, segments []segment.Segment) error
+	read      func(r io.Reader) (*segment.Document, error)
+}
+
+var segmentFormats = []segmentFormat{
+	{
+		name:      "po",
+		extension: ".po",
+		short:     "gettext PO",
+		languages: true,
+		write:     segment.WritePO,
+		read:      segment.ReadPO,
+	},
+	{
+		name:      "csv",
+		extension: ".csv",
+		short:     "CSV",
+		write: func(w io.Writer, sourceLang, targetLang string, segments []segment.Segment) error {
+			return segment.WriteCSV(w, segments)
+		},
+		read: segment.ReadCSV,
+	},
+	{
+		name:      "jsonl",
+		extension: ".jsonl",
+		short:     "JSON lines",
+		write: func(w io.Writer, sourceLang, targetLang string, segments []segment.Segment) error {
+			return segment.WriteJSONL(w, segments)
+		},
+		read: segment.ReadJSONL,
+	},
+}
+
+// newExportCommand creates the export subcommand of a segment format, which
+// writes the whole book to a single file.
+func newExportCommand(format segmentFormat) *cobra.Command {
+	command := &cobra.Command{
+		Use:   format.name + " [unpackedEpubPath]",
+		Short: fmt.Sprintf("Export the segments as %s", format.short),
+		Long: fmt.Sprintf(`This command writes every marked element of the book to a single %s file, keyed by its content ID,
+with its file and spine position as context and its translation, if any.`, format.short),
+		Example: fmt.Sprintf("epubtrans export %s path/to/unpacked/epub -o book%s", format.name, format.extension),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 1 {
+				return fmt.Errorf("unpackedEpubPath is required. Please provide the path to the unpacked EPUB directory.")
+			}
+
+			return util.ValidateEpubPath(args[0])
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			unzipPath := filepath.Clean(args[0])
+			sourceLang, _ := cmd.Flags().GetString("source")
+			targetLang, _ := cmd.Flags().GetString("target")
+			outputPath, _ := cmd.Flags().GetString("output")
+			if outputPath == "" {
+				outputPath = unzipPath + format.extension
+			}
+
+			segments, err := segment.Collect(unzipPath)
+			if err != nil {
+				return err
+			}
+			if len(segments) == 0 {
+				return fmt.Errorf("no marked content found in %s, run mark first", unzipPath)
+			}
+
+			var buf bytes.Buffer
+			if err := format.write(&buf, sourceLang, targetLang, segments); err != nil {
+				return err
+			}
+			if err := util.WriteFileAtomic(outputPath, buf.Bytes(), 0644); err != nil {
+				return fmt.Errorf("failed to write %s file: %w", format.short, err)
+			}
+
+			cmd.Printf("Exported %d segments to %s\n", len(segments), outputPath)
+			return nil
+		},
+	}
+
+	command.Flags().StringP("output", "o", "", fmt.Sprintf("output file (default is the unpacked book path with %s)", format.extension))
+	if format.languages {
+		command.Flags().String("source", "English", "source language")
+		command.Flags().String("target", "Vietnamese", "target language")
+	}
+	return command
+}
+
+func init() {
+	exportXliff.Flags().StringP("output", "o", "", "output directory, or output file with --per-book (default is next to the unpacked book)")
+	exportXliff.Flags().Bool("per-book", false, "write a single file for the whole book")
+	exportXliff.Flags().String("source", "English", "source language")
+	exportXliff.Flags().String("target", "Vietnamese", "target language")
+
+	Export.AddCommand(exportXliff)
+	for _, format := range segmentFormats {
+		Export.AddCommand(newExportCommand(format))
+	}
+}
+
+func runExportXliff(cmd *cobra.Command, args []string) error {
+	unzipPath := filepath.Clean(args[0])
+	sourceLang, _ := cmd.Flags().GetString("source")
+	targetLang, _ := cmd.Flags().GetString("target")
+	perBook, _ := cmd.Flags().GetBool("per-book")
+	outputPath, _ := cmd.Flags().GetString("output")
+
+	segments, err := segment.Collect(unzipPath)
+	if err != nil {
+		return err
+	}
+	if len(segments) == 0 {
+		return fmt.Errorf("no marked content found in %s, run mark first", unzipPath)
+	}
+
+	if perBook {
+		if outputPath == "" {
+			outputPath = unzipPath + ".xlf"
+		}
+		if err := writeXliffFile(outputPath, sourceLang, targetLang, segments); err != nil {
+			return err
+		}
+		cmd.Printf("Exported %d units to %s\n", len(segments), outputPath)
+		return nil
+	}
+
+	if outputPath == "" {
+		outputPath = unzipPath + "-xliff"
+	}
+	if err := os.MkdirAll(outputPath, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	files := 0
+	for start := 0; start < len(segments); {
+		end := start + 1
+		for end < len(segments) && segments[end].File == segments[start].File {
+			end++
+		}
+
+		documentPath := filepath.Join(outputPath, xliffFileName(segments[start]))
+		if err := writeXliffFile(documentPath, sourceLang, targetLang, segments[start:end]); err != nil {
+			return err
+		}
+		files++
+		start = end
+	}
+
+	cmd.Printf("Exported %d units in %d files to %s\n", len(segments), files, outputPath)
+	return nil
+}
+
+// xliffFileName names the XLIFF file of a spine document after its position
+// in the spine, so the files sort in reading order.
+func xliffFileName(seg segment.Segment) string {
+	base := path.Base(seg.File)
+	return fmt.Sprintf("%03d-%s.xlf", seg.Spine, strings.TrimSuffix(base, path.Ext(base)))
+}
+
+func writeXliffFile(filePath, sourceLang, targetLang string, segments []segment.Segment) error {
+	var buf bytes.Buffer
+	if err := xliff.Write(&buf, sourceLang, targetLang, segments); err != nil {
+		return err
+	}
+	if err := util.WriteFileAtomic(filePath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write XLIFF file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+)
+
+func TestExportXliff(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--provider-option", "drop_every=1", "--cache-dir", t.TempDir())
+
+	outputDir := filepath.Join(t.TempDir(), "xliff")
+	runCommand(t, "export", "xliff", unpackedPath, "-o", outputDir)
+
+	chapter1, err := os.ReadFile(filepath.Join(outputDir, "001-chapter1.xlf"))
+	if err != nil {
+		t.Fatalf("read chapter 1 XLIFF: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "002-chapter2.xlf")); err != nil {
+		t.Fatalf("chapter 2 XLIFF was not written: %v", err)
+	}
+
+	content := string(chapter1)
+	for _, want := range []string{
+		`srcLang="en" trgLang="vi"`,
+		`original="OEBPS/chapter1.xhtml"`,
+		`<source>The clocks were striking <pc id="1" dataRefStart="d1" dataRefEnd="d2">thirteen</pc> again.</source>`,
+		`<target>` + translator.PseudoLocalize(`The clocks were striking `) + `<pc id="1" dataRefStart="d1" dataRefEnd="d2">`,
+		`<source>Nobody noticed &amp; nobody cared.</source>`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("chapter 1 XLIFF is missing %s\n%s", want, content)
+		}
+	}
+	// The mock drops the last segment of every batch, which stays untranslated
+	if got := strings.Count(content, `state="translated"`); got != 3 {
+		t.Errorf("expected 3 translated units in chapter 1, got %d", got)
+	}
+	if got := strings.Count(content, `state="initial"`); got != 1 {
+		t.Errorf("expected 1 initial unit in chapter 1, got %d", got)
+	}
+
+	bookPath := filepath.Join(t.TempDir(), "book.xlf")
+	runCommand(t, "export", "xliff", unpackedPath, "--per-book", "-o", bookPath)
+	book, err := os.ReadFile(bookPath)
+	if err != nil {
+		t.Fatalf("read book XLIFF: %v", err)
+	}
+	if got := strings.Count(string(book), "<unit "); got != 7 {
+		t.Errorf("expected 7 units in the book XLIFF, got %d", got)
+	}
+	if got := strings.Count(string(book), "<file "); got != 2 {
+		t.Errorf("expected 2 file elements in the book XLIFF, got %d", got)
+	}
+}
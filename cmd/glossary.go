@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/glossary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/processor"
+	"github.com/nguyenvanduocit/epubtrans/pkg/ratelimit"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+// glossaryTermsPerRequest bounds the number of terms proposed in one request
+const glossaryTermsPerRequest = 50
+
+var Glossary = &cobra.Command{
+	Use:   "glossary",
+	Short: "Build and maintain the glossary of an unpacked EPUB",
+	Long:  "The translate command reads the book's terminology from META-INF/glossary.csv or META-INF/glossary.tsv. These commands help build that file.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var glossaryExtract = &cobra.Command{
+	Use:   "extract [unpackedEpubPath]",
+	Short: "Extract candidate glossary terms from the marked content",
+	Long: `This command scans every marked element and finds candidate terms offline: text in code elements, code-like tokens,
+acronyms, capitalized names and frequent phrases. With --propose, the configured translator suggests a target for each term.
+New candidates are appended to the book's glossary file for review; existing entries are kept as they are.`,
+	Example: `epubtrans glossary extract path/to/unpacked/epub
+epubtrans glossary extract path/to/unpacked/epub --propose --provider openai --target "Vietnamese"`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("unpackedEpubPath is required. Please provide the path to the unpacked EPUB directory.")
+		}
+
+		return util.ValidateEpubPath(args[0])
+	},
+	RunE: runGlossaryExtract,
+}
+
+func init() {
+	glossaryExtract.Flags().StringP("output", "o", "", "glossary file to write (default is the book's glossary file, or META-INF/glossary.csv)")
+	glossaryExtract.Flags().Int("min-count", 2, "minimum occurrences of code, acronyms and capitalized terms")
+	glossaryExtract.Flags().Int("min-phrase-count", 4, "minimum occurrences of lowercase phrases")
+	glossaryExtract.Flags().Int("max-terms", 200, "maximum number of candidates")
+	glossaryExtract.Flags().Bool("propose", false, "ask the translator to propose a target for each new term")
+	glossaryExtract.Flags().String("source", "English", "source language")
+	glossaryExtract.Flags().String("target", "Vietnamese", "target language")
+	glossaryExtract.Flags().String("provider", "anthropic", fmt.Sprintf("translation provider used by --propose %v", translator.Providers()))
+	glossaryExtract.Flags().String("model", "", "model to use, defaults to the provider's recommended model")
+	glossaryExtract.Flags().String("base-url", "", "API base URL for OpenAI-compatible or local (ollama, llamacpp) servers")
+	glossaryExtract.Flags().String("prompt", "technical", "Prompt preset to use")
+	glossaryExtract.Flags().Int("rpm", 50, "maximum requests per minute, 0 to disable")
+
+	Glossary.AddCommand(glossaryExtract)
+}
+
+func runGlossaryExtract(cmd *cobra.Command, args []string) error {
+	unzipPath := args[0]
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var opts glossary.ExtractOptions
+	opts.MinCount, _ = cmd.Flags().GetInt("min-count")
+	opts.MinPhraseCount, _ = cmd.Flags().GetInt("min-phrase-count")
+	opts.MaxTerms, _ = cmd.Flags().GetInt("max-terms")
+
+	contents, err := markedContents(unzipPath)
+	if err != nil {
+		return err
+	}
+	candidates := glossary.Extract(contents, opts)
+
+	outputPath, _ := cmd.Flags().GetString("output")
+	if outputPath == "" {
+		outputPath = glossary.Find(unzipPath)
+	}
+	if outputPath == "" {
+		outputPath = filepath.Join(unzipPath, glossary.FileNames[0])
+	}
+
+	var entries []glossary.Entry
+	if _, err := os.Stat(outputPath); err == nil {
+		existing, err := glossary.LoadFile(outputPath)
+		if err != nil {
+			return err
+		}
+		entries = existing.Entries
+	}
+	existingCount := len(entries)
+
+	known := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		known[strings.ToLower(entry.Source)] = true
+	}
+	var added []glossary.Entry
+	for _, candidate := range candidates {
+		if !known[strings.ToLower(candidate.Term)] {
+			added = append(added, candidate.Entry())
+		}
+	}
+
+	if propose, _ := cmd.Flags().GetBool("propose"); propose && len(added) > 0 {
+		if err := proposeGlossaryTargets(ctx, cmd, unzipPath, added); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := glossary.Write(&buf, append(entries, added...), glossary.Separator(outputPath)); err != nil {
+		return fmt.Errorf("failed to write glossary: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create glossary directory: %w", err)
+	}
+	if err := util.WriteFileAtomic(outputPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write glossary: %w", err)
+	}
+
+	fmt.Printf("Found %d candidates, added %d new entries to %s (%d existing entries kept)\n", len(candidates), len(added), outputPath, existingCount)
+	return nil
+}
+
+// markedContents returns the HTML of every marked element in the book's content files.
+func markedContents(unzipPath string) ([]string, error) {
+	files, _, err := processor.ContentFiles(unzipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var contents []string
+	for _, filePath := range files {
+		doc, err := util.OpenAndReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open and read file: %w", err)
+		}
+
+		doc.Find("[" + util.ContentIdKey + "]").Each(func(i int, s *goquery.Selection) {
+			if content, err := s.Html(); err == nil {
+				contents = append(contents, content)
+			}
+		})
+	}
+
+	return contents, nil
+}
+
+// proposeGlossaryTargets fills in the target of the entries that should be
+// translated, sending the terms as numbered segments like translate does.
+func proposeGlossaryTargets(ctx context.Context, cmd *cobra.Command, unzipPath string, entries []glossary.Entry) error {
+	bookName, err := extractBookName(unzipPath)
+	if err != nil {
+		return fmt.Errorf("error extracting book name: %v", err)
+	}
+
+	provider, _ := cmd.Flags().GetString("provider")
+	source, _ := cmd.Flags().GetString("source")
+	target, _ := cmd.Flags().GetString("target")
+	promptPreset, _ := cmd.Flags().GetString("prompt")
+	requestsPerMinute, _ := cmd.Flags().GetInt("rpm")
+
+	t, err := translator.New(provider, &translator.Config{
+		BaseURL:     cmd.Flag("base-url").Value.String(),
+		Model:       cmd.Flag("model").Value.String(),
+		Temperature: 0.3,
+		MaxTokens:   8192,
+		DataDir:     filepath.Join(unzipPath, "META-INF"),
+	})
+	if err != nil {
+		return fmt.Errorf("error getting translator: %v", err)
+	}
+	limiter := ratelimit.New(requestsPerMinute, 0)
+	systemTokens := translator.EstimateTokens(translator.TranslationSystem(source, target, "", bookName, promptPreset))
+
+	var pending []int
+	for i, entry := range entries {
+		if !entry.DoNotTranslate {
+			pending = append(pending, i)
+		}
+	}
+
+	for start := 0; start < len(pending); start += glossaryTermsPerRequest {
+		chunk := pending[start:min(start+glossaryTermsPerRequest, len(pending))]
+
+		var prompt strings.Builder
+		prompt.WriteString("Translate each of the following glossary terms the way they should be rendered throughout this book. Each term is marked with SEGMENT markers. Reply with the same markers around the translated term only, without explanations.\n\n")
+		for i, index := range chunk {
+			fmt.Fprintf(&prompt, "<SEGMENT_%d>\n%s\n</SEGMENT_%d>\n\n", i, entries[index].Source, i)
+		}
+
+		fmt.Printf("Proposing targets for %d terms\n", len(chunk))
+		translated, err := retryTranslate(ctx, t, limiter, systemTokens, prompt.String(), source, target, bookName, promptPreset)
+		if err != nil {
+			return fmt.Errorf("failed to propose glossary targets: %w", err)
+		}
+
+		translations, problems := splitTranslations(translated, len(chunk))
+		if len(problems) > 0 {
+			fmt.Printf("Warning: %s, leaving those terms empty\n", strings.Join(problems, ", "))
+		}
+		for i, translation := range translations {
+			if translation != "" {
+				entries[chunk[i]].Target = translation
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/glossary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+)
+
+func TestGlossaryExtractProposesAndMerges(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	runCommand(t, "glossary", "extract", unpackedPath, "--min-count", "1", "--propose", "--provider", "mock")
+
+	g, err := glossary.LoadFile(filepath.Join(unpackedPath, "META-INF", "glossary.csv"))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	var april *glossary.Entry
+	for i := range g.Entries {
+		if g.Entries[i].Source == "April" {
+			april = &g.Entries[i]
+		}
+	}
+	if april == nil {
+		t.Fatalf("glossary has no entry for April: %+v", g.Entries)
+	}
+	if april.Target == "" || translator.DePseudoLocalize(april.Target) != "April" {
+		t.Errorf("April has target %q, want the mock's proposal", april.Target)
+	}
+
+	// A second run keeps the reviewed entries and adds nothing new
+	runCommand(t, "glossary", "extract", unpackedPath, "--min-count", "1")
+
+	again, err := glossary.LoadFile(filepath.Join(unpackedPath, "META-INF", "glossary.csv"))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if len(again.Entries) != len(g.Entries) {
+		t.Errorf("second run changed the glossary from %d to %d entries", len(g.Entries), len(again.Entries))
+	}
+}
@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/segment"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+	"github.com/nguyenvanduocit/epubtrans/pkg/xliff"
+	"github.com/spf13/cobra"
+)
+
+var Import = &cobra.Command{
+	Use:   "import",
+	Short: "Import reviewed translations into an unpacked EPUB",
+	Long:  "Translated segments are matched to the book by content ID and written as the translated sibling of the marked element, as translate does.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var importXliff = &cobra.Command{
+	Use:   "xliff [unpackedEpubPath] [file.xlf]",
+	Short: "Import the targets of an XLIFF 2.0 file",
+	Long: `This command writes the target of every translated XLIFF unit into the book, creating or updating the translated
+sibling of the element with the same content ID. Inline codes are restored to the original HTML.
+Units whose source text changed since the export, whose tags do not match the source, or that are missing from the book
+are reported and left out.`,
+	Example: "epubtrans import xliff path/to/unpacked/epub xliff/001-chapter1.xlf",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 2 {
+			return fmt.Errorf("unpackedEpubPath and the XLIFF file are required")
+		}
+
+		return util.ValidateEpubPath(args[0])
+	},
+	RunE: runImportXliff,
+}
+
+// newImportCommand creates the import subcommand of a segment format.
+func newImportCommand(format segmentFormat) *cobra.Command {
+	command := &cobra.Command{
+		Use:   fmt.Sprintf("%s [unpackedEpubPath] [file%s]", format.name, format.extension),
+		Short: fmt.Sprintf("Import the translations of a %s file", format.short),
+		Long: fmt.Sprintf(`This command writes the translation of every segment of a %s file into the book, creating or updating the
+translated sibling of the element with the same content ID. Segments whose source text changed since the export,
+whose tags do not match the source, or that are missing from the book are reported and left out.`, format.short),
+		Example: fmt.Sprintf("epubtrans import %s path/to/unpacked/epub book%s --target Vietnamese", format.name, format.extension),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) != 2 {
+				return fmt.Errorf("unpackedEpubPath and the %s file are required", format.short)
+			}
+
+			return util.ValidateEpubPath(args[0])
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return importSegments(cmd, args[0], args[1], format.read)
+		},
+	}
+
+	targetUsage := "target language"
+	if format.languages {
+		targetUsage = "target language (default is the language recorded in the file)"
+	}
+	command.Flags().String("target", "", targetUsage)
+	return command
+}
+
+func init() {
+	importXliff.Flags().String("target", "", "target language (default is the trgLang of the XLIFF file)")
+
+	Import.AddCommand(importXliff)
+	for _, format := range segmentFormats {
+		Import.AddCommand(newImportCommand(format))
+	}
+}
+
+func runImportXliff(cmd *cobra.Command, args []string) error {
+	return importSegments(cmd, args[0], args[1], xliff.Read)
+}
+
+// importSegments reads the segments of filePath with read and writes their
+// translations into the unpacked book.
+func importSegments(cmd *cobra.Command, unzipPath, filePath string, read func(r io.Reader) (*segment.Document, error)) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	doc, err := read(f)
+	if err != nil {
+		return err
+	}
+
+	targetLang, _ := cmd.Flags().GetString("target")
+	if targetLang == "" {
+		targetLang = doc.TargetLang
+	}
+	if targetLang == "" {
+		return fmt.Errorf("%s does not record the target language, set one with --target", filePath)
+	}
+
+	report, err := applySegments(unzipPath, doc.Segments, targetLang)
+	if err != nil {
+		return err
+	}
+	report.print(cmd, filePath)
+	return nil
+}
+
+// importIssue is a segment left out of an import and the reason why.
+type importIssue struct {
+	segment segment.Segment
+	reason  string
+}
+
+// importReport counts the translations an import wrote and lists the segments
+// it left out.
+type importReport struct {
+	created   int
+	updated   int
+	unchanged int
+	skipped   []importIssue
+}
+
+func (r *importReport) skip(seg segment.Segment, reason string) {
+	r.skipped = append(r.skipped, importIssue{segment: seg, reason: reason})
+}
+
+func (r *importReport) print(cmd *cobra.Command, filePath string) {
+	cmd.Printf("Imported %s: %d created, %d updated, %d unchanged\n", filePath, r.created, r.updated, r.unchanged)
+	if len(r.skipped) == 0 {
+		return
+	}
+
+	cmd.Printf("Skipped %d segments:\n", len(r.skipped))
+	for _, issue := range r.skipped {
+		cmd.Printf("  %s (%s): %s\n", issue.segment.ID, issue.segment.File, issue.reason)
+	}
+}
+
+// applySegments writes the targets of segments into the unpacked book. A
+// segment without a target is ignored. Segments whose source text no longer
+// matches the book, whose tags differ from the source, that cannot be found or
+// whose file is not a path inside the book are reported instead of written.
+func applySegments(unzipPath string, segments []segment.Segment, targetLang string) (*importReport, error) {
+	report := &importReport{}
+
+	var files []string
+	byFile := make(map[string][]segment.Segment)
+	for _, seg := range segments {
+		if seg.Target == "" {
+			continue
+		}
+		if _, ok := byFile[seg.File]; !ok {
+			files = append(files, seg.File)
+		}
+		byFile[seg.File] = append(byFile[seg.File], seg)
+	}
+
+	for _, file := range files {
+		// The file names come from the imported file, so keep them inside the book
+		if file != "" && !filepath.IsLocal(filepath.FromSlash(file)) {
+			for _, seg := range byFile[file] {
+				report.skip(seg, "file is outside the book")
+			}
+			continue
+		}
+
+		filePath := filepath.Join(unzipPath, filepath.FromSlash(file))
+		if _, err := os.Stat(filePath); file == "" || err != nil {
+			for _, seg := range byFile[file] {
+				report.skip(seg, "file not found in the book")
+			}
+			continue
+		}
+
+		doc, err := util.OpenAndReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open and read file: %w", err)
+		}
+
+		modified := false
+		for _, seg := range byFile[file] {
+			source := doc.Find(fmt.Sprintf("[%s=%q]", util.ContentIdKey, seg.ID)).First()
+			if source.Length() == 0 {
+				report.skip(seg, "content ID not found in the book")
+				continue
+			}
+
+			current, err := source.Html()
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s in %s: %w", seg.ID, file, err)
+			}
+			if seg.Source != "" && segment.Text(seg.Source) != segment.Text(current) {
+				report.skip(seg, "source text changed since export")
+				continue
+			}
+			if sourceTags, targetTags := segment.Tags(current), segment.Tags(seg.Target); !slices.Equal(sourceTags, targetTags) {
+				report.skip(seg, fmt.Sprintf("target tags [%s] do not match source tags [%s]", strings.Join(targetTags, " "), strings.Join(sourceTags, " ")))
+				continue
+			}
+
+			translated := segment.Translation(doc.Selection, source)
+			if translated == nil {
+				if err := manipulateHTML(source, targetLang, seg.Target); err != nil {
+					return nil, err
+				}
+				translated = segment.Translation(doc.Selection, source)
+				report.created++
+			} else {
+				existing, _ := translated.Html()
+				state, _ := translated.Attr(util.TranslationStateKey)
+				if existing == seg.Target && segment.ParseState(state) == reviewState(seg.State) {
+					report.unchanged++
+					continue
+				}
+				translated.SetHtml(seg.Target)
+				translated.SetAttr(util.TranslationLangKey, targetLang)
+				report.updated++
+			}
+
+			if state := reviewState(seg.State); state != segment.StateInitial {
+				translated.SetAttr(util.TranslationStateKey, string(state))
+			} else {
+				translated.RemoveAttr(util.TranslationStateKey)
+			}
+			modified = true
+		}
+
+		if modified {
+			if err := writeContentToFile(filePath, doc); err != nil {
+				return nil, fmt.Errorf("failed to write file: %w", err)
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// reviewState returns the state recorded on a translated element. Plain
+// translations carry no state attribute, which reads back as StateInitial.
+func reviewState(state segment.State) segment.State {
+	switch state {
+	case segment.StateReviewed, segment.StateFinal:
+		return state
+	default:
+		return segment.StateInitial
+	}
+}
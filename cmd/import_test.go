@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/segment"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+func TestImportXliff(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--provider-option", "drop_every=1", "--cache-dir", t.TempDir())
+
+	xliffPath := filepath.Join(t.TempDir(), "book.xlf")
+	runCommand(t, "export", "xliff", unpackedPath, "--per-book", "-o", xliffPath)
+	exported, err := os.ReadFile(xliffPath)
+	if err != nil {
+		t.Fatalf("read XLIFF: %v", err)
+	}
+
+	edits := []struct {
+		pattern, replacement string
+	}{
+		// Translate a unit the mock dropped
+		{`(<source>Nobody noticed &amp; nobody cared\.</source>)`, `${1}<target>Không ai để ý &amp; không ai quan tâm.</target>`},
+		// Review a translated unit
+		{`(?s)<segment state="translated">(\s*<source>It was a bright cold day in April\.</source>\s*)<target>.*?</target>`, `<segment state="reviewed">${1}<target>Một ngày tháng Tư lạnh.</target>`},
+		// Lose the inline code of a unit
+		{`(<target>[^<]*)<pc id="1" dataRefStart="d1" dataRefEnd="d2">([^<]*)</pc>`, `${1}${2}`},
+		// Pretend the book changed since the export
+		{`<source>The second chapter</source>`, `<source>The 2nd chapter</source>`},
+		// Add a unit that is not in the book
+		{`(?s)(.*)</file>`, `${1}<unit id="missing"><segment state="translated"><source>Gone</source><target>Mất</target></segment></unit></file>`},
+	}
+	edited := string(exported)
+	for _, edit := range edits {
+		re := regexp.MustCompile(edit.pattern)
+		if !re.MatchString(edited) {
+			t.Fatalf("edit %q does not apply to\n%s", edit.pattern, edited)
+		}
+		edited = re.ReplaceAllString(edited, edit.replacement)
+	}
+	if err := os.WriteFile(xliffPath, []byte(edited), 0644); err != nil {
+		t.Fatalf("write XLIFF: %v", err)
+	}
+
+	var out bytes.Buffer
+	Root.SetOut(&out)
+	t.Cleanup(func() { Root.SetOut(nil) })
+	runCommand(t, "import", "xliff", unpackedPath, xliffPath)
+
+	report := out.String()
+	for _, want := range []string{
+		"1 created, 1 updated, 2 unchanged",
+		"Skipped 3 segments:",
+		"source text changed since export",
+		"target tags [] do not match source tags [em]",
+		"missing (OEBPS/chapter2.xhtml): content ID not found in the book",
+	} {
+		if !strings.Contains(report, want) {
+			t.Errorf("import report is missing %q\n%s", want, report)
+		}
+	}
+
+	runCommand(t, "export", "xliff", unpackedPath, "--per-book", "-o", xliffPath)
+	reexported, err := os.ReadFile(xliffPath)
+	if err != nil {
+		t.Fatalf("read XLIFF: %v", err)
+	}
+	for _, want := range []string{
+		`<target>Không ai để ý &amp; không ai quan tâm.</target>`,
+		`<target>Một ngày tháng Tư lạnh.</target>`,
+		`<segment state="reviewed">`,
+	} {
+		if !strings.Contains(string(reexported), want) {
+			t.Errorf("re-exported XLIFF is missing %s\n%s", want, reexported)
+		}
+	}
+	if strings.Contains(string(reexported), "The 2nd chapter") {
+		t.Errorf("a unit with a changed source was imported")
+	}
+}
+
+func TestExportImportSegmentFormats(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--provider-option", "drop_every=1", "--cache-dir", t.TempDir())
+
+	var out bytes.Buffer
+	Root.SetOut(&out)
+	t.Cleanup(func() { Root.SetOut(nil) })
+
+	// Importing an untouched export changes nothing
+	for _, format := range []string{"po", "csv", "jsonl"} {
+		path := filepath.Join(t.TempDir(), "book."+format)
+		runCommand(t, "export", format, unpackedPath, "-o", path)
+
+		out.Reset()
+		runCommand(t, "import", format, unpackedPath, path, "--target", "Vietnamese")
+		if !strings.Contains(out.String(), "0 created, 0 updated, 5 unchanged") {
+			t.Errorf("%s: unexpected import report\n%s", format, out.String())
+		}
+	}
+
+	// A volunteer fills in the segment the mock dropped
+	poPath := filepath.Join(t.TempDir(), "book.po")
+	runCommand(t, "export", "po", unpackedPath, "-o", poPath)
+	po, err := os.ReadFile(poPath)
+	if err != nil {
+		t.Fatalf("read PO: %v", err)
+	}
+	edited := strings.Replace(string(po), "msgid \"Nobody noticed &amp; nobody cared.\"\nmsgstr \"\"", "msgid \"Nobody noticed &amp; nobody cared.\"\nmsgstr \"Không ai để ý &amp; không ai quan tâm.\"", 1)
+	if edited == string(po) {
+		t.Fatalf("the dropped segment is not in the PO file\n%s", po)
+	}
+	if err := os.WriteFile(poPath, []byte(edited), 0644); err != nil {
+		t.Fatalf("write PO: %v", err)
+	}
+
+	out.Reset()
+	runCommand(t, "import", "po", unpackedPath, poPath)
+	if !strings.Contains(out.String(), "1 created, 0 updated, 5 unchanged") {
+		t.Errorf("unexpected import report\n%s", out.String())
+	}
+
+	jsonlPath := filepath.Join(t.TempDir(), "book.jsonl")
+	runCommand(t, "export", "jsonl", unpackedPath, "-o", jsonlPath)
+	jsonl, err := os.ReadFile(jsonlPath)
+	if err != nil {
+		t.Fatalf("read JSON lines: %v", err)
+	}
+	if !strings.Contains(string(jsonl), `"target":"Không ai để ý &amp; không ai quan tâm.","state":"translated"`) {
+		t.Errorf("the imported translation was not exported\n%s", jsonl)
+	}
+}
+
+func TestImportSkipsFilesOutsideTheBook(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	// A marked chapter next to the book that an import must not touch
+	chapter, err := os.ReadFile(filepath.Join(unpackedPath, "OEBPS", "chapter1.xhtml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outsidePath := filepath.Join(filepath.Dir(unpackedPath), "outside.xhtml")
+	if err := os.WriteFile(outsidePath, chapter, 0644); err != nil {
+		t.Fatal(err)
+	}
+	id := regexp.MustCompile(util.ContentIdKey + `="([^"]+)"`).FindSubmatch(chapter)
+	if id == nil {
+		t.Fatalf("chapter1.xhtml has no content ID")
+	}
+
+	report, err := applySegments(unpackedPath, []segment.Segment{
+		{ID: string(id[1]), File: "../outside.xhtml", Target: "Ngoài"},
+		{ID: string(id[1]), File: filepath.ToSlash(outsidePath), Target: "Ngoài"},
+	}, "Vietnamese")
+	if err != nil {
+		t.Fatalf("applySegments() error = %v", err)
+	}
+
+	if len(report.skipped) != 2 {
+		t.Fatalf("skipped %d segments, want 2", len(report.skipped))
+	}
+	for _, issue := range report.skipped {
+		if issue.reason != "file is outside the book" {
+			t.Errorf("segment in %s skipped because %s", issue.segment.File, issue.reason)
+		}
+	}
+	if after, _ := os.ReadFile(outsidePath); !bytes.Equal(after, chapter) {
+		t.Errorf("import rewrote a file outside the book")
+	}
+}
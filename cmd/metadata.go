@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"path/filepath"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/budget"
+	"github.com/nguyenvanduocit/epubtrans/pkg/glossary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/metadata"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+)
+
+// metadataBatchSize bounds the texts sent in one metadata request
+const metadataBatchSize = 40
+
+// metadataNote tells the translator what the texts of a metadata batch are
+const metadataNote = "BOOK METADATA:\nThe segments are the title and description of the book and the entries of its table of contents. " +
+	"Translate them as titles and headings, briefly, without adding punctuation."
+
+// translateMetadata translates the title, description and navigation labels
+// of the book that have no translation for the target language yet, and
+// stores them for pack.
+func (p *translationPipeline) translateMetadata(ctx context.Context) error {
+	docs, err := metadata.Locate(p.unzipPath)
+	if err != nil {
+		return err
+	}
+	texts, err := metadata.Texts(p.unzipPath, docs)
+	if err != nil {
+		return err
+	}
+
+	translations, err := metadata.Load(p.unzipPath)
+	if err != nil {
+		return err
+	}
+	if translations.Target != targetLanguage {
+		translations.Target = targetLanguage
+		clear(translations.Strings)
+	}
+
+	var pending []string
+	for _, text := range texts {
+		if translations.Strings[text] == "" {
+			pending = append(pending, text)
+		}
+	}
+	if len(pending) == 0 {
+		fmt.Println("Book metadata is already translated")
+		return nil
+	}
+	fmt.Printf("\nTranslating %d metadata and navigation texts\n", len(pending))
+
+	// Debug files of metadata batches go next to the package document
+	debugPath := filepath.Join(p.unzipPath, filepath.FromSlash(docs.Package))
+
+	translated := 0
+	for start := 0; start < len(pending); start += metadataBatchSize {
+		batch := metadataBatch(pending[start:min(start+metadataBatchSize, len(pending))])
+		results, err := p.translateMetadataBatch(ctx, debugPath, batch)
+		if err != nil {
+			fmt.Printf("Metadata translation error: %v\n", err)
+			continue
+		}
+		for i, result := range results {
+			if result == "" {
+				continue
+			}
+			translations.Strings[html.UnescapeString(batch.elements[i].content)] = strings.Join(strings.Fields(html.UnescapeString(result)), " ")
+			translated++
+		}
+	}
+
+	if err := translations.Save(); err != nil {
+		return err
+	}
+	fmt.Printf("Translated %d of %d metadata and navigation texts, saved to %s\n", translated, len(pending), metadata.FileName)
+	return nil
+}
+
+// metadataBatch turns texts into a batch of HTML segments.
+func metadataBatch(texts []string) translationBatch {
+	batch := translationBatch{elements: make([]elementToTranslate, len(texts))}
+	for i, text := range texts {
+		batch.elements[i] = elementToTranslate{
+			contentID: fmt.Sprintf("meta-%d", i),
+			content:   html.EscapeString(text),
+		}
+		batch.wordCount += float32(countWords(text))
+	}
+	return batch
+}
+
+// translateMetadataBatch sends batch within the budget and returns the
+// translation of each of its texts, empty for those that failed.
+func (p *translationPipeline) translateMetadataBatch(ctx context.Context, debugPath string, batch translationBatch) ([]string, error) {
+	prompt, err := batchPrompt(p.protocol, batch)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &translator.Usage{}
+	translateCtx := translator.WithSystemNotes(translator.ContextWithUsage(ctx, usage), metadataNote)
+	if entries := p.glossary.Relevant(batchText(batch)); len(entries) > 0 {
+		translateCtx = translator.WithSystemNotes(translateCtx, glossary.Prompt(entries))
+	}
+	if p.protocol == protocolJSON {
+		translateCtx = translator.WithJSONResponse(translateCtx)
+	}
+
+	estimate := p.estimateSpend(translateCtx, prompt, batch)
+	if p.budget != nil {
+		if err := p.budget.Reserve(estimate); err != nil {
+			return nil, err
+		}
+	}
+
+	translations, err := p.translateBatch(translateCtx, debugPath, batch, prompt, &estimate)
+
+	if p.budget != nil {
+		actual := budget.Spend{InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens, Cost: usage.Cost(p.model)}
+		if err := p.budget.Commit(estimate, actual, p.provider+"/"+p.model); err != nil {
+			fmt.Printf("Warning: failed to update spend record: %v\n", err)
+		}
+	}
+
+	return translations, err
+}
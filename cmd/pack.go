@@ -2,31 +2,71 @@ package cmd
 
 import (
 	"archive/zip"
+	"bytes"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
-	"sync"
 	"sync/atomic"
-
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/budget"
+	"github.com/nguyenvanduocit/epubtrans/pkg/glossary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/journal"
+	"github.com/nguyenvanduocit/epubtrans/pkg/loader"
+	"github.com/nguyenvanduocit/epubtrans/pkg/metadata"
+	"github.com/nguyenvanduocit/epubtrans/pkg/segment"
+	"github.com/nguyenvanduocit/epubtrans/pkg/summary"
 	"github.com/nguyenvanduocit/epubtrans/pkg/util"
 	"github.com/spf13/cobra"
 )
 
 const (
 	defaultBufferSize = 32 * 1024 // 32KB
-	channelBufferSize = 100
 	defaultSuffix     = "-bilangual.epub"
 )
 
+// Pack modes choose which languages end up in the packed book.
+const (
+	packModeBilingual  = "bilingual"
+	packModeTargetOnly = "target-only"
+	packModeSourceOnly = "source-only"
+)
+
+var packModeSuffixes = map[string]string{
+	packModeBilingual:  defaultSuffix,
+	packModeTargetOnly: "-target-only.epub",
+	packModeSourceOnly: "-source-only.epub",
+}
+
 var Pack = &cobra.Command{
 	Use:   "pack [unpackedEpubPath]",
 	Short: "Create an EPUB file from an unpacked directory",
 	Long: `Pack creates a new EPUB file from an unpacked directory structure.
 It compresses the contents and maintains the EPUB file structure.
-This command is useful after modifying the contents of an unpacked EPUB.`,
-	Example: "epubtrans pack /path/to/unpacked/epub",
+This command is useful after modifying the contents of an unpacked EPUB.
+
+The mimetype entry is written first and stored uncompressed, as the OCF specification requires. Entries are
+sorted and share one timestamp, taken from SOURCE_DATE_EPOCH when set, so packing the same book twice gives the
+same file. Working files such as the translation journal and debug files are left out; add patterns with --exclude.
+
+Titles, descriptions and table of contents entries translated with "translate --metadata" are shown next to the
+originals in bilingual books and replace them in target-only books.
+
+By default the book keeps both languages. With --mode target-only or source-only, the elements of the other
+language are removed from the packed book and its language is updated; the unpacked directory is left untouched.
+Elements without a translation stay in the source language in target-only books.`,
+	Example: `epubtrans pack /path/to/unpacked/epub
+epubtrans pack /path/to/unpacked/epub --mode target-only`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
 			return fmt.Errorf("unpackedEpubPath is required")
@@ -39,15 +79,90 @@ This command is useful after modifying the contents of an unpacked EPUB.`,
 
 func init() {
 	Pack.Flags().StringP("output", "o", "", "output file path")
+	Pack.Flags().String("mode", packModeBilingual, fmt.Sprintf("languages to keep: %s, %s or %s", packModeBilingual, packModeTargetOnly, packModeSourceOnly))
+	Pack.Flags().String("lang", "", "language tag of a monolingual book (default is the language of the translations for target-only)")
+	Pack.Flags().StringSlice("exclude", nil, "additional patterns of files to leave out, such as \"drafts/*\" or \"*.bak\"")
+	Pack.Flags().Bool("no-default-excludes", false, "also pack the working files of epubtrans, such as the translation journal and debug files")
 }
 
 func runPack(cmd *cobra.Command, args []string) error {
 	srcDir := args[0]
 	outputPath, _ := cmd.Flags().GetString("output")
-	return packFiles(srcDir, outputPath)
+	mode, _ := cmd.Flags().GetString("mode")
+	lang, _ := cmd.Flags().GetString("lang")
+
+	suffix, ok := packModeSuffixes[mode]
+	if !ok {
+		return fmt.Errorf("unknown pack mode %q, use %s, %s or %s", mode, packModeBilingual, packModeTargetOnly, packModeSourceOnly)
+	}
+
+	var opts packOptions
+	var err error
+	if mode != packModeBilingual {
+		opts.rewrites, err = monolingualRewrites(srcDir, mode, lang)
+		if err != nil {
+			return err
+		}
+	}
+	if mode != packModeSourceOnly {
+		opts.rewrites, err = metadataRewrites(srcDir, mode, opts.rewrites)
+		if err != nil {
+			return err
+		}
+	}
+	if opts.modified, err = packTimestamp(); err != nil {
+		return err
+	}
+	if noDefaults, _ := cmd.Flags().GetBool("no-default-excludes"); !noDefaults {
+		opts.excludes = append(opts.excludes, defaultPackExcludes...)
+	}
+	excludes, _ := cmd.Flags().GetStringSlice("exclude")
+	opts.excludes = append(opts.excludes, excludes...)
+
+	if outputPath == "" {
+		outputPath = strings.TrimRight(srcDir, `/\`) + suffix
+	}
+	return packFiles(srcDir, outputPath, opts)
+}
+
+const (
+	// ocfMimetype is the content of the mimetype entry of every EPUB
+	ocfMimetype = "application/epub+zip"
+	// ocfContainerPath is the location of the OCF container document
+	ocfContainerPath = "META-INF/container.xml"
+)
+
+// defaultPackExcludes are the working files of epubtrans and common system
+// files that never belong in a packed book.
+var defaultPackExcludes = append([]string{
+	"*.debug.txt",
+	"*.tmp",
+	".DS_Store",
+	"Thumbs.db",
+	"META-INF/guidelines.txt",
+	"META-INF/translator_metadata.json",
+	"META-INF/translator.log",
+	journal.FileName,
+	budget.FileName,
+	summary.FileName,
+	metadata.FileName,
+}, glossary.FileNames...)
+
+// packOptions controls what packFiles writes.
+type packOptions struct {
+	// rewrites replaces the content of files, keyed by their slash separated path relative to the book
+	rewrites map[string][]byte
+	// excludes are patterns of files to leave out, see excludedFromPack
+	excludes []string
+	// modified is the timestamp of every entry
+	modified time.Time
 }
 
-func packFiles(srcDir string, outputPath string) error {
+// packFiles zips srcDir into an OCF container at outputPath: the mimetype entry
+// comes first, stored and without extra fields, followed by
+// META-INF/container.xml and the other files in lexical order, all with the
+// same timestamp so that packing the same book twice gives the same bytes.
+func packFiles(srcDir string, outputPath string, opts packOptions) error {
 	if outputPath == "" {
 		outputPath = getUniqueFilename(srcDir + defaultSuffix)
 	} else {
@@ -59,6 +174,11 @@ func packFiles(srcDir string, outputPath string) error {
 		return fmt.Errorf("invalid source directory: %w", err)
 	}
 
+	files, err := collectPackFiles(srcDir, opts.excludes)
+	if err != nil {
+		return fmt.Errorf("failed to pack files: %w", err)
+	}
+
 	progress := &packingProgress{}
 
 	fmt.Printf("Creating zip file: %s\n", outputPath)
@@ -70,74 +190,119 @@ func packFiles(srcDir string, outputPath string) error {
 	defer newZipFile.Close()
 
 	zipWriter := zip.NewWriter(newZipFile)
-	defer zipWriter.Close()
-
-	// Create a buffered channel for file info
-	fileInfoChan := make(chan fileInfo, channelBufferSize)
-
-	// Start a single goroutine to write to the zip file
-	var wg sync.WaitGroup
-	wg.Add(1)
-	var writeErr error
-	go func() {
-		defer wg.Done()
-		for fi := range fileInfoChan {
-			if err := validateFile(fi.path, fi.info); err != nil {
-				writeErr = err
-				return
-			}
 
-			if err := addFileToZip(zipWriter, fi, progress); err != nil {
-				writeErr = err
-				return
-			}
+	if err := addMimetype(zipWriter, opts.modified); err != nil {
+		return fmt.Errorf("failed to write to zip: %w", err)
+	}
+	for _, fi := range files {
+		if err := validateFile(fi.relPath); err != nil {
+			return fmt.Errorf("failed to write to zip: %w", err)
+		}
 
-			fmt.Printf("Added file: %s (%.2f KB)\n", fi.relPath, float64(fi.info.Size())/1024)
+		fi.content = opts.rewrites[fi.relPath]
+		if err := addFileToZip(zipWriter, fi, opts.modified, progress); err != nil {
+			return fmt.Errorf("failed to write to zip: %w", err)
 		}
-	}()
 
-	// Walk the directory and send file info to the channel
-	err = filepath.Walk(srcDir, func(filePath string, info os.FileInfo, err error) error {
+		fmt.Printf("Added file: %s (%.2f KB)\n", fi.relPath, float64(fi.info.Size())/1024)
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish zip file: %w", err)
+	}
+
+	fmt.Printf("\nZip creation complete:\n")
+	fmt.Printf("Total files: %d\n", progress.fileCount+1)
+	fmt.Printf("Total size: %.2f MB\n", float64(progress.totalSize)/(1024*1024))
+	fmt.Printf("Output file: %s\n", outputPath)
+
+	return nil
+}
+
+// collectPackFiles returns the files of srcDir to pack, other than mimetype,
+// with META-INF/container.xml first and the rest sorted by path.
+func collectPackFiles(srcDir string, excludes []string) ([]fileInfo, error) {
+	var files []fileInfo
+	err := filepath.WalkDir(srcDir, func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return fmt.Errorf("error walking directory: %w", err)
 		}
 
-		if info.IsDir() {
-			return nil // Skip directories
-		}
-
 		relPath, err := filepath.Rel(srcDir, filePath)
 		if err != nil {
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
+		relPath = filepath.ToSlash(relPath)
+		if relPath == "." {
+			return nil
+		}
 
-		fileInfoChan <- fileInfo{path: filePath, relPath: relPath, info: info}
-		return nil
-	})
-
-	close(fileInfoChan)
-	wg.Wait()
+		if excludedFromPack(relPath, excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			fmt.Printf("Excluded file: %s\n", relPath)
+			return nil
+		}
+		if d.IsDir() || relPath == "mimetype" {
+			return nil
+		}
 
-	if writeErr != nil {
-		return fmt.Errorf("failed to write to zip: %w", writeErr)
-	}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
 
+		files = append(files, fileInfo{path: filePath, relPath: relPath, info: info})
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to pack files: %w", err)
+		return nil, err
 	}
 
-	fmt.Printf("\nZip creation complete:\n")
-	fmt.Printf("Total files: %d\n", progress.fileCount)
-	fmt.Printf("Total size: %.2f MB\n", float64(progress.totalSize)/(1024*1024))
-	fmt.Printf("Output file: %s\n", outputPath)
+	sort.Slice(files, func(i, j int) bool {
+		if (files[i].relPath == ocfContainerPath) != (files[j].relPath == ocfContainerPath) {
+			return files[i].relPath == ocfContainerPath
+		}
+		return files[i].relPath < files[j].relPath
+	})
+	return files, nil
+}
 
-	return nil
+// excludedFromPack reports whether relPath matches one of patterns. Patterns
+// with a slash are matched against the whole path, the others against each
+// path element, so "*.debug.txt" excludes debug files in every directory and
+// ".git" excludes a whole directory.
+func excludedFromPack(relPath string, patterns []string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSuffix(filepath.ToSlash(strings.TrimSpace(pattern)), "/")
+		if pattern == "" {
+			continue
+		}
+
+		if strings.Contains(pattern, "/") {
+			if matched, _ := path.Match(pattern, relPath); matched {
+				return true
+			}
+			continue
+		}
+		for _, element := range strings.Split(relPath, "/") {
+			if matched, _ := path.Match(pattern, element); matched {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 type fileInfo struct {
 	path    string
 	relPath string
 	info    os.FileInfo
+	content []byte // replaces the file's content when not nil
 }
 
 type packingProgress struct {
@@ -150,19 +315,47 @@ func (p *packingProgress) update(size int64) {
 	atomic.AddInt64(&p.totalSize, size)
 }
 
-func addFileToZip(zipWriter *zip.Writer, fi fileInfo, progress *packingProgress) error {
-	zipFileHeader, err := zip.FileInfoHeader(fi.info)
+// addMimetype writes the mimetype entry stored, without extra fields and
+// without a data descriptor, as OCF requires of the first entry.
+func addMimetype(zipWriter *zip.Writer, modified time.Time) error {
+	header := &zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE([]byte(ocfMimetype)),
+		CompressedSize64:   uint64(len(ocfMimetype)),
+		UncompressedSize64: uint64(len(ocfMimetype)),
+	}
+	setZipTime(header, modified)
+
+	writer, err := zipWriter.CreateRaw(header)
 	if err != nil {
-		return fmt.Errorf("failed to create file header: %w", err)
+		return fmt.Errorf("failed to create mimetype entry: %w", err)
 	}
-	zipFileHeader.Name = fi.relPath
-	zipFileHeader.Method = chooseCompressionMethod(fi.path)
+	_, err = io.WriteString(writer, ocfMimetype)
+	return err
+}
+
+func addFileToZip(zipWriter *zip.Writer, fi fileInfo, modified time.Time, progress *packingProgress) error {
+	zipFileHeader := &zip.FileHeader{
+		Name:   fi.relPath,
+		Method: chooseCompressionMethod(fi.path),
+	}
+	zipFileHeader.SetMode(0644)
+	setZipTime(zipFileHeader, modified)
 
 	writer, err := zipWriter.CreateHeader(zipFileHeader)
 	if err != nil {
 		return fmt.Errorf("failed to create zip entry: %w", err)
 	}
 
+	if fi.content != nil {
+		if _, err := writer.Write(fi.content); err != nil {
+			return fmt.Errorf("failed to write file to zip: %w", err)
+		}
+		progress.update(int64(len(fi.content)))
+		return nil
+	}
+
 	file, err := os.Open(fi.path)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
@@ -178,6 +371,32 @@ func addFileToZip(zipWriter *zip.Writer, fi fileInfo, progress *packingProgress)
 	return nil
 }
 
+// setZipTime sets the MS-DOS timestamp of an entry. Unlike the Modified field,
+// it adds no extended timestamp extra field.
+func setZipTime(header *zip.FileHeader, t time.Time) {
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	header.ModifiedDate = uint16(t.Day() + int(t.Month())<<5 + (t.Year()-1980)<<9)
+	header.ModifiedTime = uint16(t.Second()/2 + t.Minute()<<5 + t.Hour()<<11)
+}
+
+// packTimestamp returns the timestamp of the entries of a packed book: the
+// SOURCE_DATE_EPOCH environment variable when set, for reproducible builds,
+// and the start of the MS-DOS epoch otherwise.
+func packTimestamp() (time.Time, error) {
+	epoch := os.Getenv("SOURCE_DATE_EPOCH")
+	if epoch == "" {
+		return time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC), nil
+	}
+
+	seconds, err := strconv.ParseInt(epoch, 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: %w", epoch, err)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
 func chooseCompressionMethod(filePath string) uint16 {
 	ext := strings.ToLower(filepath.Ext(filePath))
 
@@ -229,12 +448,176 @@ func getUniqueFilename(filename string) string {
 	}
 }
 
-func validateFile(path string, info os.FileInfo) error {
-	if info.Size() == 0 {
-		return fmt.Errorf("empty file detected: %s", path)
-	}
-	if strings.Contains(path, "..") {
-		return fmt.Errorf("potential directory traversal detected: %s", path)
+func validateFile(relPath string) error {
+	if slices.Contains(strings.Split(relPath, "/"), "..") {
+		return fmt.Errorf("potential directory traversal detected: %s", relPath)
 	}
 	return nil
 }
+
+var dcLanguageRegex = regexp.MustCompile(`(<dc:language[^>]*>)[^<]*(</dc:language>)`)
+
+// monolingualRewrites returns the content documents and package document of
+// the book at srcDir as they should be packed in mode, keyed by their path
+// relative to srcDir. Only files that change are returned.
+func monolingualRewrites(srcDir, mode, lang string) (map[string][]byte, error) {
+	container, err := loader.ParseContainer(srcDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load EPUB container: %w", err)
+	}
+	packagePath := filepath.Join(srcDir, container.Rootfile.FullPath)
+	pkg, err := loader.ParsePackage(packagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse package: %w", err)
+	}
+	contentDir := filepath.Dir(packagePath)
+
+	documents := make(map[string]*goquery.Document)
+	translated := false
+	for _, item := range pkg.Manifest.Items {
+		if item.MediaType != "application/xhtml+xml" {
+			continue
+		}
+
+		filePath := filepath.Join(contentDir, item.Href)
+		doc, err := util.OpenAndReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open and read file: %w", err)
+		}
+
+		marked := false
+		doc.Find("[" + util.ContentIdKey + "]").Each(func(i int, source *goquery.Selection) {
+			marked = true
+			translation := segment.Translation(doc.Selection, source)
+			if translation != nil {
+				translated = true
+				if lang == "" && mode == packModeTargetOnly {
+					lang, _ = translation.Attr(util.TranslationLangKey)
+				}
+			}
+
+			switch {
+			case translation == nil:
+				// Untranslated elements are kept in both modes
+			case mode == packModeTargetOnly:
+				source.Remove()
+			default:
+				translation.Remove()
+			}
+		})
+		if !marked {
+			continue
+		}
+
+		// Translations whose source element is gone are dropped as well in source-only books
+		if mode == packModeSourceOnly {
+			doc.Find("[" + util.TranslationIdKey + "]").Remove()
+		}
+		doc.Find("[" + util.ContentIdKey + "], [" + util.TranslationIdKey + "]").Each(func(i int, s *goquery.Selection) {
+			for _, attr := range []string{util.ContentIdKey, util.TranslationByIdKey, util.TranslationIdKey, util.TranslationLangKey, util.TranslationStateKey} {
+				s.RemoveAttr(attr)
+			}
+		})
+
+		documents[filePath] = doc
+	}
+
+	if mode == packModeTargetOnly && !translated {
+		return nil, fmt.Errorf("no translated content found in %s, run translate first", srcDir)
+	}
+
+	langCode := util.LanguageCode(lang)
+	rewrites := make(map[string][]byte, len(documents)+1)
+	for filePath, doc := range documents {
+		if langCode != "" {
+			doc.Find("html").SetAttr("lang", langCode).SetAttr("xml:lang", langCode)
+		}
+
+		content, err := doc.Html()
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", filePath, err)
+		}
+		relPath, err := filepath.Rel(srcDir, filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get relative path: %w", err)
+		}
+		rewrites[filepath.ToSlash(relPath)] = []byte(content)
+	}
+
+	if langCode != "" {
+		packageContent, err := os.ReadFile(packagePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read package: %w", err)
+		}
+		relPath, err := filepath.Rel(srcDir, packagePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get relative path: %w", err)
+		}
+		rewrites[filepath.ToSlash(relPath)] = dcLanguageRegex.ReplaceAll(packageContent, []byte("${1}"+langCode+"${2}"))
+	}
+
+	return rewrites, nil
+}
+
+// metadataRewrites adds to rewrites the package, NCX and navigation documents
+// of the book at srcDir with their translated texts: next to the originals in
+// bilingual mode, in place of them in target-only mode. Documents already in
+// rewrites are rewritten further.
+func metadataRewrites(srcDir, mode string, rewrites map[string][]byte) (map[string][]byte, error) {
+	translations, err := metadata.Load(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(translations.Strings) == 0 {
+		return rewrites, nil
+	}
+
+	docs, err := metadata.Locate(srcDir)
+	if err != nil {
+		return nil, err
+	}
+
+	render := func(field metadata.Field, text string) string {
+		translation := translations.Strings[text]
+		switch {
+		case translation == "" || translation == text:
+			return ""
+		case mode == packModeTargetOnly:
+			return translation
+		case field == metadata.FieldDescription:
+			return text + "\n\n" + translation
+		default:
+			return text + " / " + translation
+		}
+	}
+
+	for _, doc := range []struct {
+		file    string
+		rewrite func([]byte, func(metadata.Field, string) string) []byte
+	}{
+		{docs.Package, metadata.RewritePackage},
+		{docs.NCX, metadata.RewriteNCX},
+		{docs.Nav, metadata.RewriteNav},
+	} {
+		if doc.file == "" {
+			continue
+		}
+
+		content, ok := rewrites[doc.file]
+		if !ok {
+			content, err = os.ReadFile(filepath.Join(srcDir, filepath.FromSlash(doc.file)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", doc.file, err)
+			}
+		}
+
+		if rewritten := doc.rewrite(content, render); !bytes.Equal(rewritten, content) {
+			if rewrites == nil {
+				rewrites = make(map[string][]byte)
+			}
+			rewrites[doc.file] = rewritten
+		}
+	}
+
+	return rewrites, nil
+}
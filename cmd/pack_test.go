@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// readZipEntry returns the content of one entry of a packed book.
+func readZipEntry(t *testing.T, epubPath, name string) string {
+	t.Helper()
+
+	r, err := zip.OpenReader(epubPath)
+	if err != nil {
+		t.Fatalf("open packed epub: %v", err)
+	}
+	defer r.Close()
+
+	f, err := r.Open(name)
+	if err != nil {
+		t.Fatalf("open %s: %v", name, err)
+	}
+	defer f.Close()
+
+	content, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatalf("read %s: %v", name, err)
+	}
+	return string(content)
+}
+
+func TestPackMonolingualModes(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--provider-option", "drop_every=1", "--cache-dir", t.TempDir())
+
+	targetPath := filepath.Join(t.TempDir(), "target.epub")
+	runCommand(t, "pack", unpackedPath, "--mode", "target-only", "--output", targetPath)
+
+	chapter := readZipEntry(t, targetPath, "OEBPS/chapter1.xhtml")
+	for _, want := range []string{
+		`<html xmlns="http://www.w3.org/1999/xhtml" lang="vi" xml:lang="vi">`,
+		translator.PseudoLocalize("It was a bright cold day in April."),
+		// The mock dropped this element, so it stays in the source language
+		"Nobody noticed &amp; nobody cared.",
+	} {
+		if !strings.Contains(chapter, want) {
+			t.Errorf("target-only chapter is missing %s\n%s", want, chapter)
+		}
+	}
+	for _, unwanted := range []string{"It was a bright cold day in April.", util.ContentIdKey, "data-translation"} {
+		if strings.Contains(chapter, unwanted) {
+			t.Errorf("target-only chapter still contains %s\n%s", unwanted, chapter)
+		}
+	}
+	if opf := readZipEntry(t, targetPath, "OEBPS/package.opf"); !strings.Contains(opf, "<dc:language>vi</dc:language>") {
+		t.Errorf("target-only package language was not updated\n%s", opf)
+	}
+
+	sourcePath := filepath.Join(t.TempDir(), "source.epub")
+	runCommand(t, "pack", unpackedPath, "--mode", "source-only", "--output", sourcePath)
+
+	chapter = readZipEntry(t, sourcePath, "OEBPS/chapter1.xhtml")
+	if !strings.Contains(chapter, "It was a bright cold day in April.") {
+		t.Errorf("source-only chapter lost its source text\n%s", chapter)
+	}
+	for _, unwanted := range []string{translator.PseudoLocalize("It was a bright cold day in April."), util.ContentIdKey, "data-translation", `lang="vi"`} {
+		if strings.Contains(chapter, unwanted) {
+			t.Errorf("source-only chapter still contains %s\n%s", unwanted, chapter)
+		}
+	}
+	if opf := readZipEntry(t, sourcePath, "OEBPS/package.opf"); !strings.Contains(opf, "<dc:language>en</dc:language>") {
+		t.Errorf("source-only package language changed\n%s", opf)
+	}
+
+	// The unpacked book keeps both languages
+	doc, err := util.OpenAndReadFile(filepath.Join(unpackedPath, "OEBPS", "chapter1.xhtml"))
+	if err != nil {
+		t.Fatalf("read unpacked chapter: %v", err)
+	}
+	if got := doc.Find("[" + util.TranslationIdKey + "]").Length(); got != 3 {
+		t.Errorf("expected 3 translations left in the unpacked chapter, got %d", got)
+	}
+}
+
+func TestPackWritesOCFContainer(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--cache-dir", t.TempDir())
+
+	extraFiles := map[string]string{
+		"OEBPS/chapter1.xhtml.debug.txt":      "debug",
+		"META-INF/summaries.json":             "{}",
+		"META-INF/metadata-translations.json": "{}",
+		"OEBPS/empty.css":                     "",
+		"OEBPS/drafts/notes.txt":              "draft",
+	}
+	for name, content := range extraFiles {
+		filePath := filepath.Join(unpackedPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	first := filepath.Join(t.TempDir(), "first.epub")
+	runCommand(t, "pack", unpackedPath, "--output", first, "--exclude", "drafts")
+	second := filepath.Join(t.TempDir(), "second.epub")
+	runCommand(t, "pack", unpackedPath, "--output", second, "--exclude", "drafts")
+
+	firstBytes, err := os.ReadFile(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondBytes, err := os.ReadFile(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(firstBytes, secondBytes) {
+		t.Errorf("packing the same book twice gave different archives")
+	}
+
+	// The first local file header: stored mimetype without extra field or data descriptor
+	if got := binary.LittleEndian.Uint16(firstBytes[6:]); got != 0 {
+		t.Errorf("mimetype flags = %#x, want 0", got)
+	}
+	if got := binary.LittleEndian.Uint16(firstBytes[8:]); got != zip.Store {
+		t.Errorf("mimetype method = %d, want stored", got)
+	}
+	if got := binary.LittleEndian.Uint16(firstBytes[28:]); got != 0 {
+		t.Errorf("mimetype extra field length = %d, want 0", got)
+	}
+	if got := string(firstBytes[30:58]); got != "mimetypeapplication/epub+zip" {
+		t.Errorf("first entry = %q, want the mimetype", got)
+	}
+
+	r, err := zip.OpenReader(first)
+	if err != nil {
+		t.Fatalf("open packed epub: %v", err)
+	}
+	defer r.Close()
+
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	want := []string{
+		"mimetype",
+		"META-INF/container.xml",
+		"OEBPS/chapter1.xhtml",
+		"OEBPS/chapter2.xhtml",
+		"OEBPS/empty.css",
+		"OEBPS/package.opf",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("entries = %v, want %v", names, want)
+	}
+}
+
+func TestPackTranslatedMetadata(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	nav := `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><head><title>Contents</title></head><body>
+<nav epub:type="toc"><ol><li><a href="chapter1.xhtml">Chapter One</a></li><li><a href="chapter2.xhtml">Chapter Two</a></li></ol></nav>
+</body></html>`
+	if err := os.WriteFile(filepath.Join(unpackedPath, "OEBPS", "nav.xhtml"), []byte(nav), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opfPath := filepath.Join(unpackedPath, "OEBPS", "package.opf")
+	opf, err := os.ReadFile(opfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf = bytes.Replace(opf, []byte("<manifest>"), []byte(`<manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`), 1)
+	if err := os.WriteFile(opfPath, opf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--metadata", "--cache-dir", t.TempDir())
+
+	title, chapterOne := translator.PseudoLocalize("Test Book"), translator.PseudoLocalize("Chapter One")
+
+	bilingualPath := filepath.Join(t.TempDir(), "bilingual.epub")
+	runCommand(t, "pack", unpackedPath, "--output", bilingualPath)
+	if got := readZipEntry(t, bilingualPath, "OEBPS/package.opf"); !strings.Contains(got, "<dc:title>Test Book / "+title+"</dc:title>") {
+		t.Errorf("bilingual package does not have both titles\n%s", got)
+	}
+	if got := readZipEntry(t, bilingualPath, "OEBPS/nav.xhtml"); !strings.Contains(got, `<a href="chapter1.xhtml">Chapter One / `+chapterOne+`</a>`) {
+		t.Errorf("bilingual navigation does not have both labels\n%s", got)
+	}
+
+	targetPath := filepath.Join(t.TempDir(), "target.epub")
+	runCommand(t, "pack", unpackedPath, "--mode", "target-only", "--output", targetPath)
+	got := readZipEntry(t, targetPath, "OEBPS/package.opf")
+	for _, want := range []string{"<dc:title>" + title + "</dc:title>", "<dc:language>vi</dc:language>"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("target-only package does not contain %s\n%s", want, got)
+		}
+	}
+	if got := readZipEntry(t, targetPath, "OEBPS/nav.xhtml"); !strings.Contains(got, `<a href="chapter1.xhtml">`+chapterOne+`</a>`) {
+		t.Errorf("target-only navigation is not translated\n%s", got)
+	}
+
+	sourcePath := filepath.Join(t.TempDir(), "source.epub")
+	runCommand(t, "pack", unpackedPath, "--mode", "source-only", "--output", sourcePath)
+	if got := readZipEntry(t, sourcePath, "OEBPS/package.opf"); !strings.Contains(got, "<dc:title>Test Book</dc:title>") {
+		t.Errorf("source-only package title changed\n%s", got)
+	}
+}
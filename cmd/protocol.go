@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+)
+
+// Batch protocols: how the segments of a batch are sent to the translator and
+// matched back to their elements.
+const (
+	protocolAuto = "auto"
+	protocolJSON = "json"
+	protocolTags = "tags"
+)
+
+// resolveProtocol returns the protocol to use with t. Auto picks JSON when the
+// provider can constrain its response to JSON, and tags otherwise.
+func resolveProtocol(protocol string, t translator.Translator) (string, error) {
+	switch protocol {
+	case protocolJSON, protocolTags:
+		return protocol, nil
+	case protocolAuto:
+		if translator.SupportsJSON(t) {
+			return protocolJSON, nil
+		}
+		return protocolTags, nil
+	default:
+		return "", fmt.Errorf("unknown protocol %q, use json, tags or auto", protocol)
+	}
+}
+
+// batchPrompt combines the elements of batch into one request in protocol.
+func batchPrompt(protocol string, batch translationBatch) (string, error) {
+	if protocol == protocolJSON {
+		return buildJSONBatchPrompt(batch)
+	}
+	return buildBatchPrompt(batch), nil
+}
+
+// buildBatchPrompt combines the elements of batch into one request with
+// numbered segment markers.
+func buildBatchPrompt(batch translationBatch) string {
+	var combinedContent strings.Builder
+	combinedContent.WriteString("Translate the following HTML segments. Each segment is marked with BEGIN_SEGMENT_X and END_SEGMENT_X markers. Preserve these markers exactly in your response and maintain all HTML tags.\n\n")
+
+	for i, element := range batch.elements {
+		combinedContent.WriteString(fmt.Sprintf("<SEGMENT_%d>\n%s\n</SEGMENT_%d>\n\n", i, element.content, i))
+	}
+
+	return combinedContent.String()
+}
+
+// buildJSONBatchPrompt combines the elements of batch into one request with a
+// JSON object of segments keyed by content ID.
+func buildJSONBatchPrompt(batch translationBatch) (string, error) {
+	request := translator.JSONBatch{Segments: make([]translator.JSONSegment, len(batch.elements))}
+	for i, element := range batch.elements {
+		request.Segments[i] = translator.JSONSegment{ID: element.contentID, Text: element.content}
+	}
+
+	body, err := translator.MarshalJSONBatch(request)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode batch: %w", err)
+	}
+
+	return "Translate the HTML text of every segment in the following JSON object. Reply with a JSON object of the same shape only: " +
+		`a "segments" array with one object per source segment, its "id" copied unchanged and its "text" translated with all HTML tags preserved. ` +
+		"Do not merge, split, add or drop segments.\n\n" + body, nil
+}
+
+// repairPrompt asks again for the translation of the single element of batch,
+// showing the rejected translation and why it was rejected.
+func repairPrompt(protocol string, batch translationBatch, rejected, problem string) (string, error) {
+	request, err := batchPrompt(protocol, batch)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("A previous translation of the segment below was rejected because %s:\n\n%s\n\n", problem, rejected) +
+		"Translate the segment again, keeping exactly the HTML tags of the source in the same order.\n\n" + request, nil
+}
+
+// parseBatchResponse matches the segments of a response in protocol to the
+// elements of batch. It returns one translation per element, empty when the
+// response has no valid segment for it, and what was wrong with the response.
+func parseBatchResponse(protocol, response string, batch translationBatch) ([]string, []string) {
+	if protocol == protocolJSON {
+		contentIDs := make([]string, len(batch.elements))
+		for i, element := range batch.elements {
+			contentIDs[i] = element.contentID
+		}
+		return parseJSONTranslations(response, contentIDs)
+	}
+	return splitTranslations(response, len(batch.elements))
+}
+
+// parseJSONTranslations matches the segments of a JSON response to ids by ID.
+// Segments with an unknown ID are left out, as are both answers of a segment
+// answered twice.
+func parseJSONTranslations(response string, ids []string) ([]string, []string) {
+	translations := make([]string, len(ids))
+
+	batch, err := translator.ParseJSONBatch(response)
+	if err != nil {
+		return translations, []string{err.Error()}
+	}
+
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	var problems []string
+	answers := make(map[string]int, len(ids))
+	for _, segment := range batch.Segments {
+		i, ok := index[segment.ID]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown segment id %q", segment.ID))
+			continue
+		}
+		answers[segment.ID]++
+		translations[i] = strings.TrimSpace(segment.Text)
+	}
+
+	return translations, append(problems, checkAnswers(ids, answers, translations)...)
+}
+
+// segmentMarkerRegex matches a segment of the tag protocol, capturing the
+// index of its opening marker, its content and the index of its closing marker
+var segmentMarkerRegex = regexp.MustCompile(`(?s)<SEGMENT_(\d+)>(.*?)</SEGMENT_(\d+)>`)
+
+// splitTranslations matches the segments of a tag protocol response to count
+// segments by index. Segments whose markers disagree or whose index is out of
+// range are left out, as are both answers of a segment answered twice.
+func splitTranslations(translatedContent string, count int) ([]string, []string) {
+	translations := make([]string, count)
+	ids := make([]string, count)
+	for i := range ids {
+		ids[i] = strconv.Itoa(i)
+	}
+
+	var problems []string
+	answers := make(map[string]int, count)
+	for _, match := range segmentMarkerRegex.FindAllStringSubmatch(translatedContent, -1) {
+		if match[1] != match[3] {
+			problems = append(problems, fmt.Sprintf("segment %s is closed as segment %s", match[1], match[3]))
+			continue
+		}
+		i, err := strconv.Atoi(match[1])
+		if err != nil || i >= count {
+			problems = append(problems, fmt.Sprintf("unknown segment %s", match[1]))
+			continue
+		}
+		answers[ids[i]]++
+		translations[i] = strings.TrimSpace(match[2])
+	}
+
+	return translations, append(problems, checkAnswers(ids, answers, translations)...)
+}
+
+// checkAnswers reports the segments that were not answered exactly once,
+// clearing the translations of those answered more than once since it is not
+// known which answer belongs to them.
+func checkAnswers(ids []string, answers map[string]int, translations []string) []string {
+	var problems []string
+	for i, id := range ids {
+		switch {
+		case answers[id] == 0:
+			problems = append(problems, fmt.Sprintf("segment %s is missing", id))
+		case answers[id] > 1:
+			problems = append(problems, fmt.Sprintf("segment %s is answered %d times", id, answers[id]))
+			translations[i] = ""
+		case translations[i] == "":
+			problems = append(problems, fmt.Sprintf("segment %s is empty", id))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitTranslations(t *testing.T) {
+	response := "<SEGMENT_1>\nOne\n</SEGMENT_1>\n<SEGMENT_0>\nZero\n</SEGMENT_0>\n" +
+		"<SEGMENT_2>Two</SEGMENT_3>\n<SEGMENT_3>Three</SEGMENT_3>\n<SEGMENT_9>Nine</SEGMENT_9>\n<SEGMENT_3>Again</SEGMENT_3>"
+
+	translations, problems := splitTranslations(response, 5)
+
+	if want := []string{"Zero", "One", "", "", ""}; !slices.Equal(translations, want) {
+		t.Errorf("translations = %q, want %q", translations, want)
+	}
+	wantProblems := []string{
+		"segment 2 is closed as segment 3",
+		"unknown segment 9",
+		"segment 2 is missing",
+		"segment 3 is answered 2 times",
+		"segment 4 is missing",
+	}
+	if !slices.Equal(problems, wantProblems) {
+		t.Errorf("problems = %q, want %q", problems, wantProblems)
+	}
+}
+
+func TestParseJSONTranslations(t *testing.T) {
+	response := "Here is the translation:\n```json\n" + `{"segments": [
+  {"id": "b", "text": " <i>Bee</i> "},
+  {"id": "a", "text": "Ay"},
+  {"id": "z", "text": "Zed"},
+  {"id": "c", "text": "See"},
+  {"id": "c", "text": "Sea"},
+  {"id": "d", "text": ""}
+]}` + "\n```"
+
+	translations, problems := parseJSONTranslations(response, []string{"a", "b", "c", "d", "e"})
+
+	if want := []string{"Ay", "<i>Bee</i>", "", "", ""}; !slices.Equal(translations, want) {
+		t.Errorf("translations = %q, want %q", translations, want)
+	}
+	wantProblems := []string{
+		`unknown segment id "z"`,
+		"segment c is answered 2 times",
+		"segment d is empty",
+		"segment e is missing",
+	}
+	if !slices.Equal(problems, wantProblems) {
+		t.Errorf("problems = %q, want %q", problems, wantProblems)
+	}
+
+	if _, problems := parseJSONTranslations("Sorry, I cannot help.", []string{"a"}); len(problems) != 1 {
+		t.Errorf("problems for a response without JSON = %q, want one", problems)
+	}
+}
@@ -21,4 +21,12 @@ func init() {
 	Root.AddCommand(Styling)
 	Root.AddCommand(Upgrade)
 	Root.AddCommand(Prepare)
+	Root.AddCommand(Cache)
+	Root.AddCommand(Status)
+	Root.AddCommand(Estimate)
+	Root.AddCommand(Glossary)
+	Root.AddCommand(TM)
+	Root.AddCommand(Export)
+	Root.AddCommand(Import)
+	Root.AddCommand(Validate)
 }
@@ -14,12 +14,12 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"embed"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/gofiber/fiber/v2"
-	"github.com/liushuangls/go-anthropic/v2"
 	"github.com/nguyenvanduocit/epubtrans/pkg/loader"
 	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
 	"github.com/nguyenvanduocit/epubtrans/pkg/util"
@@ -48,6 +48,8 @@ var Serve = &cobra.Command{
 func init() {
 	// port flag
 	Serve.Flags().StringP("port", "p", "3000", "port to serve the EPUB content")
+	Serve.Flags().String("provider", "anthropic", fmt.Sprintf("translation provider used by the AI translate button %v", translator.Providers()))
+	Serve.Flags().String("model", "", "model to use, defaults to the provider's recommended model")
 }
 
 var ToInjectContentTypes = []string{
@@ -131,23 +133,12 @@ type TranslateAIRequest struct {
     Instructions  string `json:"instructions"`
 }
 
-// Add this function to call the AI translation service (you'll need to implement this)
-func translateWithAI(content string, instructions string, bookTitle string) (string, error) {
+// translateWithAI translates a single element with the translator resolved for this server
+func translateWithAI(aiTranslator translator.Translator, content string, instructions string, bookTitle string) (string, error) {
     ctx := context.Background()
 
-    // Create an Anthropic translator
-    anthropicTranslator, err := translator.GetAnthropicTranslator(&translator.Config{
-        APIKey:      os.Getenv("ANTHROPIC_KEY"),
-        Model:       string(anthropic.ModelClaude3Dot5SonnetLatest), // You might want to make this configurable
-        Temperature: 0.7,
-        MaxTokens:   8192,
-    })
-    if err != nil {
-        return "", fmt.Errorf("error getting translator: %v", err)
-    }
-
     // Translate the content
-    translatedContent, err := anthropicTranslator.Translate(ctx, instructions, content, "english", "vietnamese", bookTitle)
+    translatedContent, err := aiTranslator.Translate(ctx, instructions, content, "english", "vietnamese", bookTitle)
     if err != nil {
         return "", fmt.Errorf("translation error: %v", err)
     }
@@ -178,6 +169,33 @@ func runServe(cmd *cobra.Command, args []string) error {
 	// Get the book title
 	bookTitle := pkg.Metadata.Title
 
+	provider := cmd.Flag("provider").Value.String()
+	model := cmd.Flag("model").Value.String()
+
+	// Resolved on first use so the server starts without provider credentials,
+	// and tried again on the next request until it succeeds
+	var translatorMu sync.Mutex
+	var bookTranslator translator.Translator
+	getTranslator := func() (translator.Translator, error) {
+		translatorMu.Lock()
+		defer translatorMu.Unlock()
+
+		if bookTranslator != nil {
+			return bookTranslator, nil
+		}
+		t, err := translator.New(provider, &translator.Config{
+			Model:       model,
+			Temperature: 0.7,
+			MaxTokens:   8192,
+			DataDir:     filepath.Join(unpackedEpubPath, "META-INF"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		bookTranslator = t
+		return bookTranslator, nil
+	}
+
 	slog.Info("Book title: " + bookTitle)
 
 	app := fiber.New(fiber.Config{
@@ -429,7 +447,12 @@ func runServe(cmd *cobra.Command, args []string) error {
 			instructment = fmt.Sprintf("Previous translation:\n\n%s\n\n%s", currentTranslatedContent, instructment)
 		}
 
-		translatedContent, err := translateWithAI(originalContent, instructment, bookTitle)
+		aiTranslator, err := getTranslator()
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": fmt.Sprintf("error getting translator: %v", err)})
+		}
+
+		translatedContent, err := translateWithAI(aiTranslator, originalContent, instructment, bookTitle)
         if err != nil {
             return c.Status(500).JSON(fiber.Map{"error": "Translation failed"})
         }
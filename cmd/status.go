@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/journal"
+	"github.com/nguyenvanduocit/epubtrans/pkg/processor"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+	"github.com/spf13/cobra"
+)
+
+var Status = &cobra.Command{
+	Use:   "status [unpackedEpubPath]",
+	Short: "Show the translation progress of an unpacked EPUB file",
+	Long: `This command reports, per chapter, how many marked segments are translated, failed or pending,
+using the translated content on disk and the translation journal written by translate.
+Failed, pending and untranslated segments can be translated with "epubtrans translate --resume".`,
+	Example: "epubtrans status path/to/unpacked/epub",
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("unpackedEpubPath is required. Please provide the path to the unpacked EPUB directory.")
+		}
+
+		return util.ValidateEpubPath(args[0])
+	},
+	RunE: runStatus,
+}
+
+// chapterStatus counts the segments of one content document by state.
+type chapterStatus struct {
+	file         string
+	segments     int
+	translated   int
+	failed       int
+	pending      int
+	untranslated int
+}
+
+func runStatus(cmd *cobra.Command, args []string) error {
+	unzipPath := args[0]
+
+	translationJournal, err := journal.Open(unzipPath)
+	if err != nil {
+		return err
+	}
+	segments := translationJournal.Segments()
+
+	files, _, err := processor.ContentFiles(unzipPath)
+	if err != nil {
+		return err
+	}
+
+	var chapters []chapterStatus
+	var total chapterStatus
+	for _, filePath := range files {
+		doc, err := util.OpenAndReadFile(filePath)
+		if err != nil {
+			return fmt.Errorf("failed to open and read file: %w", err)
+		}
+
+		chapter := chapterStatus{file: filePath}
+		if rel, err := filepath.Rel(unzipPath, filePath); err == nil {
+			chapter.file = filepath.ToSlash(rel)
+		}
+
+		doc.Find("[" + util.ContentIdKey + "]").Each(func(i int, s *goquery.Selection) {
+			chapter.segments++
+			if _, ok := s.Attr(util.TranslationByIdKey); ok {
+				chapter.translated++
+				return
+			}
+
+			contentID, _ := s.Attr(util.ContentIdKey)
+			switch segments[contentID].Status {
+			case journal.StatusFailed:
+				chapter.failed++
+			case journal.StatusPending:
+				chapter.pending++
+			default:
+				chapter.untranslated++
+			}
+		})
+
+		total.segments += chapter.segments
+		total.translated += chapter.translated
+		total.failed += chapter.failed
+		total.pending += chapter.pending
+		total.untranslated += chapter.untranslated
+		chapters = append(chapters, chapter)
+	}
+
+	out := cmd.OutOrStdout()
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CHAPTER\tSEGMENTS\tTRANSLATED\tFAILED\tPENDING\tUNTRANSLATED")
+	for _, chapter := range chapters {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\n", chapter.file, chapter.segments, chapter.translated, chapter.failed, chapter.pending, chapter.untranslated)
+	}
+	fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%d\t%d\n", total.segments, total.translated, total.failed, total.pending, total.untranslated)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if !journal.Exists(unzipPath) {
+		fmt.Fprintln(out, "\nNo translation journal yet, run translate to start one.")
+		return nil
+	}
+
+	run := translationJournal.Run()
+	inputTokens, outputTokens, cost := translationJournal.Totals()
+	fmt.Fprintf(out, "\nLast run: %s/%s, %s to %s, started %s\n", run.Provider, run.Model, run.Source, run.Target, run.StartedAt.Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(out, "Spent: %d input tokens, %d output tokens, $%.4f\n", inputTokens, outputTokens, cost)
+
+	var failedBatches []journal.Batch
+	for _, batch := range translationJournal.Batches() {
+		if batch.Status == journal.StatusFailed {
+			failedBatches = append(failedBatches, batch)
+		}
+	}
+	if len(failedBatches) > 0 {
+		fmt.Fprintln(out, "\nFailed batches:")
+		for _, batch := range failedBatches {
+			fmt.Fprintf(out, "  %s %s (%d segments, %d attempts): %s\n", batch.ID, batch.File, len(batch.ContentIDs), batch.Attempts, batch.Error)
+		}
+	}
+
+	if remaining := total.failed + total.pending + total.untranslated; remaining > 0 {
+		fmt.Fprintf(out, "\nRun \"epubtrans translate %s --resume\" to retry or translate %d failed, pending and untranslated segments.\n", unzipPath, remaining)
+	}
+
+	return nil
+}
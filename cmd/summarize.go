@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/budget"
+	"github.com/nguyenvanduocit/epubtrans/pkg/ratelimit"
+	"github.com/nguyenvanduocit/epubtrans/pkg/summary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// maxSummaryInputTokens bounds the chapter text sent for one summary
+const maxSummaryInputTokens = 8000
+
+// chapterSummarizer generates the missing summaries of a book in reading
+// order, each with the running summary of the chapters before it.
+type chapterSummarizer struct {
+	completer translator.Completer
+	limiter   *ratelimit.Limiter
+	budget    *budget.Tracker
+	provider  string
+	model     string
+	bookName  string
+	unzipPath string
+}
+
+// summarize adds a summary for every file of files that has none yet, saving
+// after each one so an interrupted pre-pass keeps its work.
+func (s *chapterSummarizer) summarize(ctx context.Context, summaries *summary.Summaries, files []string) error {
+	order := bookRelativePaths(s.unzipPath, files)
+
+	generated := 0
+	for i, filePath := range files {
+		if _, ok := summaries.Get(order[i]); ok {
+			continue
+		}
+
+		text, err := chapterText(filePath)
+		if err != nil {
+			return err
+		}
+		if text == "" {
+			continue
+		}
+
+		fmt.Printf("Summarizing %s\n", order[i])
+		response, err := s.complete(ctx, summaryPrompt(summaries.Prompt(order[i], order), text))
+		if errors.Is(err, budget.ErrExceeded) {
+			fmt.Printf("Stopped summarizing: %v\n", err)
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to summarize %s: %w", order[i], err)
+		}
+
+		summaries.Set(summary.Parse(order[i], response), order)
+		if err := summaries.Save(); err != nil {
+			return err
+		}
+		generated++
+	}
+
+	fmt.Printf("Generated %d chapter summaries in %s\n", generated, summary.FileName)
+	return nil
+}
+
+// complete sends prompt within the rate limit and the budget, committing its
+// actual usage.
+func (s *chapterSummarizer) complete(ctx context.Context, prompt string) (string, error) {
+	system := summarySystem(s.bookName)
+	inputTokens := translator.EstimateTokens(system + prompt)
+	if err := s.limiter.Wait(ctx, int(inputTokens)); err != nil {
+		return "", fmt.Errorf("rate limiter error: %w", err)
+	}
+
+	// Summaries are short, a fraction of the chapter is plenty
+	estimate := budget.Spend{InputTokens: int(inputTokens), OutputTokens: int(inputTokens / 4)}
+	estimate.Cost = translator.Usage{InputTokens: estimate.InputTokens, OutputTokens: estimate.OutputTokens}.Cost(s.model)
+	if s.budget != nil {
+		if err := s.budget.Reserve(estimate); err != nil {
+			return "", err
+		}
+	}
+
+	usage := &translator.Usage{}
+	response, err := s.completer.Complete(translator.ContextWithUsage(ctx, usage), system, prompt)
+
+	if s.budget != nil {
+		actual := budget.Spend{InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens, Cost: usage.Cost(s.model)}
+		if err := s.budget.Commit(estimate, actual, s.provider+"/"+s.model); err != nil {
+			fmt.Printf("Warning: failed to update spend record: %v\n", err)
+		}
+	}
+
+	return response, err
+}
+
+// summarySystem is the system prompt of a summary request.
+func summarySystem(bookName string) string {
+	return fmt.Sprintf("You are preparing the translation of the book %q from %s to %s. "+
+		"You summarize its chapters so that character names, honorifics, terms and plot references stay consistent across the whole translation.",
+		bookName, sourceLanguage, targetLanguage)
+}
+
+// summaryPrompt asks for the summary of a chapter of text, given the running
+// summary of the chapters before it.
+func summaryPrompt(running, text string) string {
+	var b strings.Builder
+	if running != "" {
+		b.WriteString(running)
+		b.WriteString("\n\n")
+	}
+	b.WriteString("Summarize the chapter below in at most five sentences. Then list the characters, places and recurring terms that appear in it, " +
+		"each with a short note: who or what it is and, for people, how they are addressed. Use the same names as in the earlier chapters. " +
+		`Reply with a JSON object only: {"summary": "...", "terms": [{"name": "...", "note": "..."}]}` + "\n\nCHAPTER:\n")
+	b.WriteString(text)
+	return b.String()
+}
+
+// chapterText returns the plain text of the marked elements of the document
+// at filePath, or of its body if it is not marked, up to maxSummaryInputTokens.
+func chapterText(filePath string) (string, error) {
+	doc, err := util.OpenAndReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open and read file: %w", err)
+	}
+
+	elements := doc.Find("[" + util.ContentIdKey + "]")
+	if elements.Length() == 0 {
+		elements = doc.Find("body")
+	}
+
+	var b strings.Builder
+	var tokens float32
+	elements.EachWithBreak(func(i int, s *goquery.Selection) bool {
+		text := strings.Join(strings.Fields(s.Text()), " ")
+		tokens += translator.EstimateTokens(text)
+		if tokens > maxSummaryInputTokens && b.Len() > 0 {
+			return false
+		}
+		if text != "" {
+			b.WriteString(text)
+			b.WriteString("\n")
+		}
+		return true
+	})
+
+	return strings.TrimSpace(b.String()), nil
+}
+
+// bookRelativePath returns filePath relative to the unpacked book, with
+// forward slashes, or filePath itself if it is outside the book.
+func bookRelativePath(unzipPath, filePath string) string {
+	rel, err := filepath.Rel(unzipPath, filePath)
+	if err != nil {
+		return filePath
+	}
+	return filepath.ToSlash(rel)
+}
+
+// bookRelativePaths returns bookRelativePath of each of files.
+func bookRelativePaths(unzipPath string, files []string) []string {
+	paths := make([]string, len(files))
+	for i, filePath := range files {
+		paths[i] = bookRelativePath(unzipPath, filePath)
+	}
+	return paths
+}
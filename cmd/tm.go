@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/tm"
+	"github.com/spf13/cobra"
+)
+
+var TM = &cobra.Command{
+	Use:   "tm",
+	Short: "Manage the translation memory",
+	Long:  "The translate command stores every committed translation in a local translation memory shared by all books. Exact matches are reused without a request and close matches are offered to the model as examples. These commands exchange the memory with other tools as TMX 1.4.",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return cmd.Help()
+	},
+}
+
+var tmImport = &cobra.Command{
+	Use:     "import [file.tmx]",
+	Short:   "Import translation units from a TMX file",
+	Example: "epubtrans tm import series.tmx",
+	Args:    cobra.ExactArgs(1),
+	RunE:    runTMImport,
+}
+
+var tmExport = &cobra.Command{
+	Use:     "export",
+	Short:   "Export the translation memory as TMX",
+	Example: "epubtrans tm export -o series.tmx",
+	Args:    cobra.NoArgs,
+	RunE:    runTMExport,
+}
+
+func init() {
+	TM.PersistentFlags().String("tm", "", "translation memory file (default is memory.jsonl in the user config directory)")
+
+	tmExport.Flags().StringP("output", "o", "", "output file path (default is stdout)")
+
+	TM.AddCommand(tmImport)
+	TM.AddCommand(tmExport)
+}
+
+func runTMImport(cmd *cobra.Command, args []string) error {
+	memory, err := openTranslationMemory(cmd.Flag("tm").Value.String())
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to open TMX file: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := tm.ReadTMX(f)
+	if err != nil {
+		return err
+	}
+
+	before := memory.Len()
+	for _, entry := range entries {
+		if err := memory.Add(entry); err != nil {
+			return err
+		}
+	}
+
+	cmd.Printf("Imported %d translation units into %s (%d new)\n", len(entries), memory.Path(), memory.Len()-before)
+	return nil
+}
+
+func runTMExport(cmd *cobra.Command, args []string) error {
+	memory, err := openTranslationMemory(cmd.Flag("tm").Value.String())
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if outputPath, _ := cmd.Flags().GetString("output"); outputPath != "" {
+		f, err := os.Create(outputPath)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	entries := memory.Entries()
+	if err := tm.WriteTMX(out, entries); err != nil {
+		return err
+	}
+
+	cmd.PrintErrf("Exported %d translation units\n", len(entries))
+	return nil
+}
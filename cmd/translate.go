@@ -9,19 +9,25 @@ import (
 	"os"
 	"os/signal"
 	"path"
+	"slices"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/budget"
 	"github.com/nguyenvanduocit/epubtrans/pkg/editor"
+	"github.com/nguyenvanduocit/epubtrans/pkg/glossary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/journal"
 	"github.com/nguyenvanduocit/epubtrans/pkg/loader"
 	"github.com/nguyenvanduocit/epubtrans/pkg/processor"
+	"github.com/nguyenvanduocit/epubtrans/pkg/ratelimit"
+	"github.com/nguyenvanduocit/epubtrans/pkg/summary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/tm"
 	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
 	"github.com/nguyenvanduocit/epubtrans/pkg/util"
 	"github.com/spf13/cobra"
-	"golang.org/x/time/rate"
 )
 
 var (
@@ -29,13 +35,18 @@ var (
 	targetLanguage string
 )
 
+// untranslatedSelector matches marked elements that have no translation yet
+var untranslatedSelector = fmt.Sprintf("[%s]:not([%s])", util.ContentIdKey, util.TranslationByIdKey)
+
 var Translate = &cobra.Command{
 	Use:   "translate [unpackedEpubPath]",
 	Short: "Translate the content of an unpacked EPUB file",
-	Long: `This command translates the content of an unpacked EPUB file using the Anthropic API. 
+	Long: `This command translates the content of an unpacked EPUB file using the Anthropic API or an OpenAI-compatible API. 
 It allows you to specify the source and target languages for the translation. 
 Make sure to provide the path to the unpacked EPUB directory and the desired languages.`,
-	Example: `epubtrans translate path/to/unpacked/epub --source "English" --target "Vietnamese"`,
+	Example: `epubtrans translate path/to/unpacked/epub --source "English" --target "Vietnamese"
+epubtrans translate path/to/unpacked/epub --provider openai --model gpt-4o-mini
+epubtrans translate path/to/unpacked/epub --resume`,
 	Args: func(cmd *cobra.Command, args []string) error {
 		if len(args) != 1 {
 			return fmt.Errorf("unpackedEpubPath is required. Please provide the path to the unpacked EPUB directory.")
@@ -49,12 +60,33 @@ Make sure to provide the path to the unpacked EPUB directory and the desired lan
 func init() {
 	Translate.Flags().StringVar(&sourceLanguage, "source", "English", "source language")
 	Translate.Flags().StringVar(&targetLanguage, "target", "Vietnamese", "target language")
-	Translate.Flags().String("model", "claude-3-5-sonnet-20241022", "Anthropic model to use")
+	Translate.Flags().String("provider", "anthropic", fmt.Sprintf("translation provider to use %v", translator.Providers()))
+	Translate.Flags().String("model", "", "model to use, defaults to the provider's recommended model")
+	Translate.Flags().String("base-url", "", "API base URL for OpenAI-compatible or local (ollama, llamacpp) servers")
+	Translate.Flags().StringArray("provider-option", nil, "provider-specific option as key=value, repeatable, e.g. drop_every=3 for the mock provider")
 	Translate.Flags().String("prompt", "technical", "Prompt preset to use")
+	Translate.Flags().String("protocol", protocolAuto, "how batches are sent and matched back: json (segments keyed by content ID), tags (numbered markers) or auto (json when the provider supports JSON output)")
+	Translate.Flags().String("cache-dir", "", "persistent translation cache directory (default is the user cache directory)")
+	Translate.Flags().Bool("no-cache", false, "disable the persistent translation cache")
+	Translate.Flags().Int("concurrency", 1, "number of files and batches translated in parallel")
+	Translate.Flags().Int("rpm", 50, "maximum requests per minute shared by all workers, 0 to disable")
+	Translate.Flags().Int("tpm", 0, "maximum tokens per minute shared by all workers, 0 to disable")
+	Translate.Flags().Bool("resume", false, "continue the run recorded in the translation journal, retrying its failed and pending segments and translating the ones it never reached")
+	Translate.Flags().Float64("max-cost", 0, "stop the run before its spend passes this many US dollars, 0 for no limit")
+	Translate.Flags().Int("max-input-tokens", 0, "stop the run before it sends more input tokens than this, 0 for no limit")
+	Translate.Flags().Int("max-output-tokens", 0, "stop the run before it receives more output tokens than this, 0 for no limit")
+	Translate.Flags().Bool("glossary-strict", false, "do not write translations that violate the glossary, leaving them failed for --resume")
+	Translate.Flags().String("tm", "", "translation memory file (default is memory.jsonl in the user config directory)")
+	Translate.Flags().Bool("no-tm", false, "disable the translation memory")
+	Translate.Flags().Float64("tm-threshold", tm.DefaultThreshold, "minimum similarity of translation memory matches offered as examples")
+	Translate.Flags().Bool("metadata", false, "also translate the book's title, description and table of contents, used by pack")
+	Translate.Flags().Bool("summarize", false, "summarize each chapter and list its characters and terms before translating, to keep them consistent across chapters")
+	Translate.Flags().Int("context-tokens", defaultContextTokens, "tokens of the chapter heading and preceding translations sent as read-only context with each batch, 0 to disable")
 }
 
 type elementToTranslate struct {
 	filePath      string
+	contentID     string
 	contentEl     *goquery.Selection
 	doc           *goquery.Document
 	totalElements int
@@ -97,6 +129,15 @@ func saveGuidelines(unzipPath string, guidelines string) error {
 	return nil
 }
 
+func generateGuidelines(ctx context.Context, bookName string) (string, error) {
+	geminiEditor, err := editor.NewGemini()
+	if err != nil {
+		return "", err
+	}
+
+	return geminiEditor.GenerateGuidelines(ctx, sourceLanguage, targetLanguage, bookName)
+}
+
 func runTranslate(cmd *cobra.Command, args []string) error {
 	unzipPath := args[0]
 	ctx, cancel := context.WithCancel(cmd.Context())
@@ -122,19 +163,63 @@ func runTranslate(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("error extracting book name: %v", err)
 	}
 
-	// Kiểm tra model flag
+	resume, _ := cmd.Flags().GetBool("resume")
+	if resume && !journal.Exists(unzipPath) {
+		return fmt.Errorf("no translation journal found at %s, run translate without --resume first", journal.Path(unzipPath))
+	}
+
+	translationJournal, err := journal.Open(unzipPath)
+	if err != nil {
+		return err
+	}
+
+	// A resumed run keeps the settings of the run it resumes unless overridden
+	if resume {
+		previous := translationJournal.Run()
+		for flag, value := range map[string]string{
+			"provider": previous.Provider,
+			"model":    previous.Model,
+			"source":   previous.Source,
+			"target":   previous.Target,
+			"prompt":   previous.Prompt,
+		} {
+			if value == "" || cmd.Flags().Changed(flag) {
+				continue
+			}
+			// The recorded model belongs to the recorded provider
+			if flag == "model" && cmd.Flags().Changed("provider") {
+				continue
+			}
+			cmd.Flags().Set(flag, value)
+		}
+	}
+
+	provider := cmd.Flag("provider").Value.String()
 	model := cmd.Flag("model").Value.String()
-	if model == "" {
-		return fmt.Errorf("model flag is required")
+	providerOptionFlags, _ := cmd.Flags().GetStringArray("provider-option")
+	providerOptions, err := parseProviderOptions(providerOptionFlags)
+	if err != nil {
+		return err
 	}
 
-	// Kiểm tra API key
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		return fmt.Errorf("ANTHROPIC_API_KEY environment variable is not set")
+	concurrency, _ := cmd.Flags().GetInt("concurrency")
+	if concurrency <= 0 {
+		return fmt.Errorf("concurrency must be greater than 0")
 	}
+	requestsPerMinute, _ := cmd.Flags().GetInt("rpm")
+	tokensPerMinute, _ := cmd.Flags().GetInt("tpm")
 
-	limiter := rate.NewLimiter(rate.Every(time.Minute/50), 10)
+	// One limiter for the whole run, shared by every file and batch
+	limiter := ratelimit.New(requestsPerMinute, tokensPerMinute)
+
+	var limits budget.Limits
+	limits.MaxCost, _ = cmd.Flags().GetFloat64("max-cost")
+	limits.MaxInputTokens, _ = cmd.Flags().GetInt("max-input-tokens")
+	limits.MaxOutputTokens, _ = cmd.Flags().GetInt("max-output-tokens")
+	spend, err := budget.Open(unzipPath, limits)
+	if err != nil {
+		return err
+	}
 
 	// Check for existing guidelines
 	guidelinesPath := path.Join(unzipPath, "META-INF", "guidelines.txt")
@@ -144,10 +229,12 @@ func runTranslate(cmd *cobra.Command, args []string) error {
 		// Use existing guidelines
 		guidelines = string(guidelinesContent)
 		fmt.Println("Using existing translation guidelines from META-INF/guidelines.txt")
+	} else if translator.IsLocal(provider) {
+		// Guidelines are generated with Gemini, which would send the book's title off the machine
+		fmt.Printf("No translation guidelines in META-INF/guidelines.txt, not generating them because %s keeps the book on this machine\n", provider)
 	} else {
 		// Generate new guidelines if file doesn't exist
-		geminiEditor := editor.NewGemini()
-		newGuidelines, err := geminiEditor.GenerateGuidelines(ctx, sourceLanguage, targetLanguage, bookName)
+		newGuidelines, err := generateGuidelines(ctx, bookName)
 		if err != nil {
 			fmt.Printf("Warning: Failed to generate guidelines: %v\n", err)
 		} else {
@@ -161,81 +248,237 @@ func runTranslate(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	deepseekTranslator, err := translator.GetAnthropicTranslator(&translator.Config{
-		APIKey:                apiKey,
-		Model:                model,
-		Temperature:          0.7,
-		MaxTokens:           8192,
+	bookGlossary, err := glossary.Load(unzipPath)
+	if err != nil {
+		return err
+	}
+	if len(bookGlossary.Entries) > 0 {
+		fmt.Printf("Using %d glossary entries from %s\n", len(bookGlossary.Entries), path.Base(glossary.Find(unzipPath)))
+	}
+
+	translatorConfig := &translator.Config{
+		BaseURL:               cmd.Flag("base-url").Value.String(),
+		Model:                 model,
+		Temperature:           0.7,
+		MaxTokens:             8192,
 		TranslationGuidelines: guidelines,
-	})
+		Options:               providerOptions,
+		DataDir:               path.Join(unzipPath, "META-INF"),
+	}
+	deepseekTranslator, err := translator.New(provider, translatorConfig)
 	if err != nil {
 		return fmt.Errorf("error getting translator: %v", err)
 	}
+	model = translatorConfig.Model
+
+	// Unpriced models cost nothing in the spend record, so a cost cap would never stop them
+	if _, priced := translator.PriceFor(model); limits.MaxCost > 0 && !priced {
+		return fmt.Errorf("--max-cost cannot be enforced because model %s has no known price, cap the run with --max-input-tokens and --max-output-tokens instead", model)
+	}
+
+	if noCache, _ := cmd.Flags().GetBool("no-cache"); !noCache {
+		store, err := openCacheStore(cmd.Flag("cache-dir").Value.String())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Using translation cache at %s\n", store.Dir())
+		deepseekTranslator = translator.NewCached(deepseekTranslator, store, provider+"/"+model)
+	}
 
 	promptPreset := cmd.Flag("prompt").Value.String()
 	if promptPreset == "" {
 		return fmt.Errorf("prompt flag is required")
 	}
 
-	// 1 worker and 1 job at a time, mean 1 file at a time
-	err = processor.ProcessEpub(ctx, unzipPath, processor.Config{
-		Workers:      1,
-		JobBuffer:    1,
-		ResultBuffer: 10,
-	}, func(ctx context.Context, filePath string) error {
-		return processFileDirectly(ctx, filePath, deepseekTranslator, limiter, bookName, promptPreset)
-	})
+	protocol, err := resolveProtocol(cmd.Flag("protocol").Value.String(), deepseekTranslator)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Using the %s batch protocol\n", protocol)
 
-	return err
-}
+	var memory *tm.Memory
+	if noMemory, _ := cmd.Flags().GetBool("no-tm"); !noMemory {
+		memory, err = openTranslationMemory(cmd.Flag("tm").Value.String())
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Using translation memory at %s (%d entries)\n", memory.Path(), memory.Len())
+	}
 
-var estimatedTokensPerWord float32 = 1.5
+	// Content files in reading order, for the summaries and the context of each batch
+	files, _, err := processor.ContentFiles(unzipPath)
+	if err != nil {
+		return err
+	}
 
-func processFileDirectly(ctx context.Context, filePath string, translator translator.Translator, limiter *rate.Limiter, bookName string, promptPreset string) error {
-	if translator == nil {
-		return fmt.Errorf("translator is nil")
+	summaries, err := summary.Load(unzipPath)
+	if err != nil {
+		return err
 	}
-	if limiter == nil {
-		return fmt.Errorf("rate limiter is nil")
+	if summarize, _ := cmd.Flags().GetBool("summarize"); summarize {
+		completer, ok := translator.AsCompleter(deepseekTranslator)
+		if !ok {
+			return fmt.Errorf("provider %s cannot summarize chapters", provider)
+		}
+		summarizer := &chapterSummarizer{
+			completer: completer,
+			limiter:   limiter,
+			budget:    spend,
+			provider:  provider,
+			model:     model,
+			bookName:  bookName,
+			unzipPath: unzipPath,
+		}
+		if err := summarizer.summarize(ctx, summaries, files); err != nil {
+			return err
+		}
 	}
-	if bookName == "" {
-		return fmt.Errorf("book name is empty")
+	if len(summaries.Chapters) > 0 {
+		fmt.Printf("Using %d chapter summaries from %s\n", len(summaries.Chapters), summary.FileName)
 	}
-	if promptPreset == "" {
-		return fmt.Errorf("prompt preset is empty")
+
+	pipeline := newTranslationPipeline(deepseekTranslator, limiter, bookName, promptPreset, concurrency)
+	pipeline.unzipPath = unzipPath
+	pipeline.journal = translationJournal
+	pipeline.provider = provider
+	pipeline.model = model
+	pipeline.protocol = protocol
+	pipeline.budget = spend
+	pipeline.glossary = bookGlossary
+	pipeline.glossaryStrict, _ = cmd.Flags().GetBool("glossary-strict")
+	pipeline.memory = memory
+	pipeline.memoryThreshold, _ = cmd.Flags().GetFloat64("tm-threshold")
+	pipeline.summaries = summaries
+	pipeline.order = bookRelativePaths(unzipPath, files)
+	contextTokens, _ := cmd.Flags().GetInt("context-tokens")
+	pipeline.contextTokens = float32(contextTokens)
+	pipeline.files = files
+	pipeline.systemTokens = translator.EstimateTokens(translator.TranslationSystem(sourceLanguage, targetLanguage, guidelines, bookName, promptPreset))
+
+	if resume {
+		pipeline.only, err = resumableSegments(files, translationJournal.Segments())
+		if err != nil {
+			return err
+		}
+		if len(pipeline.only) == 0 {
+			fmt.Println("Nothing to resume: every segment is translated or recorded as done")
+			return nil
+		}
+		fmt.Printf("Resuming %d failed, pending and untranslated segments\n", len(pipeline.only))
 	}
 
-	fmt.Printf("\nProcessing file: %s\n", path.Base(filePath))
-    
-	doc, err := util.OpenAndReadFile(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to open and read file: %w", err)
+	if err := translationJournal.SetRun(journal.Run{
+		Provider:  provider,
+		Model:     model,
+		Source:    sourceLanguage,
+		Target:    targetLanguage,
+		Prompt:    promptPreset,
+		StartedAt: time.Now(),
+	}); err != nil {
+		return err
 	}
 
-	ensureUTF8Charset(doc)
+	// Up to concurrency files at a time; their batches share the same number of slots
+	err = processor.ProcessEpub(ctx, unzipPath, processor.Config{
+		Workers:      concurrency,
+		JobBuffer:    concurrency,
+		ResultBuffer: 10,
+	}, pipeline.processFile)
 
-	selector := fmt.Sprintf("[%s]:not([%s])", util.ContentIdKey, util.TranslationByIdKey)
-	elements := doc.Find(selector)
+	if translateMetadata, _ := cmd.Flags().GetBool("metadata"); translateMetadata && err == nil && spend.Exhausted() == nil {
+		err = pipeline.translateMetadata(ctx)
+	}
 
-	if elements == nil {
-		return fmt.Errorf("failed to find elements with selector: %s", selector)
+	runSpend, bookSpend := spend.Run(), spend.Total()
+	fmt.Printf("\nSpent this run: %d input tokens, %d output tokens, $%.4f (book total $%.4f)\n",
+		runSpend.InputTokens, runSpend.OutputTokens, runSpend.Cost, bookSpend.Cost)
+	if exhausted := spend.Exhausted(); exhausted != nil {
+		fmt.Printf("Stopped early: %v. Run \"epubtrans translate %s --resume\" to continue.\n", exhausted, unzipPath)
 	}
 
-	if elements.Length() == 0 {
-		fmt.Printf("No elements to translate in %s\n", path.Base(filePath))
-		return nil
+	return err
+}
+
+// resumableSegments returns the content ids of the untranslated elements of
+// files that the journal does not record as done: failed and pending ones, and
+// the ones an interrupted run never reached.
+func resumableSegments(files []string, segments map[string]journal.Segment) (map[string]bool, error) {
+	resumable := make(map[string]bool)
+	for _, filePath := range files {
+		doc, err := util.OpenAndReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open and read file: %w", err)
+		}
+		doc.Find(untranslatedSelector).Each(func(i int, s *goquery.Selection) {
+			contentID, _ := s.Attr(util.ContentIdKey)
+			if segments[contentID].Status != journal.StatusDone {
+				resumable[contentID] = true
+			}
+		})
 	}
+	return resumable, nil
+}
 
-	fmt.Printf("Found %d elements to translate in %s\n", 
-		elements.Length(), path.Base(filePath))
+func parseProviderOptions(values []string) (map[string]string, error) {
+	options := make(map[string]string, len(values))
+	for _, value := range values {
+		key, val, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("provider-option %q must be formatted as key=value", value)
+		}
+		options[key] = val
+	}
+	return options, nil
+}
+
+// tokenCounter is the part of a translator the batcher needs.
+type tokenCounter interface {
+	CountTokens(ctx context.Context, content string) (float32, error)
+}
+
+// batcher groups the untranslated elements of a document into batches that
+// fit the provider's context, learning the tokens-per-word ratio as it counts.
+type batcher struct {
+	counter        tokenCounter
+	maxBatchLength float32
+	quiet          bool
+
+	mu                     sync.Mutex
+	estimatedTokensPerWord float32
+}
+
+func newBatcher(counter tokenCounter) *batcher {
+	return &batcher{
+		counter:                counter,
+		maxBatchLength:         1500,
+		estimatedTokensPerWord: 1.5,
+	}
+}
+
+func (b *batcher) tokensPerWord() float32 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.estimatedTokensPerWord
+}
+
+func (b *batcher) updateTokensPerWord(tokens, words float32) {
+	if tokens <= 0 || words <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.estimatedTokensPerWord = tokens / words
+}
+
+// batches splits elements, all from doc, into translation batches.
+func (b *batcher) batches(ctx context.Context, filePath string, doc *goquery.Document, elements *goquery.Selection) []translationBatch {
+	var batches []translationBatch
 
 	// Create batches directly
 	currentBatch := translationBatch{
 		wordCount: 0,
 	}
 
-	maxBatchLength := float32(1500)
-
 	elements.Each(func(i int, contentEl *goquery.Selection) {
 		select {
 		case <-ctx.Done():
@@ -246,31 +489,34 @@ func processFileDirectly(ctx context.Context, filePath string, translator transl
 				return
 			}
 
+			contentID, _ := contentEl.Attr(util.ContentIdKey)
 			element := elementToTranslate{
 				filePath:      filePath,
+				contentID:     contentID,
 				contentEl:     contentEl,
 				doc:           doc,
 				totalElements: elements.Length(),
 				index:         i,
-				content:      htmlContent,
+				content:       htmlContent,
 			}
 
-			estimatedTokens := (currentBatch.wordCount + float32(len(strings.Fields(htmlContent)))) * estimatedTokensPerWord
+			estimatedTokens := (currentBatch.wordCount + float32(len(strings.Fields(htmlContent)))) * b.tokensPerWord()
 
-			if estimatedTokens > maxBatchLength {	
-				estimatedTokens = getBatchLength(ctx, &currentBatch, translator)
-				fmt.Printf("Counted tokens: %f\n", estimatedTokens)
-				estimatedTokensPerWord = estimatedTokens / currentBatch.wordCount // update estimated tokens per word
-			} else {
+			if estimatedTokens > b.maxBatchLength {
+				estimatedTokens = getBatchLength(ctx, &currentBatch, b.counter)
+				if !b.quiet {
+					fmt.Printf("Counted tokens: %f\n", estimatedTokens)
+				}
+				b.updateTokensPerWord(estimatedTokens, currentBatch.wordCount) // update estimated tokens per word
+			} else if !b.quiet {
 				fmt.Printf("Estimated tokens: %f\n", estimatedTokens)
 			}
 
-			if estimatedTokens > maxBatchLength && len(currentBatch.elements) > 0 {
-				// Process current batch
-				processBatch(ctx, filePath, currentBatch, translator, limiter, bookName, promptPreset)
+			if estimatedTokens > b.maxBatchLength && len(currentBatch.elements) > 0 {
+				batches = append(batches, currentBatch)
 				// Start new batch
 				currentBatch = translationBatch{
-					elements: []elementToTranslate{element},
+					elements:  []elementToTranslate{element},
 					wordCount: float32(len(strings.Fields(htmlContent))),
 				}
 			} else {
@@ -280,12 +526,150 @@ func processFileDirectly(ctx context.Context, filePath string, translator transl
 		}
 	})
 
-	// Process final batch if not empty
+	// Keep the final batch if not empty
 	if len(currentBatch.elements) > 0 {
-		processBatch(ctx, filePath, currentBatch, translator, limiter, bookName, promptPreset)
+		batches = append(batches, currentBatch)
 	}
 
-	return nil
+	return batches
+}
+
+// translationPipeline holds the state shared by every file and batch of a
+// translate run.
+type translationPipeline struct {
+	translator   translator.Translator
+	limiter      *ratelimit.Limiter
+	batcher      *batcher
+	bookName     string
+	promptPreset string
+
+	unzipPath string
+	journal   *journal.Journal
+	provider  string
+	model     string
+	protocol  string
+
+	// budget caps the run's spend; systemTokens is the estimated size of the
+	// system prompt added to every request
+	budget       *budget.Tracker
+	systemTokens float32
+
+	glossary       *glossary.Glossary
+	glossaryStrict bool
+
+	memory          *tm.Memory
+	memoryThreshold float64
+
+	// summaries are sent with each batch; order is the content files relative
+	// to the unpacked book, to tell the chapters before a batch from the others
+	summaries *summary.Summaries
+	order     []string
+
+	// contextTokens bounds the read-only context sent with each batch; files
+	// are the content files in translation order, for the context of the
+	// first batch of a file
+	contextTokens float32
+	files         []string
+
+	// only restricts the run to these content ids when resuming
+	only map[string]bool
+
+	// batchSlots bounds the number of batches in flight across all files
+	batchSlots chan struct{}
+}
+
+func newTranslationPipeline(t translator.Translator, limiter *ratelimit.Limiter, bookName string, promptPreset string, concurrency int) *translationPipeline {
+	return &translationPipeline{
+		translator:   t,
+		limiter:      limiter,
+		batcher:      newBatcher(t),
+		bookName:     bookName,
+		promptPreset: promptPreset,
+		batchSlots:   make(chan struct{}, max(1, concurrency)),
+	}
+}
+
+func (p *translationPipeline) processFile(ctx context.Context, filePath string) error {
+	if p.translator == nil {
+		return fmt.Errorf("translator is nil")
+	}
+	if p.limiter == nil {
+		return fmt.Errorf("rate limiter is nil")
+	}
+	if p.bookName == "" {
+		return fmt.Errorf("book name is empty")
+	}
+	if p.promptPreset == "" {
+		return fmt.Errorf("prompt preset is empty")
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nProcessing file: %s\n", path.Base(filePath))
+
+	doc, err := util.OpenAndReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open and read file: %w", err)
+	}
+
+	ensureUTF8Charset(doc)
+
+	selector := untranslatedSelector
+	elements := doc.Find(selector)
+
+	if elements == nil {
+		return fmt.Errorf("failed to find elements with selector: %s", selector)
+	}
+
+	if p.only != nil {
+		elements = elements.FilterFunction(func(i int, s *goquery.Selection) bool {
+			contentID, _ := s.Attr(util.ContentIdKey)
+			return p.only[contentID]
+		})
+	}
+
+	if p.memory != nil {
+		elements = p.reuseExactMatches(filePath, doc, elements)
+	}
+
+	if elements.Length() == 0 {
+		fmt.Printf("No elements to translate in %s\n", path.Base(filePath))
+		return nil
+	}
+
+	fmt.Printf("Found %d elements to translate in %s\n",
+		elements.Length(), path.Base(filePath))
+
+	// All batches are built before any is sent, so reading the document never
+	// races with the writes of a finished batch
+	batches := p.batcher.batches(ctx, filePath, doc, elements)
+
+	var wg sync.WaitGroup
+	for i, batch := range batches {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			// Batches that were never sent stay pending for --resume
+			for _, unsent := range batches[i:] {
+				p.skipBatch(filePath, batchContentIDs(unsent), ctx.Err())
+			}
+			return ctx.Err()
+		case p.batchSlots <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(batch translationBatch) {
+			defer wg.Done()
+			defer func() { <-p.batchSlots }()
+			p.processBatch(ctx, filePath, batch)
+		}(batch)
+	}
+	wg.Wait()
+
+	// An interrupted batcher leaves elements out, the file is not finished
+	return ctx.Err()
 }
 
 func extractBookName(unzipPath string) (string, error) {
@@ -303,7 +687,7 @@ func extractBookName(unzipPath string) (string, error) {
 	return pkg.Metadata.Title, nil
 }
 
-func getBatchLength(ctx context.Context, batch *translationBatch, translator translator.Translator) float32 {
+func getBatchLength(ctx context.Context, batch *translationBatch, translator tokenCounter) float32 {
 	if batch == nil {
 		fmt.Printf("Error: batch is nil\n")
 		return 0
@@ -335,7 +719,7 @@ func getBatchLength(ctx context.Context, batch *translationBatch, translator tra
 	return count
 }
 
-func processBatch(ctx context.Context, filePath string, batch translationBatch, anthropicTranslator translator.Translator, limiter *rate.Limiter, bookName string, promptPreset string) {
+func (p *translationPipeline) processBatch(ctx context.Context, filePath string, batch translationBatch) {
 	if len(batch.elements) == 0 {
 		return
 	}
@@ -343,87 +727,509 @@ func processBatch(ctx context.Context, filePath string, batch translationBatch,
 	fmt.Printf("\nTranslating batch from file %s (Elements: %d, Word Count: %f\n", 
 		path.Base(filePath), len(batch.elements), batch.wordCount)
 
-	// Combine contents with more distinct markers and instructions
-	var combinedContent strings.Builder
-	combinedContent.WriteString("Translate the following HTML segments. Each segment is marked with BEGIN_SEGMENT_X and END_SEGMENT_X markers. Preserve these markers exactly in your response and maintain all HTML tags.\n\n")
-	
-	for i, element := range batch.elements {
-		combinedContent.WriteString(fmt.Sprintf("<SEGMENT_%d>\n%s\n</SEGMENT_%d>\n\n", i, element.content, i))
+	contentIDs := batchContentIDs(batch)
+	combinedContent, err := batchPrompt(p.protocol, batch)
+	if err != nil {
+		fmt.Printf("Skipping batch from %s: %v\n", path.Base(filePath), err)
+		p.skipBatch(filePath, contentIDs, err)
+		return
+	}
+
+	usage := &translator.Usage{}
+	translateCtx := p.withBatchNotes(translator.ContextWithUsage(ctx, usage), filePath, batch)
+	if p.protocol == protocolJSON {
+		translateCtx = translator.WithJSONResponse(translateCtx)
+	}
+
+	estimate := p.estimateSpend(translateCtx, combinedContent, batch)
+	if p.budget != nil {
+		if err := p.budget.Reserve(estimate); err != nil {
+			fmt.Printf("Skipping batch from %s: %v\n", path.Base(filePath), err)
+			p.skipBatch(filePath, contentIDs, err)
+			return
+		}
 	}
 
+	batchID := p.startBatch(filePath, contentIDs)
+
 	// Translate combined content
-	translatedContent, err := retryTranslate(ctx, anthropicTranslator, limiter, combinedContent.String(), sourceLanguage, targetLanguage, bookName, promptPreset)
+	translations, err := p.translateBatch(translateCtx, filePath, batch, combinedContent, &estimate)
 	if err != nil {
 		fmt.Printf("Batch translation error: %v\n", err)
+		p.finishBatch(batchID, estimate, journal.Result{Err: err}, usage)
 		return
 	}
 
-	// Split translated content and process individual elements
-	translations := splitTranslations(translatedContent)
-	if len(translations) != len(batch.elements) {
-		fmt.Printf("Translation segments mismatch for %s: got %d, expected %d\n", 
-			path.Base(filePath), len(translations), len(batch.elements))
-		
-		// Write debug information to file
-		debugFilePath := filePath + ".debug.txt"
-		debugContent := fmt.Sprintf("Original Request:\n%s\n\nTranslated Response:\n%s\n\nExpected segments: %d\nReceived segments: %d",
-			combinedContent.String(),
-			translatedContent,
-			len(batch.elements),
-			len(translations))
-			
-		if err := os.WriteFile(debugFilePath, []byte(debugContent), 0644); err != nil {
-			fmt.Printf("Failed to write debug file: %v\n", err)
-		} else {
-			fmt.Printf("Debug information written to: %s\n", debugFilePath)
-		}
-		
-		// Process as many translations as we have
-		minLen := min(len(translations), len(batch.elements))
-		translations = translations[:minLen]
-		batch.elements = batch.elements[:minLen]
-		
-		fmt.Printf("Proceeding with %d valid translations\n", minLen)
-	}
-
 	fmt.Printf("Successfully translated batch from %s, writing to file...\n", path.Base(filePath))
 
 	fileLock := getFileLock(filePath)
 	fileLock.Lock()
 	defer fileLock.Unlock()
 
+	var failed []string
+	written := 0
 	for i, element := range batch.elements {
-		if isTranslationValid(element.content, translations[i]) {
-			if err := manipulateHTML(element.contentEl, targetLanguage, translations[i]); err != nil {
-				fmt.Printf("HTML manipulation error: %v\n", err)
+		if translations[i] == "" {
+			failed = append(failed, element.contentID)
+			continue
+		}
+		if violations := p.glossary.Check(element.content, translations[i]); len(violations) > 0 {
+			for _, violation := range violations {
+				fmt.Printf("Glossary violation in %s: %s\n", path.Base(filePath), violation)
+			}
+			if p.glossaryStrict {
+				failed = append(failed, element.contentID)
 				continue
 			}
 		}
+		if err := manipulateHTML(element.contentEl, targetLanguage, translations[i]); err != nil {
+			fmt.Printf("HTML manipulation error: %v\n", err)
+			failed = append(failed, element.contentID)
+			continue
+		}
+		p.remember(element.content, translations[i])
+		written++
+	}
+
+	if written == 0 {
+		p.finishBatch(batchID, estimate, journal.Result{Failed: failed}, usage)
+		return
 	}
 
 	if err := writeContentToFile(filePath, batch.elements[0].doc); err != nil {
 		fmt.Printf("Error writing to file: %v\n", err)
+		p.finishBatch(batchID, estimate, journal.Result{Err: err}, usage)
+		return
 	}
+
+	p.finishBatch(batchID, estimate, journal.Result{Failed: failed}, usage)
 }
 
-func splitTranslations(translatedContent string) []string {
-	var translations []string
-	segments := strings.Split(translatedContent, "<SEGMENT_")
-	
-	for i := 1; i < len(segments); i++ {
-		if parts := strings.Split(segments[i], "</SEGMENT_"); len(parts) > 1 {
-			// Extract segment number and content
-			segmentContent := parts[0]
-			if idx := strings.Index(segmentContent, ">"); idx != -1 {
-				content := strings.TrimSpace(segmentContent[idx+1:])
-				translations = append(translations, content)
-			}
+// withBatchNotes returns ctx with the notes for batch, a batch of filePath,
+// added to the system prompt: batchNotes, which are part of the cache key, and
+// batchContextNotes, which change from run to run and are not.
+func (p *translationPipeline) withBatchNotes(ctx context.Context, filePath string, batch translationBatch) context.Context {
+	ctx = translator.WithSystemNotes(ctx, p.batchNotes(filePath, batch)...)
+	return translator.WithContextNotes(ctx, p.batchContextNotes(filePath, batch)...)
+}
+
+// batchNotes returns the notes that follow from the book itself for batch, a
+// batch of filePath: the glossary entries that occur in it and the running
+// summary. Empty notes are left for WithSystemNotes to drop.
+func (p *translationPipeline) batchNotes(filePath string, batch translationBatch) []string {
+	var notes []string
+	if entries := p.glossary.Relevant(batchText(batch)); len(entries) > 0 {
+		notes = append(notes, glossary.Prompt(entries))
+	}
+	return append(notes, p.summaries.Prompt(bookRelativePath(p.unzipPath, filePath), p.order))
+}
+
+// batchContextNotes returns the notes for batch, a batch of filePath, that
+// depend on what has been translated so far: translation memory examples and
+// the preceding context.
+func (p *translationPipeline) batchContextNotes(filePath string, batch translationBatch) []string {
+	return []string{p.memoryExamples(batch), p.batchContext(filePath, batch)}
+}
+
+// translateBatch sends prompt, the request for batch, and returns the
+// translation of each element of batch, empty for the elements that could not
+// be translated. Elements the response leaves out or gets wrong are retried in
+// halves down to single elements, and a single element with an invalid
+// translation is retried once with a repair prompt. The budget reserved for
+// the retries is added to estimate.
+func (p *translationPipeline) translateBatch(ctx context.Context, filePath string, batch translationBatch, prompt string, estimate *budget.Spend) ([]string, error) {
+	response, err := retryTranslate(translator.WithResponseCheck(ctx, p.validResponse(batch)), p.translator, p.limiter, p.systemTokens, prompt, sourceLanguage, targetLanguage, p.bookName, p.promptPreset)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only segments matched to their element by content ID or index are kept
+	translations, problems := parseBatchResponse(p.protocol, response, batch)
+	var retry []int
+	for i, element := range batch.elements {
+		if translations[i] == "" {
+			retry = append(retry, i)
+			continue
+		}
+		if problem := translationProblem(element.content, translations[i]); problem != "" {
+			problems = append(problems, fmt.Sprintf("segment %s was rejected because %s", element.contentID, problem))
+			retry = append(retry, i)
 		}
 	}
-	
+	if len(problems) > 0 {
+		p.reportProblems(filePath, prompt, response, problems)
+	}
+	if len(retry) == 0 {
+		return translations, nil
+	}
+
+	if len(batch.elements) == 1 {
+		translations[0] = p.repairTranslation(ctx, filePath, batch, translations[0], estimate)
+		return translations, nil
+	}
+
+	failed := make([]elementToTranslate, len(retry))
+	for i, index := range retry {
+		failed[i] = batch.elements[index]
+	}
+	half := (len(failed) + 1) / 2
+	for start := 0; start < len(failed); start += half {
+		end := min(start+half, len(failed))
+		for i, translation := range p.retryBatch(ctx, filePath, translationBatch{elements: failed[start:end]}, estimate) {
+			translations[retry[start+i]] = translation
+		}
+	}
+
+	return translations, nil
+}
+
+// retryBatch translates the elements of batch again as a batch of their own,
+// returning an empty translation for the ones that still fail.
+func (p *translationPipeline) retryBatch(ctx context.Context, filePath string, batch translationBatch, estimate *budget.Spend) []string {
+	prompt, err := batchPrompt(p.protocol, batch)
+	if err != nil {
+		fmt.Printf("Not retrying %d segments from %s: %v\n", len(batch.elements), path.Base(filePath), err)
+		return make([]string, len(batch.elements))
+	}
+	if !p.reserveRetry(ctx, filePath, prompt, batch, estimate) {
+		return make([]string, len(batch.elements))
+	}
+
+	fmt.Printf("Retrying %d segments from %s\n", len(batch.elements), path.Base(filePath))
+	translations, err := p.translateBatch(ctx, filePath, batch, prompt, estimate)
+	if err != nil {
+		fmt.Printf("Batch translation error: %v\n", err)
+		return make([]string, len(batch.elements))
+	}
 	return translations
 }
 
+// repairTranslation asks again for the translation of the single element of
+// batch, showing the rejected translation and why it was rejected. It returns
+// the repaired translation, or an empty one if the repair is not valid either.
+func (p *translationPipeline) repairTranslation(ctx context.Context, filePath string, batch translationBatch, rejected string, estimate *budget.Spend) string {
+	// A segment the response left out has nothing to repair
+	if rejected == "" {
+		return ""
+	}
+
+	element := batch.elements[0]
+	problem := translationProblem(element.content, rejected)
+	prompt, err := repairPrompt(p.protocol, batch, rejected, problem)
+	if err != nil {
+		fmt.Printf("Not repairing %s in %s: %v\n", element.contentID, path.Base(filePath), err)
+		return ""
+	}
+	if !p.reserveRetry(ctx, filePath, prompt, batch, estimate) {
+		return ""
+	}
+
+	fmt.Printf("Asking for a repaired translation of %s in %s\n", element.contentID, path.Base(filePath))
+	response, err := retryTranslate(translator.WithResponseCheck(ctx, p.validResponse(batch)), p.translator, p.limiter, p.systemTokens, prompt, sourceLanguage, targetLanguage, p.bookName, p.promptPreset)
+	if err != nil {
+		fmt.Printf("Batch translation error: %v\n", err)
+		return ""
+	}
+
+	translations, problems := parseBatchResponse(p.protocol, response, batch)
+	if translations[0] != "" {
+		problem := translationProblem(element.content, translations[0])
+		if problem == "" {
+			return translations[0]
+		}
+		problems = append(problems, fmt.Sprintf("repaired segment %s was rejected because %s", element.contentID, problem))
+	}
+	p.reportProblems(filePath, prompt, response, problems)
+	return ""
+}
+
+// validResponse returns a check that accepts a response only when it has a
+// valid translation for every element of batch, so the cache never replays a
+// response the pipeline would reject or retry.
+func (p *translationPipeline) validResponse(batch translationBatch) func(string) bool {
+	return func(response string) bool {
+		translations, problems := parseBatchResponse(p.protocol, response, batch)
+		if len(problems) > 0 {
+			return false
+		}
+		for i, element := range batch.elements {
+			if translations[i] == "" || translationProblem(element.content, translations[i]) != "" {
+				return false
+			}
+			if p.glossaryStrict && len(p.glossary.Check(element.content, translations[i])) > 0 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// reserveRetry reserves the budget of sending prompt for batch again under ctx
+// and adds it to estimate. It reports false when the budget does not allow the
+// retry.
+func (p *translationPipeline) reserveRetry(ctx context.Context, filePath, prompt string, batch translationBatch, estimate *budget.Spend) bool {
+	spend := p.estimateSpend(ctx, prompt, batch)
+	if p.budget != nil {
+		if err := p.budget.Reserve(spend); err != nil {
+			fmt.Printf("Not retrying %d segments from %s: %v\n", len(batch.elements), path.Base(filePath), err)
+			return false
+		}
+	}
+
+	estimate.InputTokens += spend.InputTokens
+	estimate.OutputTokens += spend.OutputTokens
+	estimate.Cost += spend.Cost
+	return true
+}
+
+// reportProblems prints what was wrong with a response and writes the request
+// and response next to filePath for debugging.
+func (p *translationPipeline) reportProblems(filePath, prompt, response string, problems []string) {
+	fmt.Printf("Invalid segments in the response for %s:\n", path.Base(filePath))
+	for _, problem := range problems {
+		fmt.Printf("  %s\n", problem)
+	}
+
+	// Write debug information to file
+	debugFilePath := filePath + ".debug.txt"
+	debugContent := fmt.Sprintf("Original Request:\n%s\n\nTranslated Response:\n%s\n\nProblems:\n%s",
+		prompt,
+		response,
+		strings.Join(problems, "\n"))
+
+	if err := os.WriteFile(debugFilePath, []byte(debugContent), 0644); err != nil {
+		fmt.Printf("Failed to write debug file: %v\n", err)
+	} else {
+		fmt.Printf("Debug information written to: %s\n", debugFilePath)
+	}
+}
+
+// maxMemoryExamples bounds the fuzzy matches offered with one batch
+const maxMemoryExamples = 5
+
+// openTranslationMemory opens the memory at path, or at the default location when path is empty.
+func openTranslationMemory(path string) (*tm.Memory, error) {
+	if path == "" {
+		defaultPath, err := tm.DefaultPath()
+		if err != nil {
+			return nil, err
+		}
+		path = defaultPath
+	}
+
+	return tm.Open(path)
+}
+
+// reuseExactMatches translates the elements the memory already knows and
+// returns the ones left to send. A match is only reused when it passes the
+// checks a model translation has to pass, and the reused elements are
+// recorded in the journal as done.
+func (p *translationPipeline) reuseExactMatches(filePath string, doc *goquery.Document, elements *goquery.Selection) *goquery.Selection {
+	var reused []string
+	remaining := elements.FilterFunction(func(i int, s *goquery.Selection) bool {
+		content, err := s.Html()
+		if err != nil {
+			return true
+		}
+		entry, ok := p.memory.Exact(sourceLanguage, targetLanguage, content)
+		if !ok {
+			return true
+		}
+
+		contentID := s.AttrOr(util.ContentIdKey, "")
+		if problem := translationProblem(content, entry.Target); problem != "" {
+			fmt.Printf("Not reusing the translation memory match for %s in %s because %s\n", contentID, path.Base(filePath), problem)
+			return true
+		}
+		if violations := p.glossary.Check(content, entry.Target); len(violations) > 0 {
+			for _, violation := range violations {
+				fmt.Printf("Glossary violation in %s: %s\n", path.Base(filePath), violation)
+			}
+			if p.glossaryStrict {
+				return true
+			}
+		}
+
+		if err := manipulateHTML(s, targetLanguage, entry.Target); err != nil {
+			fmt.Printf("HTML manipulation error: %v\n", err)
+			return true
+		}
+		reused = append(reused, contentID)
+		return false
+	})
+
+	if len(reused) > 0 {
+		fmt.Printf("Reused %d translations from translation memory in %s\n", len(reused), path.Base(filePath))
+
+		fileLock := getFileLock(filePath)
+		fileLock.Lock()
+		defer fileLock.Unlock()
+		if err := writeContentToFile(filePath, doc); err != nil {
+			fmt.Printf("Error writing to file: %v\n", err)
+			return remaining
+		}
+		p.recordReused(filePath, reused)
+	}
+
+	return remaining
+}
+
+// recordReused records the elements of filePath translated from the memory
+// as a finished batch, with "memory" as its provider.
+func (p *translationPipeline) recordReused(filePath string, contentIDs []string) {
+	if p.journal == nil {
+		return
+	}
+
+	batch := p.journalBatch(filePath, contentIDs)
+	batch.Provider = "memory"
+	batch.Model = ""
+	err := p.journal.Start(batch)
+	if err == nil {
+		err = p.journal.Finish(batch.ID, journal.Result{})
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to update translation journal: %v\n", err)
+	}
+}
+
+// memoryExamples formats the best fuzzy matches of the elements of batch as
+// few-shot examples for the system prompt.
+func (p *translationPipeline) memoryExamples(batch translationBatch) string {
+	if p.memory == nil {
+		return ""
+	}
+
+	var b strings.Builder
+	seen := make(map[string]bool)
+	for _, element := range batch.elements {
+		for _, match := range p.memory.Fuzzy(sourceLanguage, targetLanguage, element.content, p.memoryThreshold, 1) {
+			if seen[match.Entry.Source] || len(seen) >= maxMemoryExamples {
+				continue
+			}
+			seen[match.Entry.Source] = true
+			fmt.Fprintf(&b, "\nSource: %s\nTranslation: %s\n", match.Entry.Source, match.Entry.Target)
+		}
+	}
+	if len(seen) == 0 {
+		return ""
+	}
+
+	return "TRANSLATION MEMORY:\nEarlier translations of similar passages. Reuse their wording where the source is the same and translate only what differs.\n" + b.String()
+}
+
+// remember adds a committed translation to the memory.
+func (p *translationPipeline) remember(source, translation string) {
+	if p.memory == nil {
+		return
+	}
+
+	if err := p.memory.Add(tm.Entry{
+		SourceLang: sourceLanguage,
+		TargetLang: targetLanguage,
+		Source:     source,
+		Target:     translation,
+		Book:       p.bookName,
+	}); err != nil {
+		fmt.Printf("Warning: failed to update translation memory: %v\n", err)
+	}
+}
+
+// batchContentIDs returns the content ids of the elements of batch.
+func batchContentIDs(batch translationBatch) []string {
+	contentIDs := make([]string, len(batch.elements))
+	for i, element := range batch.elements {
+		contentIDs[i] = element.contentID
+	}
+	return contentIDs
+}
+
+// batchText joins the content of the elements of batch.
+func batchText(batch translationBatch) string {
+	contents := make([]string, len(batch.elements))
+	for i, element := range batch.elements {
+		contents[i] = element.content
+	}
+	return strings.Join(contents, "\n")
+}
+
+// estimateSpend projects the usage of sending prompt for batch under ctx: the
+// prompt, the system prompt and the notes in ctx in, and defaultOutputRatio
+// times the content out.
+func (p *translationPipeline) estimateSpend(ctx context.Context, prompt string, batch translationBatch) budget.Spend {
+	var contentTokens float32
+	for _, element := range batch.elements {
+		contentTokens += translator.EstimateTokens(element.content)
+	}
+	notesTokens := translator.EstimateTokens(strings.Join(translator.SystemNotes(ctx), "\n\n"))
+
+	usage := translator.Usage{
+		InputTokens:  int(p.systemTokens + notesTokens + translator.EstimateTokens(prompt)),
+		OutputTokens: int(contentTokens * defaultOutputRatio),
+	}
+	return budget.Spend{InputTokens: usage.InputTokens, OutputTokens: usage.OutputTokens, Cost: usage.Cost(p.model)}
+}
+
+// journalBatch describes a batch of filePath for the journal.
+func (p *translationPipeline) journalBatch(filePath string, contentIDs []string) journal.Batch {
+	file := bookRelativePath(p.unzipPath, filePath)
+
+	return journal.Batch{
+		ID:         journal.BatchID(file, contentIDs),
+		File:       file,
+		ContentIDs: contentIDs,
+		Provider:   p.provider,
+		Model:      p.model,
+	}
+}
+
+// startBatch records a batch as pending in the journal and returns its id.
+func (p *translationPipeline) startBatch(filePath string, contentIDs []string) string {
+	batch := p.journalBatch(filePath, contentIDs)
+	if p.journal == nil {
+		return batch.ID
+	}
+
+	if err := p.journal.Start(batch); err != nil {
+		fmt.Printf("Warning: failed to update translation journal: %v\n", err)
+	}
+
+	return batch.ID
+}
+
+// skipBatch records a batch that was not sent as pending, so --resume picks it up.
+func (p *translationPipeline) skipBatch(filePath string, contentIDs []string, reason error) {
+	if p.journal == nil {
+		return
+	}
+
+	if err := p.journal.Skip(p.journalBatch(filePath, contentIDs), reason.Error()); err != nil {
+		fmt.Printf("Warning: failed to update translation journal: %v\n", err)
+	}
+}
+
+// finishBatch records the outcome and spend of a batch in the journal and
+// releases its budget reservation.
+func (p *translationPipeline) finishBatch(batchID string, estimate budget.Spend, result journal.Result, usage *translator.Usage) {
+	result.InputTokens = usage.InputTokens
+	result.OutputTokens = usage.OutputTokens
+	result.Cost = usage.Cost(p.model)
+
+	if p.budget != nil {
+		actual := budget.Spend{InputTokens: result.InputTokens, OutputTokens: result.OutputTokens, Cost: result.Cost}
+		if err := p.budget.Commit(estimate, actual, p.provider+"/"+p.model); err != nil {
+			fmt.Printf("Warning: failed to update spend record: %v\n", err)
+		}
+	}
+
+	if p.journal == nil {
+		return
+	}
+	if err := p.journal.Finish(batchID, result); err != nil {
+		fmt.Printf("Warning: failed to update translation journal: %v\n", err)
+	}
+}
+
 func ensureUTF8Charset(doc *goquery.Document) {
 	charset, _ := doc.Find("meta[charset]").Attr("charset")
 	if charset != "utf-8" {
@@ -431,9 +1237,16 @@ func ensureUTF8Charset(doc *goquery.Document) {
 	}
 }
 
-func retryTranslate(ctx context.Context, t translator.Translator, limiter *rate.Limiter, content, sourceLang, targetLang, bookName, promptPreset string) (string, error) {
+// retryBaseDelay is the initial backoff between translation attempts
+var retryBaseDelay = time.Second
+
+// retryTranslate sends content within the rate limit, retrying failures with
+// backoff. systemTokens is the size of the system prompt without the notes in
+// ctx, which are counted here.
+func retryTranslate(ctx context.Context, t translator.Translator, limiter *ratelimit.Limiter, systemTokens float32, content, sourceLang, targetLang, bookName, promptPreset string) (string, error) {
 	maxRetries := 3
-	baseDelay := time.Second
+	baseDelay := retryBaseDelay
+	requestTokens := requestTokens(ctx, systemTokens, content)
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		select {
@@ -441,7 +1254,7 @@ func retryTranslate(ctx context.Context, t translator.Translator, limiter *rate.
 			return "", ctx.Err()
 		default:
 			// Wait for rate limiter
-			if err := limiter.Wait(ctx); err != nil {
+			if err := limiter.Wait(ctx, requestTokens); err != nil {
 				return "", fmt.Errorf("rate limiter error: %w", err)
 			}
 
@@ -463,39 +1276,42 @@ func retryTranslate(ctx context.Context, t translator.Translator, limiter *rate.
 	return "", fmt.Errorf("max retries reached")
 }
 
+// requestTokens is the size of a request for content to reserve from the
+// rate limiter: the system prompt with the notes in ctx, the content, and as
+// much again for the response, which is usually as long as the content.
+func requestTokens(ctx context.Context, systemTokens float32, content string) int {
+	notesTokens := translator.EstimateTokens(strings.Join(translator.SystemNotes(ctx), "\n\n"))
+	return int(systemTokens + notesTokens + translator.EstimateTokens(content)*2)
+}
+
 func calculateBackoff(attempt int, baseDelay time.Duration) time.Duration {
 	backoff := float64(baseDelay) * math.Pow(2, float64(attempt))
 	jitter := rand.Float64() * float64(baseDelay)
 	return time.Duration(backoff + jitter)
 }
 
-func isTranslationValid(original, translated string) bool {
+// translationProblem returns why translated is not a valid translation of
+// original, or an empty string if it is.
+func translationProblem(original, translated string) string {
 	if translated == original {
-		return true
+		return ""
 	}
 
 	// Check if translation is suspiciously long or short
 	originalWords := countWords(original)
 	translatedWords := countWords(translated)
 	if translatedWords > originalWords*5 || translatedWords < originalWords/5 {
-		return false
+		return fmt.Sprintf("it has %d words for %d in the source", translatedWords, originalWords)
 	}
 
 	// Ensure all HTML tags are preserved
 	originalTags := extractHTMLTags(original)
 	translatedTags := extractHTMLTags(translated)
-	
-	if len(originalTags) != len(translatedTags) {
-		return false
-	}
-	
-	for i := range originalTags {
-		if originalTags[i] != translatedTags[i] {
-			return false
-		}
+	if !slices.Equal(originalTags, translatedTags) {
+		return "its HTML tags differ from the source"
 	}
 
-	return true
+	return ""
 }
 
 func extractHTMLTags(html string) []string {
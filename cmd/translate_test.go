@@ -0,0 +1,846 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/budget"
+	"github.com/nguyenvanduocit/epubtrans/pkg/cache"
+	"github.com/nguyenvanduocit/epubtrans/pkg/journal"
+	"github.com/nguyenvanduocit/epubtrans/pkg/ratelimit"
+	"github.com/nguyenvanduocit/epubtrans/pkg/summary"
+	"github.com/nguyenvanduocit/epubtrans/pkg/tm"
+	"github.com/nguyenvanduocit/epubtrans/pkg/translator"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+	"github.com/spf13/pflag"
+)
+
+var testBookFiles = map[string]string{
+	"mimetype": "application/epub+zip",
+	"META-INF/container.xml": `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/package.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`,
+	"OEBPS/package.opf": `<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">urn:uuid:0000</dc:identifier>
+    <dc:title>Test Book</dc:title>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="ch1" href="chapter1.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch2" href="chapter2.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+    <itemref idref="ch2"/>
+  </spine>
+</package>`,
+	"OEBPS/chapter1.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Chapter One</title></head><body>
+<h1>The first chapter</h1>
+<p>It was a bright cold day in April.</p>
+<p>The clocks were striking <em>thirteen</em> again.</p>
+<p>Nobody noticed &amp; nobody cared.</p>
+</body></html>`,
+	"OEBPS/chapter2.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Chapter Two</title></head><body>
+<h1>The second chapter</h1>
+<p>Outside, even through the shut window, the world looked cold.</p>
+<p>Down in the street little eddies of wind were whirling dust.</p>
+</body></html>`,
+}
+
+// writeTestBook creates a small EPUB in a temporary directory and returns its path.
+func writeTestBook(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	epubPath := filepath.Join(t.TempDir(), "book.epub")
+	f, err := os.Create(epubPath)
+	if err != nil {
+		t.Fatalf("create epub: %v", err)
+	}
+	defer f.Close()
+
+	w := zip.NewWriter(f)
+	for name, content := range files {
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("create entry %s: %v", name, err)
+		}
+		if _, err := entry.Write([]byte(content)); err != nil {
+			t.Fatalf("write entry %s: %v", name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	return epubPath
+}
+
+// runCommand executes the CLI with args and fails the test on error.
+func runCommand(t *testing.T, args ...string) {
+	t.Helper()
+
+	if err := executeCommand(context.Background(), args...); err != nil {
+		t.Fatalf("epubtrans %s: %v", strings.Join(args, " "), err)
+	}
+}
+
+// executeCommand executes the CLI with args under ctx after resetting the
+// flags left over from previous invocations in the same test binary.
+func executeCommand(ctx context.Context, args ...string) error {
+	if cmd, _, err := Root.Find(args); err == nil {
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if slice, ok := f.Value.(pflag.SliceValue); ok {
+				slice.Replace(nil)
+			} else {
+				f.Value.Set(f.DefValue)
+			}
+			f.Changed = false
+		})
+		// Subcommands keep the context of their first execution
+		cmd.SetContext(ctx)
+	}
+
+	Root.SetArgs(args)
+	return Root.ExecuteContext(ctx)
+}
+
+// unpackAndMark unpacks the test book and marks its content, returning the
+// unpacked directory.
+func unpackAndMark(t *testing.T) string {
+	t.Helper()
+
+	// Keep the translation memory and other per-user state out of the real home directory
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+
+	epubPath := writeTestBook(t, testBookFiles)
+	runCommand(t, "unpack", epubPath)
+
+	unpackedPath, err := util.GetUnzipDestination(epubPath)
+	if err != nil {
+		t.Fatalf("GetUnzipDestination() error = %v", err)
+	}
+	runCommand(t, "mark", unpackedPath)
+
+	return unpackedPath
+}
+
+// assertPseudoTranslated checks that every marked element in the packed book
+// has a translated sibling that reverses to the original.
+func assertPseudoTranslated(t *testing.T, epubPath string, chapters ...string) {
+	t.Helper()
+
+	r, err := zip.OpenReader(epubPath)
+	if err != nil {
+		t.Fatalf("open packed epub: %v", err)
+	}
+	defer r.Close()
+
+	for _, chapter := range chapters {
+		f, err := r.Open(chapter)
+		if err != nil {
+			t.Fatalf("open %s: %v", chapter, err)
+		}
+		content, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("read %s: %v", chapter, err)
+		}
+
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(content)))
+		if err != nil {
+			t.Fatalf("parse %s: %v", chapter, err)
+		}
+
+		sources := doc.Find("[" + util.ContentIdKey + "]")
+		if sources.Length() == 0 {
+			t.Fatalf("%s has no marked elements", chapter)
+		}
+
+		sources.Each(func(i int, source *goquery.Selection) {
+			translationID, ok := source.Attr(util.TranslationByIdKey)
+			if !ok {
+				t.Errorf("%s: element %q was not translated", chapter, source.Text())
+				return
+			}
+
+			target := doc.Find("[" + util.TranslationIdKey + "=\"" + translationID + "\"]")
+			if target.Length() != 1 {
+				t.Errorf("%s: expected one translation for %q, got %d", chapter, source.Text(), target.Length())
+				return
+			}
+
+			if target.Text() == source.Text() {
+				t.Errorf("%s: translation of %q was not pseudo-localised", chapter, source.Text())
+			}
+			if got := translator.DePseudoLocalize(target.Text()); got != source.Text() {
+				t.Errorf("%s: translation reverses to %q, want %q", chapter, got, source.Text())
+			}
+		})
+	}
+}
+
+func TestTranslatePipelineWithMockProvider(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--cache-dir", t.TempDir())
+
+	// The offline provider never asks Gemini for guidelines
+	if _, err := os.Stat(filepath.Join(unpackedPath, "META-INF", "guidelines.txt")); !os.IsNotExist(err) {
+		t.Errorf("guidelines were generated for a local provider: %v", err)
+	}
+
+	packedPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", unpackedPath, "--output", packedPath)
+
+	assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+}
+
+func TestTranslateRetriesMockRateLimits(t *testing.T) {
+	previousDelay := retryBaseDelay
+	retryBaseDelay = time.Millisecond
+	t.Cleanup(func() { retryBaseDelay = previousDelay })
+
+	unpackedPath := unpackAndMark(t)
+
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--provider-option", "rate_limit_every=2", "--cache-dir", t.TempDir())
+
+	packedPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", unpackedPath, "--output", packedPath)
+
+	assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+}
+
+// inFlight tracks the requests the tracking provider answers at the same time.
+var inFlight struct {
+	sync.Mutex
+	current, max int
+}
+
+func init() {
+	translator.Register("tracking-mock", func(cfg *translator.Config) (translator.Translator, error) {
+		mock, err := translator.NewMock(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &trackingTranslator{Mock: mock}, nil
+	})
+}
+
+// trackingTranslator is a slow mock that records the most requests it had in
+// flight at once.
+type trackingTranslator struct {
+	*translator.Mock
+}
+
+func (tr *trackingTranslator) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	inFlight.Lock()
+	inFlight.current++
+	inFlight.max = max(inFlight.max, inFlight.current)
+	inFlight.Unlock()
+	defer func() {
+		inFlight.Lock()
+		inFlight.current--
+		inFlight.Unlock()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	return tr.Mock.Translate(ctx, promptPreset, content, source, target, bookName)
+}
+
+func TestTranslateInParallel(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	// A guidelines file keeps translate from asking Gemini to generate one
+	if err := saveGuidelines(unpackedPath, "Translate from %[1]s to %[2]s."); err != nil {
+		t.Fatalf("saveGuidelines() error = %v", err)
+	}
+	inFlight.max = 0
+
+	runCommand(t, "translate", unpackedPath, "--provider", "tracking-mock", "--concurrency", "4", "--tpm", "100000", "--no-cache")
+
+	// Each chapter is one batch, and both are sent at once
+	if inFlight.max != 2 {
+		t.Errorf("at most %d requests were in flight, want the batches of both chapters", inFlight.max)
+	}
+
+	packedPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", unpackedPath, "--output", packedPath)
+
+	assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+}
+
+func TestRequestTokensCountSystemPrompt(t *testing.T) {
+	content := "<p>It was a bright cold day in April.</p>"
+	bare := requestTokens(context.Background(), 0, content)
+
+	if got := requestTokens(context.Background(), 500, content); got != bare+500 {
+		t.Errorf("requestTokens() with a system prompt = %d, want %d", got, bare+500)
+	}
+	note := strings.Repeat("Keep the names of the characters. ", 20)
+	if got := requestTokens(translator.WithSystemNotes(context.Background(), note), 0, content); got <= bare {
+		t.Errorf("requestTokens() with a note = %d, want more than %d", got, bare)
+	}
+}
+
+func TestEstimateSpendCountsNotes(t *testing.T) {
+	content := "It was a bright cold day in April."
+	batch := translationBatch{elements: []elementToTranslate{{contentID: "a", content: content}}}
+	p := &translationPipeline{systemTokens: 500}
+	bare := p.estimateSpend(context.Background(), content, batch)
+
+	if want := int(500 + translator.EstimateTokens(content)); bare.InputTokens != want {
+		t.Errorf("input tokens = %d, want the system prompt and the prompt, %d", bare.InputTokens, want)
+	}
+	if want := int(translator.EstimateTokens(content) * defaultOutputRatio); bare.OutputTokens != want {
+		t.Errorf("output tokens = %d, want the content at the output ratio of estimate, %d", bare.OutputTokens, want)
+	}
+
+	note := strings.Repeat("Keep the names of the characters. ", 20)
+	ctx := translator.WithContextNotes(translator.WithSystemNotes(context.Background(), note), note)
+	if got, want := p.estimateSpend(ctx, content, batch).InputTokens, bare.InputTokens+2*int(translator.EstimateTokens(note)); got < want {
+		t.Errorf("input tokens with notes = %d, want at least %d", got, want)
+	}
+}
+
+func TestTranslateResumeRetriesFailedSegments(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	// Every response drops its last segment, so each chapter keeps one failure
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--provider-option", "drop_every=1", "--cache-dir", t.TempDir())
+
+	translationJournal, err := journal.Open(unpackedPath)
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	failed := 0
+	for _, segment := range translationJournal.Segments() {
+		if segment.Status == journal.StatusFailed {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Fatalf("journal has %d failed segments, want 2", failed)
+	}
+
+	var out bytes.Buffer
+	Root.SetOut(&out)
+	t.Cleanup(func() { Root.SetOut(nil) })
+	runCommand(t, "status", unpackedPath)
+	if !strings.Contains(out.String(), "--resume\" to retry or translate 2 failed, pending and untranslated segments") {
+		t.Errorf("status output does not offer to resume:\n%s", out.String())
+	}
+
+	// The resumed run reuses the mock provider recorded in the journal
+	runCommand(t, "translate", unpackedPath, "--resume", "--cache-dir", t.TempDir())
+
+	packedPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", unpackedPath, "--output", packedPath)
+
+	assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+}
+
+// interruptRun cancels the run of the interrupting provider.
+var interruptRun context.CancelFunc
+
+func init() {
+	translator.Register("interrupting-mock", func(cfg *translator.Config) (translator.Translator, error) {
+		mock, err := translator.NewMock(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &interruptingTranslator{Mock: mock}, nil
+	})
+}
+
+// interruptingTranslator is a mock that interrupts the run after answering
+// its first request, like a Ctrl-C in the middle of a book.
+type interruptingTranslator struct {
+	*translator.Mock
+}
+
+func (i *interruptingTranslator) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	defer interruptRun()
+	return i.Mock.Translate(ctx, promptPreset, content, source, target, bookName)
+}
+
+func TestTranslateResumeFinishesInterruptedRun(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	// A guidelines file keeps translate from asking Gemini to generate one
+	if err := saveGuidelines(unpackedPath, "Translate from %[1]s to %[2]s."); err != nil {
+		t.Fatalf("saveGuidelines() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interruptRun = cancel
+	err := executeCommand(ctx, "translate", unpackedPath, "--provider", "interrupting-mock", "--no-cache")
+	if err == nil {
+		t.Fatal("interrupted translate returned no error")
+	}
+
+	var out bytes.Buffer
+	Root.SetOut(&out)
+	t.Cleanup(func() { Root.SetOut(nil) })
+	runCommand(t, "status", unpackedPath)
+	if !strings.Contains(out.String(), "--resume\" to retry or translate") {
+		t.Errorf("status output does not offer to resume:\n%s", out.String())
+	}
+
+	runCommand(t, "translate", unpackedPath, "--resume", "--provider", "mock", "--no-cache")
+
+	packedPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", unpackedPath, "--output", packedPath)
+
+	assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+}
+
+func TestTranslateProtocolsMatchSegments(t *testing.T) {
+	for _, protocol := range []string{protocolJSON, protocolTags} {
+		t.Run(protocol, func(t *testing.T) {
+			unpackedPath := unpackAndMark(t)
+
+			// Reversed segments still reach their own elements
+			runCommand(t, "translate", unpackedPath, "--provider", "mock", "--protocol", protocol, "--provider-option", "reorder_every=1", "--cache-dir", t.TempDir())
+
+			packedPath := filepath.Join(t.TempDir(), "translated.epub")
+			runCommand(t, "pack", unpackedPath, "--output", packedPath)
+			assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+		})
+	}
+}
+
+func TestTranslateProtocolsRejectUnknownSegments(t *testing.T) {
+	for _, protocol := range []string{protocolJSON, protocolTags} {
+		t.Run(protocol, func(t *testing.T) {
+			unpackedPath := unpackAndMark(t)
+
+			// Every response answers its first segment under an id or index that was not asked for
+			runCommand(t, "translate", unpackedPath, "--provider", "mock", "--protocol", protocol, "--provider-option", "rename_every=1", "--cache-dir", t.TempDir())
+
+			translationJournal, err := journal.Open(unpackedPath)
+			if err != nil {
+				t.Fatalf("journal.Open() error = %v", err)
+			}
+			failed := 0
+			for _, segment := range translationJournal.Segments() {
+				if segment.Status == journal.StatusFailed {
+					failed++
+				}
+			}
+			if failed != 2 {
+				t.Errorf("journal has %d failed segments, want 2", failed)
+			}
+
+			for _, chapter := range []string{"chapter1.xhtml", "chapter2.xhtml"} {
+				doc, err := util.OpenAndReadFile(filepath.Join(unpackedPath, "OEBPS", chapter))
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The first segment of each chapter is the one answered under the wrong key
+				first := doc.Find("[" + util.ContentIdKey + "]").First()
+				if _, ok := first.Attr(util.TranslationByIdKey); ok {
+					t.Errorf("%s: misnamed segment was written", chapter)
+				}
+			}
+
+			runCommand(t, "translate", unpackedPath, "--resume", "--cache-dir", t.TempDir())
+
+			packedPath := filepath.Join(t.TempDir(), "translated.epub")
+			runCommand(t, "pack", unpackedPath, "--output", packedPath)
+			assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+		})
+	}
+}
+
+func TestTranslateBatchRetriesFailedSegments(t *testing.T) {
+	sources := []string{
+		"It was a bright cold day in April.",
+		"The clocks were striking <em>thirteen</em> again.",
+		"Nobody noticed &amp; nobody cared.",
+		"Down in the street little eddies of wind were whirling dust.",
+	}
+	batch := translationBatch{}
+	for i, source := range sources {
+		batch.elements = append(batch.elements, elementToTranslate{contentID: fmt.Sprintf("id-%d", i), content: source})
+	}
+
+	tests := []struct {
+		name     string
+		protocol string
+		options  map[string]string
+		want     []bool // whether each element ends up translated
+		calls    int
+	}{
+		{
+			// The first segment comes back misnumbered and is retried on its own
+			name:     "bisect renamed segment",
+			protocol: protocolTags,
+			options:  map[string]string{"rename_every": "2"},
+			want:     []bool{true, true, true, true},
+			calls:    2,
+		},
+		{
+			// Every response renames its first segment and drops its last, so the
+			// two failures are retried as halves and fail again on their own
+			name:     "bisect down to single elements",
+			protocol: protocolJSON,
+			options:  map[string]string{"drop_every": "1", "rename_every": "1"},
+			want:     []bool{false, true, true, false},
+			calls:    3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := translator.NewMock(&translator.Config{Options: tt.options})
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Spend the first call so the faults hit the batch, not its retries
+			if _, err := m.Translate(context.Background(), "technical", "warm up", "English", "Vietnamese", "Book"); err != nil {
+				t.Fatal(err)
+			}
+
+			p := newTranslationPipeline(m, ratelimit.New(0, 0), "Book", "technical", 1)
+			p.protocol = tt.protocol
+			prompt, err := batchPrompt(p.protocol, batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx := context.Background()
+			if p.protocol == protocolJSON {
+				ctx = translator.WithJSONResponse(ctx)
+			}
+			var estimate budget.Spend
+			translations, err := p.translateBatch(ctx, filepath.Join(t.TempDir(), "chapter.xhtml"), batch, prompt, &estimate)
+			if err != nil {
+				t.Fatalf("translateBatch() error = %v", err)
+			}
+
+			for i, element := range batch.elements {
+				if !tt.want[i] {
+					if translations[i] != "" {
+						t.Errorf("segment %d = %q, want untranslated", i, translations[i])
+					}
+					continue
+				}
+				if translations[i] != translator.PseudoLocalize(element.content) {
+					t.Errorf("segment %d = %q, want %q", i, translations[i], translator.PseudoLocalize(element.content))
+				}
+			}
+			if got := m.Calls() - 1; got != tt.calls {
+				t.Errorf("translator calls = %d, want %d", got, tt.calls)
+			}
+		})
+	}
+}
+
+func TestTranslateBatchDoesNotCacheRejectedResponses(t *testing.T) {
+	batch := translationBatch{elements: []elementToTranslate{
+		{contentID: "a", content: "It was a bright cold day in April."},
+		{contentID: "b", content: "The clocks were striking <em>thirteen</em> again."},
+	}}
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.Open() error = %v", err)
+	}
+
+	translate := func(options map[string]string) []string {
+		mock, err := translator.NewMock(&translator.Config{Options: options})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := newTranslationPipeline(translator.NewCached(mock, store, "mock"), ratelimit.New(0, 0), "Book", "technical", 1)
+		p.protocol = protocolJSON
+		prompt, err := batchPrompt(p.protocol, batch)
+		if err != nil {
+			t.Fatal(err)
+		}
+		translations, err := p.translateBatch(translator.WithJSONResponse(context.Background()), filepath.Join(t.TempDir(), "chapter.xhtml"), batch, prompt, &budget.Spend{})
+		if err != nil {
+			t.Fatalf("translateBatch() error = %v", err)
+		}
+		return translations
+	}
+
+	// Every response drops its last segment, so b stays untranslated
+	if translations := translate(map[string]string{"drop_every": "1"}); translations[1] != "" {
+		t.Fatalf("translation of b = %q, want it dropped", translations[1])
+	}
+
+	// A later attempt asks again instead of replaying the dropped responses
+	translations := translate(nil)
+	for i, element := range batch.elements {
+		if translations[i] != translator.PseudoLocalize(element.content) {
+			t.Errorf("segment %s = %q, want %q", element.contentID, translations[i], translator.PseudoLocalize(element.content))
+		}
+	}
+}
+
+// scriptedTranslator answers each request with the next of its responses and
+// records the prompts it was sent.
+type scriptedTranslator struct {
+	responses []string
+	prompts   []string
+}
+
+func (s *scriptedTranslator) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	s.prompts = append(s.prompts, content)
+	if len(s.prompts) > len(s.responses) {
+		return "", fmt.Errorf("unexpected request %d", len(s.prompts))
+	}
+	return s.responses[len(s.prompts)-1], nil
+}
+
+func (s *scriptedTranslator) CountTokens(ctx context.Context, content string) (float32, error) {
+	return translator.EstimateTokens(content), nil
+}
+
+func TestTranslateBatchRepairsInvalidTranslation(t *testing.T) {
+	batch := translationBatch{elements: []elementToTranslate{
+		{contentID: "a", content: "It was a bright cold day in April."},
+		{contentID: "b", content: "The clocks were striking <em>thirteen</em> again."},
+	}}
+	scripted := &scriptedTranslator{responses: []string{
+		`{"segments": [{"id": "a", "text": "Trời sáng và lạnh."}, {"id": "b", "text": "Đồng hồ điểm mười ba giờ."}]}`,
+		`{"segments": [{"id": "b", "text": "Đồng hồ lại điểm mười ba giờ."}]}`,
+		`{"segments": [{"id": "b", "text": "Đồng hồ lại điểm <em>mười ba</em> giờ."}]}`,
+	}}
+
+	p := newTranslationPipeline(scripted, ratelimit.New(0, 0), "Book", "technical", 1)
+	p.protocol = protocolJSON
+	prompt, err := batchPrompt(p.protocol, batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var estimate budget.Spend
+	translations, err := p.translateBatch(context.Background(), filepath.Join(t.TempDir(), "chapter.xhtml"), batch, prompt, &estimate)
+	if err != nil {
+		t.Fatalf("translateBatch() error = %v", err)
+	}
+
+	want := []string{"Trời sáng và lạnh.", "Đồng hồ lại điểm <em>mười ba</em> giờ."}
+	if !slices.Equal(translations, want) {
+		t.Errorf("translations = %q, want %q", translations, want)
+	}
+
+	// The untagged translation is retried on its own, then repaired
+	if len(scripted.prompts) != 3 {
+		t.Fatalf("translator got %d requests, want 3", len(scripted.prompts))
+	}
+	if strings.Contains(scripted.prompts[1], `"id": "a"`) {
+		t.Errorf("retry resent the valid segment:\n%s", scripted.prompts[1])
+	}
+	if !strings.Contains(scripted.prompts[2], "rejected because its HTML tags differ from the source:\n\nĐồng hồ lại điểm mười ba giờ.") {
+		t.Errorf("repair prompt does not show the rejected translation:\n%s", scripted.prompts[2])
+	}
+	if estimate.InputTokens == 0 {
+		t.Error("retries reserved no budget")
+	}
+}
+
+func TestTranslateStopsAtBudgetAndResumes(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	// No batch fits in a single input token, so every batch is left pending
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--max-input-tokens", "1", "--cache-dir", t.TempDir())
+
+	translationJournal, err := journal.Open(unpackedPath)
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	for _, batch := range translationJournal.Batches() {
+		if batch.Status != journal.StatusPending || batch.Attempts != 0 {
+			t.Errorf("batch %s of %s is %s after %d attempts, want pending and unsent", batch.ID, batch.File, batch.Status, batch.Attempts)
+		}
+	}
+	if _, err := os.Stat(budget.Path(unpackedPath)); !os.IsNotExist(err) {
+		t.Errorf("spend record exists after a run that sent nothing: %v", err)
+	}
+
+	runCommand(t, "translate", unpackedPath, "--resume", "--cache-dir", t.TempDir())
+
+	spend, err := budget.Open(unpackedPath, budget.Limits{})
+	if err != nil {
+		t.Fatalf("budget.Open() error = %v", err)
+	}
+	if total := spend.Total(); total.InputTokens == 0 || total.OutputTokens == 0 {
+		t.Errorf("spend record has no usage after the resumed run: %+v", total)
+	}
+
+	packedPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", unpackedPath, "--output", packedPath)
+
+	assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+}
+
+func TestTranslateRejectsMaxCostForUnpricedModel(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	err := executeCommand(context.Background(), "translate", unpackedPath, "--provider", "mock", "--max-cost", "1", "--cache-dir", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "no known price") {
+		t.Errorf("translate error = %v, want the cost cap refused", err)
+	}
+}
+
+func TestTranslateGlossaryStrictSkipsViolations(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	// The mock pseudo-localises every word, so a do-not-translate term is always violated
+	glossaryPath := filepath.Join(unpackedPath, "META-INF", "glossary.csv")
+	if err := os.WriteFile(glossaryPath, []byte("source,target,pos,notes,do_not_translate\nApril,,noun,,true\n"), 0644); err != nil {
+		t.Fatalf("write glossary: %v", err)
+	}
+
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--glossary-strict", "--cache-dir", t.TempDir())
+
+	doc, err := util.OpenAndReadFile(filepath.Join(unpackedPath, "OEBPS", "chapter1.xhtml"))
+	if err != nil {
+		t.Fatalf("read chapter: %v", err)
+	}
+	doc.Find("[" + util.ContentIdKey + "]").Each(func(i int, s *goquery.Selection) {
+		_, translated := s.Attr(util.TranslationByIdKey)
+		if hasTerm := strings.Contains(s.Text(), "April"); translated == hasTerm {
+			t.Errorf("element %q translated = %v, want %v", s.Text(), translated, !hasTerm)
+		}
+	})
+
+	translationJournal, err := journal.Open(unpackedPath)
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	failed := 0
+	for _, segment := range translationJournal.Segments() {
+		if segment.Status == journal.StatusFailed {
+			failed++
+		}
+	}
+	if failed != 1 {
+		t.Errorf("journal has %d failed segments, want 1", failed)
+	}
+}
+
+func TestTranslateSummarizesChapters(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--summarize", "--cache-dir", t.TempDir())
+
+	summaries, err := summary.Load(unpackedPath)
+	if err != nil {
+		t.Fatalf("summary.Load() error = %v", err)
+	}
+	var files []string
+	for _, chapter := range summaries.Chapters {
+		files = append(files, chapter.File)
+		if !strings.HasPrefix(chapter.Summary, "Mock completion of") {
+			t.Errorf("summary of %s = %q, want the mock's completion", chapter.File, chapter.Summary)
+		}
+	}
+	if want := []string{"OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml"}; !slices.Equal(files, want) {
+		t.Fatalf("summarized files = %q, want %q", files, want)
+	}
+
+	// Existing summaries, edited or not, are kept
+	summaries.Set(summary.Chapter{File: "OEBPS/chapter1.xhtml", Summary: "Edited by hand."}, files)
+	if err := summaries.Save(); err != nil {
+		t.Fatal(err)
+	}
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--summarize", "--cache-dir", t.TempDir())
+
+	again, err := summary.Load(unpackedPath)
+	if err != nil {
+		t.Fatalf("summary.Load() error = %v", err)
+	}
+	if chapter, _ := again.Get("OEBPS/chapter1.xhtml"); chapter.Summary != "Edited by hand." {
+		t.Errorf("summary of chapter 1 = %q, want the edited one kept", chapter.Summary)
+	}
+}
+
+func TestTranslateReusesTranslationMemory(t *testing.T) {
+	memoryPath := filepath.Join(t.TempDir(), "memory.jsonl")
+
+	first := unpackAndMark(t)
+	runCommand(t, "translate", first, "--provider", "mock", "--tm", memoryPath, "--cache-dir", t.TempDir())
+
+	exportPath := filepath.Join(t.TempDir(), "memory.tmx")
+	runCommand(t, "tm", "export", "--tm", memoryPath, "-o", exportPath)
+
+	// A second copy of the book is translated entirely from a memory imported
+	// from TMX, so the provider is never called
+	importedPath := filepath.Join(t.TempDir(), "imported.jsonl")
+	runCommand(t, "tm", "import", exportPath, "--tm", importedPath)
+
+	second := unpackAndMark(t)
+	runCommand(t, "translate", second, "--provider", "mock", "--provider-option", "rate_limit_every=1", "--tm", importedPath, "--cache-dir", t.TempDir())
+
+	packedPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", second, "--output", packedPath)
+
+	assertPseudoTranslated(t, packedPath, "OEBPS/chapter1.xhtml", "OEBPS/chapter2.xhtml")
+}
+
+func TestTranslateValidatesTranslationMemoryMatches(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+
+	memoryPath := filepath.Join(t.TempDir(), "memory.jsonl")
+	memory, err := tm.Open(memoryPath)
+	if err != nil {
+		t.Fatalf("tm.Open() error = %v", err)
+	}
+	for _, entry := range []tm.Entry{
+		{Source: "It was a bright cold day in April.", Target: "Trời sáng và lạnh."},
+		// Loses the inline tags of the source, so it is translated again
+		{Source: "The clocks were striking <em>thirteen</em> again.", Target: "Đồng hồ lại điểm mười ba giờ."},
+	} {
+		entry.SourceLang, entry.TargetLang = "English", "Vietnamese"
+		if err := memory.Add(entry); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--tm", memoryPath, "--cache-dir", t.TempDir())
+
+	chapter, err := os.ReadFile(filepath.Join(unpackedPath, "OEBPS", "chapter1.xhtml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(chapter), "Trời sáng và lạnh.") {
+		t.Errorf("the valid match was not reused:\n%s", chapter)
+	}
+	if strings.Contains(string(chapter), "Đồng hồ lại điểm mười ba giờ.") {
+		t.Errorf("the match without the source tags was reused:\n%s", chapter)
+	}
+
+	j, err := journal.Open(unpackedPath)
+	if err != nil {
+		t.Fatalf("journal.Open() error = %v", err)
+	}
+	var reused []journal.Batch
+	for _, batch := range j.Batches() {
+		if batch.Provider == "memory" {
+			reused = append(reused, batch)
+		}
+	}
+	if len(reused) != 1 || reused[0].Status != journal.StatusDone || len(reused[0].ContentIDs) != 1 {
+		t.Errorf("journal records %+v for the reused match, want one done batch of one segment", reused)
+	}
+}
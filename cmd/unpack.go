@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"archive/zip"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -29,8 +30,14 @@ var Unpack = &cobra.Command{
 		if err != nil {
 			return fmt.Errorf("failed to determine unzip destination: %w", err)
 		}
+		limits := unpackLimits{}
+		maxSize, _ := cmd.Flags().GetInt64("max-size")
+		limits.totalSize = maxSize << 20
+		limits.entries, _ = cmd.Flags().GetInt("max-entries")
+		limits.ratio, _ = cmd.Flags().GetFloat64("max-ratio")
+
 		cmd.Println("Unzipping to:", unzipPath)
-		if err := unzipBook(zipPath, unzipPath, func(format string, a ...interface{}) error {
+		if err := unzipBook(zipPath, unzipPath, limits, func(format string, a ...interface{}) error {
 			cmd.Printf(format, a...)
 			return nil
 		}); err != nil {
@@ -42,49 +49,162 @@ var Unpack = &cobra.Command{
 	},
 }
 
-func unzipBook(source, destination string, progress func(format string, a ...interface{}) error) error {
+func init() {
+	Unpack.Flags().Int64("max-size", defaultUnpackLimits.totalSize>>20, "maximum total uncompressed size in MiB, 0 for no limit")
+	Unpack.Flags().Int("max-entries", defaultUnpackLimits.entries, "maximum number of entries in the archive, 0 for no limit")
+	Unpack.Flags().Float64("max-ratio", defaultUnpackLimits.ratio, "maximum compression ratio of an entry larger than 1 MiB, 0 for no limit")
+}
+
+// Errors for archives that unpack refuses to extract, wrapped in an
+// *unpackError naming the entry.
+var (
+	errUnsafePath       = errors.New("path is absolute or escapes the destination")
+	errSymlink          = errors.New("symbolic links are not allowed")
+	errTooManyEntries   = errors.New("archive has too many entries")
+	errTooLarge         = errors.New("archive is too large when uncompressed")
+	errCompressionRatio = errors.New("entry is compressed suspiciously well")
+)
+
+// unpackError is an archive entry that unpack refuses to extract.
+type unpackError struct {
+	entry string
+	err   error
+}
+
+func (e *unpackError) Error() string {
+	if e.entry == "" {
+		return e.err.Error()
+	}
+	return fmt.Sprintf("%s: %v", e.entry, e.err)
+}
+
+func (e *unpackError) Unwrap() error {
+	return e.err
+}
+
+// unpackLimits bound what unzipBook extracts, so a crafted archive cannot fill
+// the disk. A zero limit is not enforced.
+type unpackLimits struct {
+	totalSize int64   // uncompressed bytes of all entries
+	entries   int     // number of entries
+	ratio     float64 // uncompressed to compressed size of an entry
+}
+
+var defaultUnpackLimits = unpackLimits{
+	totalSize: 1 << 30,
+	entries:   10000,
+	ratio:     100,
+}
+
+// ratioMinSize is the size below which the compression ratio is not checked:
+// small files of repeated markup compress well and cannot do harm.
+const ratioMinSize = 1 << 20
+
+func unzipBook(source, destination string, limits unpackLimits, progress func(format string, a ...interface{}) error) error {
 	r, err := zip.OpenReader(source)
 	if err != nil {
 		return fmt.Errorf("failed to open zip file: %w", err)
 	}
 	defer r.Close()
 
+	// Check every entry before writing anything, so a rejected archive leaves
+	// nothing behind
+	if err := checkArchive(r.File, limits); err != nil {
+		return err
+	}
+
 	if err := os.MkdirAll(destination, os.ModePerm); err != nil {
 		return fmt.Errorf("failed to create destination directory: %w", err)
 	}
 
+	var written int64
 	for _, f := range r.File {
-		if err := extractFile(f, destination, progress); err != nil {
+		n, err := extractFile(f, destination, limits.remaining(written), progress)
+		if err != nil {
 			return fmt.Errorf("failed to extract file %s: %w", f.Name, err)
 		}
+		written += n
 	}
 	return nil
 }
 
-func extractFile(f *zip.File, destination string, progress func(format string, a ...interface{}) error) error {
+// remaining returns how many more bytes may be extracted after written, or -1
+// when the total size is not limited.
+func (l unpackLimits) remaining(written int64) int64 {
+	if l.totalSize <= 0 {
+		return -1
+	}
+	return l.totalSize - written
+}
+
+// checkArchive rejects archives with unsafe entries or beyond limits, going by
+// the sizes recorded in the archive.
+func checkArchive(files []*zip.File, limits unpackLimits) error {
+	if limits.entries > 0 && len(files) > limits.entries {
+		return &unpackError{err: fmt.Errorf("%w: %d entries, limit is %d", errTooManyEntries, len(files), limits.entries)}
+	}
+
+	var total uint64
+	for _, f := range files {
+		if !filepath.IsLocal(filepath.FromSlash(f.Name)) {
+			return &unpackError{entry: f.Name, err: errUnsafePath}
+		}
+		if f.Mode()&os.ModeSymlink != 0 {
+			return &unpackError{entry: f.Name, err: errSymlink}
+		}
+
+		total += f.UncompressedSize64
+		if limits.totalSize > 0 && total > uint64(limits.totalSize) {
+			return &unpackError{err: fmt.Errorf("%w: more than %d bytes", errTooLarge, limits.totalSize)}
+		}
+
+		if limits.ratio > 0 && f.UncompressedSize64 > ratioMinSize {
+			ratio := float64(f.UncompressedSize64) / float64(max(f.CompressedSize64, 1))
+			if ratio > limits.ratio {
+				return &unpackError{entry: f.Name, err: fmt.Errorf("%w: ratio %.0f, limit is %.0f", errCompressionRatio, ratio, limits.ratio)}
+			}
+		}
+	}
+	return nil
+}
+
+// extractFile writes f under destination and returns the number of bytes
+// written. At most limit bytes are written, unless limit is negative.
+func extractFile(f *zip.File, destination string, limit int64, progress func(format string, a ...interface{}) error) (int64, error) {
 	progress("Unzipping file: %s\n", f.Name)
-	fpath := filepath.Join(destination, f.Name)
+	fpath := filepath.Join(destination, filepath.FromSlash(f.Name))
 
 	if f.FileInfo().IsDir() {
-		return os.MkdirAll(fpath, os.ModePerm)
+		return 0, os.MkdirAll(fpath, os.ModePerm)
 	}
 
 	if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-		return err
+		return 0, err
 	}
 
-	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode().Perm())
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer outFile.Close()
 
 	rc, err := f.Open()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer rc.Close()
 
-	_, err = io.Copy(outFile, rc)
-	return err
+	// The recorded size was checked, but the data is what fills the disk
+	var reader io.Reader = rc
+	if limit >= 0 {
+		reader = io.LimitReader(rc, limit+1)
+	}
+	n, err := io.Copy(outFile, reader)
+	if err != nil {
+		return n, err
+	}
+	if limit >= 0 && n > limit {
+		return n, &unpackError{entry: f.Name, err: fmt.Errorf("%w: size limit reached while extracting", errTooLarge)}
+	}
+	return n, nil
 }
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// craftedEntry is an archive entry written as is, without the checks of a
+// well-behaved archiver.
+type craftedEntry struct {
+	name    string
+	content []byte
+	mode    os.FileMode
+}
+
+func writeCraftedArchive(t *testing.T, entries ...craftedEntry) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		header := &zip.FileHeader{Name: entry.name, Method: zip.Deflate}
+		if entry.mode != 0 {
+			header.SetMode(entry.mode)
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatalf("create entry %s: %v", entry.name, err)
+		}
+		if _, err := f.Write(entry.content); err != nil {
+			t.Fatalf("write entry %s: %v", entry.name, err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "crafted.epub")
+	if err := os.WriteFile(archivePath, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestUnzipBookRejectsCraftedArchives(t *testing.T) {
+	mimetype := craftedEntry{name: "mimetype", content: []byte("application/epub+zip")}
+
+	tests := []struct {
+		name    string
+		entries []craftedEntry
+		limits  unpackLimits
+		want    error
+	}{
+		{
+			name:    "parent traversal",
+			entries: []craftedEntry{mimetype, {name: "../evil.txt", content: []byte("evil")}},
+			limits:  defaultUnpackLimits,
+			want:    errUnsafePath,
+		},
+		{
+			name:    "nested traversal",
+			entries: []craftedEntry{mimetype, {name: "OEBPS/../../evil.txt", content: []byte("evil")}},
+			limits:  defaultUnpackLimits,
+			want:    errUnsafePath,
+		},
+		{
+			name:    "absolute path",
+			entries: []craftedEntry{mimetype, {name: "/tmp/evil.txt", content: []byte("evil")}},
+			limits:  defaultUnpackLimits,
+			want:    errUnsafePath,
+		},
+		{
+			name:    "symlink",
+			entries: []craftedEntry{mimetype, {name: "OEBPS/link", content: []byte("/etc/passwd"), mode: os.ModeSymlink | 0777}},
+			limits:  defaultUnpackLimits,
+			want:    errSymlink,
+		},
+		{
+			name:    "too many entries",
+			entries: []craftedEntry{mimetype, {name: "a.txt"}, {name: "b.txt"}},
+			limits:  unpackLimits{entries: 2},
+			want:    errTooManyEntries,
+		},
+		{
+			name:    "too large",
+			entries: []craftedEntry{mimetype, {name: "big.txt", content: bytes.Repeat([]byte("x"), 4096)}},
+			limits:  unpackLimits{totalSize: 1024},
+			want:    errTooLarge,
+		},
+		{
+			name:    "compression bomb",
+			entries: []craftedEntry{mimetype, {name: "zeros.bin", content: make([]byte, 4<<20)}},
+			limits:  defaultUnpackLimits,
+			want:    errCompressionRatio,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archivePath := writeCraftedArchive(t, tt.entries...)
+			destination := filepath.Join(t.TempDir(), "out", "book")
+
+			err := unzipBook(archivePath, destination, tt.limits, func(string, ...interface{}) error { return nil })
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("unzipBook() error = %v, want %v", err, tt.want)
+			}
+			var unpackErr *unpackError
+			if !errors.As(err, &unpackErr) {
+				t.Errorf("unzipBook() error = %T, want *unpackError", err)
+			}
+
+			// Nothing is extracted from a rejected archive
+			if _, err := os.Stat(filepath.Dir(destination)); !os.IsNotExist(err) {
+				t.Errorf("rejected archive was extracted: stat = %v", err)
+			}
+		})
+	}
+}
+
+func TestUnzipBookWithinLimits(t *testing.T) {
+	archivePath := writeCraftedArchive(t,
+		craftedEntry{name: "mimetype", content: []byte("application/epub+zip")},
+		craftedEntry{name: "OEBPS/", mode: os.ModeDir | 0755},
+		craftedEntry{name: "OEBPS/zeros.bin", content: make([]byte, 4<<20)},
+	)
+	destination := filepath.Join(t.TempDir(), "book")
+
+	// Limits of zero are not enforced
+	if err := unzipBook(archivePath, destination, unpackLimits{}, func(string, ...interface{}) error { return nil }); err != nil {
+		t.Fatalf("unzipBook() error = %v", err)
+	}
+	info, err := os.Stat(filepath.Join(destination, "OEBPS", "zeros.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 4<<20 {
+		t.Errorf("extracted size = %d, want %d", info.Size(), 4<<20)
+	}
+}
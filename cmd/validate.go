@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/validator"
+	"github.com/spf13/cobra"
+)
+
+var Validate = &cobra.Command{
+	Use:   "validate [epubPath|unpackedEpubPath]",
+	Short: "Check that an EPUB file or unpacked EPUB is well-formed",
+	Long: `This command checks the OCF container and mimetype entry, that every manifest item exists and every spine itemref
+resolves, that XHTML documents are well-formed XML without duplicate IDs, that internal links and anchors resolve,
+and that the nav document or NCX is present. It exits with status 1 when it finds errors, so it can gate a CI job.`,
+	Example: `epubtrans validate book-translated.epub
+epubtrans validate path/to/unpacked/epub --json`,
+	Args: func(cmd *cobra.Command, args []string) error {
+		if len(args) != 1 {
+			return fmt.Errorf("epubPath is required. Please provide the path to an EPUB file or an unpacked EPUB directory.")
+		}
+
+		if _, err := os.Stat(args[0]); err != nil {
+			return fmt.Errorf("cannot access %s: %w", args[0], err)
+		}
+		return nil
+	},
+	RunE: runValidate,
+}
+
+func init() {
+	Validate.Flags().Bool("json", false, "print the report as JSON")
+}
+
+func runValidate(cmd *cobra.Command, args []string) error {
+	report, err := validator.ValidatePath(args[0])
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(struct {
+			Path     string            `json:"path"`
+			Valid    bool              `json:"valid"`
+			Errors   int               `json:"errors"`
+			Warnings int               `json:"warnings"`
+			Issues   []validator.Issue `json:"issues"`
+		}{args[0], report.Errors() == 0, report.Errors(), report.Warnings(), report.Issues})
+		if err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		for _, issue := range report.Issues {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", severityLabel(issue.Severity), issue.Check, issue.File, issue.Message)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if len(report.Issues) > 0 {
+			fmt.Fprintln(out)
+		}
+		fmt.Fprintf(out, "%s: %d errors, %d warnings\n", args[0], report.Errors(), report.Warnings())
+	}
+
+	if report.Errors() > 0 {
+		// The report already explains the failure.
+		cmd.SilenceUsage = true
+		return fmt.Errorf("%s is not a valid EPUB: %d errors", args[0], report.Errors())
+	}
+	return nil
+}
+
+func severityLabel(severity validator.Severity) string {
+	if severity == validator.SeverityError {
+		return "ERROR"
+	}
+	return "WARNING"
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePackedTranslation(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	runCommand(t, "translate", unpackedPath, "--provider", "mock", "--cache-dir", t.TempDir())
+
+	// The test book has no navigation document; give it one so the packed book is valid
+	nav := `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><head><title>Contents</title></head><body>
+<nav epub:type="toc"><ol><li><a href="chapter1.xhtml">One</a></li><li><a href="chapter2.xhtml">Two</a></li></ol></nav>
+</body></html>`
+	if err := os.WriteFile(filepath.Join(unpackedPath, "OEBPS", "nav.xhtml"), []byte(nav), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opfPath := filepath.Join(unpackedPath, "OEBPS", "package.opf")
+	opf, err := os.ReadFile(opfPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opf = bytes.Replace(opf, []byte("<manifest>"), []byte(`<manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>`), 1)
+	if err := os.WriteFile(opfPath, opf, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	epubPath := filepath.Join(t.TempDir(), "translated.epub")
+	runCommand(t, "pack", unpackedPath, "--output", epubPath)
+
+	var buf bytes.Buffer
+	Root.SetOut(&buf)
+	t.Cleanup(func() { Root.SetOut(nil) })
+
+	runCommand(t, "validate", epubPath, "--json")
+
+	var report struct {
+		Valid    bool `json:"valid"`
+		Errors   int  `json:"errors"`
+		Warnings int  `json:"warnings"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v\n%s", err, buf.String())
+	}
+	if !report.Valid || report.Errors != 0 || report.Warnings != 0 {
+		t.Errorf("validate report = %+v, want a valid book without warnings:\n%s", report, buf.String())
+	}
+}
+
+func TestValidateFailsOnErrors(t *testing.T) {
+	unpackedPath := unpackAndMark(t)
+	if err := os.Remove(filepath.Join(unpackedPath, "OEBPS", "chapter2.xhtml")); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	Root.SetOut(&buf)
+	Root.SetErr(&buf)
+	t.Cleanup(func() {
+		Root.SetOut(nil)
+		Root.SetErr(nil)
+	})
+
+	Validate.Flags().Set("json", "false")
+	Root.SetArgs([]string{"validate", unpackedPath})
+	if err := Root.Execute(); err == nil {
+		t.Fatalf("validate succeeded on a book with a missing chapter:\n%s", buf.String())
+	}
+
+	output := buf.String()
+	for _, want := range []string{
+		"ERROR  manifest    OEBPS/chapter2.xhtml",
+		"ERROR  navigation  OEBPS/package.opf",
+		"2 errors",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("output does not contain %q:\n%s", want, output)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package budget enforces spending caps on a translate run and keeps a
+// running total of what has been spent on each book.
+package budget
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// FileName is the location of the spend record relative to the unpacked book.
+const FileName = "META-INF/translation-spend.json"
+
+// ErrExceeded is returned by Reserve once a cap would be exceeded.
+var ErrExceeded = errors.New("translation budget exceeded")
+
+// Limits caps the spend of a single run. Zero values mean no limit.
+type Limits struct {
+	MaxCost         float64
+	MaxInputTokens  int
+	MaxOutputTokens int
+}
+
+// Spend is an amount of tokens and money.
+type Spend struct {
+	InputTokens  int     `json:"input_tokens"`
+	OutputTokens int     `json:"output_tokens"`
+	Cost         float64 `json:"cost"`
+}
+
+func (s *Spend) add(other Spend) {
+	s.InputTokens += other.InputTokens
+	s.OutputTokens += other.OutputTokens
+	s.Cost += other.Cost
+}
+
+func (s *Spend) sub(other Spend) {
+	s.InputTokens -= other.InputTokens
+	s.OutputTokens -= other.OutputTokens
+	s.Cost -= other.Cost
+}
+
+type spendFile struct {
+	Total     Spend            `json:"total"`
+	Models    map[string]Spend `json:"models"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// Tracker reserves the estimated spend of a request before it is sent and
+// records its real usage afterwards. It is safe for concurrent use.
+type Tracker struct {
+	path   string
+	limits Limits
+
+	mu        sync.Mutex
+	book      spendFile
+	run       Spend
+	reserved  Spend
+	exhausted error
+}
+
+// Path returns the spend record location for the book unpacked at unzipPath.
+func Path(unzipPath string) string {
+	return filepath.Join(unzipPath, FileName)
+}
+
+// Open loads the spend record of the book unpacked at unzipPath and applies
+// limits to the current run.
+func Open(unzipPath string, limits Limits) (*Tracker, error) {
+	t := &Tracker{
+		path:   Path(unzipPath),
+		limits: limits,
+		book:   spendFile{Models: make(map[string]Spend)},
+	}
+
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spend record: %w", err)
+	}
+	if err := json.Unmarshal(data, &t.book); err != nil {
+		return nil, fmt.Errorf("failed to parse spend record: %w", err)
+	}
+	if t.book.Models == nil {
+		t.book.Models = make(map[string]Spend)
+	}
+
+	return t, nil
+}
+
+// Reserve sets aside estimate for a request about to be sent. It fails with
+// ErrExceeded if the run's spend, the requests in flight and estimate would
+// together pass a cap; after that every later reservation fails too, so the
+// run stops instead of squeezing in smaller requests.
+func (t *Tracker) Reserve(estimate Spend) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.exhausted != nil {
+		return t.exhausted
+	}
+
+	projected := t.run
+	projected.add(t.reserved)
+	projected.add(estimate)
+
+	switch {
+	case t.limits.MaxCost > 0 && projected.Cost > t.limits.MaxCost:
+		t.exhausted = fmt.Errorf("%w: max cost $%.4f", ErrExceeded, t.limits.MaxCost)
+	case t.limits.MaxInputTokens > 0 && projected.InputTokens > t.limits.MaxInputTokens:
+		t.exhausted = fmt.Errorf("%w: max input tokens %d", ErrExceeded, t.limits.MaxInputTokens)
+	case t.limits.MaxOutputTokens > 0 && projected.OutputTokens > t.limits.MaxOutputTokens:
+		t.exhausted = fmt.Errorf("%w: max output tokens %d", ErrExceeded, t.limits.MaxOutputTokens)
+	default:
+		t.reserved.add(estimate)
+		return nil
+	}
+
+	return t.exhausted
+}
+
+// Commit releases a reservation of estimate and records actual, the usage
+// reported by the provider for model, in the run and the book totals.
+func (t *Tracker) Commit(estimate, actual Spend, model string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.reserved.sub(estimate)
+	t.run.add(actual)
+
+	if actual == (Spend{}) {
+		return nil
+	}
+
+	t.book.Total.add(actual)
+	modelSpend := t.book.Models[model]
+	modelSpend.add(actual)
+	t.book.Models[model] = modelSpend
+	t.book.UpdatedAt = time.Now()
+
+	return t.save()
+}
+
+// Exhausted returns the error that stopped the run, or nil if no cap was hit.
+func (t *Tracker) Exhausted() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.exhausted
+}
+
+// Run returns the spend of the current run.
+func (t *Tracker) Run() Spend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.run
+}
+
+// Total returns the spend of every run on the book, including this one.
+func (t *Tracker) Total() Spend {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.book.Total
+}
+
+func (t *Tracker) save() error {
+	data, err := json.MarshalIndent(t.book, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal spend record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create spend record directory: %w", err)
+	}
+	if err := util.WriteFileAtomic(t.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write spend record: %w", err)
+	}
+
+	return nil
+}
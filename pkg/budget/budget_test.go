@@ -0,0 +1,107 @@
+package budget
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestReserveAndCommit(t *testing.T) {
+	tracker, err := Open(t.TempDir(), Limits{MaxInputTokens: 100})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	first := Spend{InputTokens: 40, OutputTokens: 40}
+	second := Spend{InputTokens: 40, OutputTokens: 40}
+	if err := tracker.Reserve(first); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if err := tracker.Reserve(second); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+
+	// The first request used less than estimated, which frees room for a third
+	if err := tracker.Commit(first, Spend{InputTokens: 10, OutputTokens: 12, Cost: 0.5}, "mock/a"); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if err := tracker.Reserve(Spend{InputTokens: 50}); err != nil {
+		t.Errorf("Reserve() after a cheaper commit error = %v, want room for it", err)
+	}
+
+	want := Spend{InputTokens: 10, OutputTokens: 12, Cost: 0.5}
+	if got := tracker.Run(); got != want {
+		t.Errorf("Run() = %+v, want %+v", got, want)
+	}
+	if got := tracker.Total(); got != want {
+		t.Errorf("Total() = %+v, want %+v", got, want)
+	}
+	if err := tracker.Exhausted(); err != nil {
+		t.Errorf("Exhausted() = %v, want nil", err)
+	}
+}
+
+func TestReserveStopsTheRun(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits Limits
+		spend  Spend
+	}{
+		{"cost", Limits{MaxCost: 1}, Spend{Cost: 0.6}},
+		{"input tokens", Limits{MaxInputTokens: 100}, Spend{InputTokens: 60}},
+		{"output tokens", Limits{MaxOutputTokens: 100}, Spend{OutputTokens: 60}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker, err := Open(t.TempDir(), tt.limits)
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+
+			if err := tracker.Reserve(tt.spend); err != nil {
+				t.Fatalf("Reserve() error = %v", err)
+			}
+			// In-flight reservations count against the cap
+			if err := tracker.Reserve(tt.spend); !errors.Is(err, ErrExceeded) {
+				t.Fatalf("Reserve() past the cap error = %v, want ErrExceeded", err)
+			}
+			if err := tracker.Exhausted(); !errors.Is(err, ErrExceeded) {
+				t.Errorf("Exhausted() = %v, want ErrExceeded", err)
+			}
+
+			// Once exhausted, even a request that fits is refused
+			if err := tracker.Commit(tt.spend, Spend{}, "mock/a"); err != nil {
+				t.Fatalf("Commit() error = %v", err)
+			}
+			if err := tracker.Reserve(Spend{}); !errors.Is(err, ErrExceeded) {
+				t.Errorf("Reserve() after exhaustion error = %v, want ErrExceeded", err)
+			}
+		})
+	}
+}
+
+func TestLimitsApplyPerRun(t *testing.T) {
+	unzipPath := t.TempDir()
+	limits := Limits{MaxCost: 1}
+	spend := Spend{InputTokens: 100, OutputTokens: 100, Cost: 0.8}
+
+	for run := 1; run <= 2; run++ {
+		tracker, err := Open(unzipPath, limits)
+		if err != nil {
+			t.Fatalf("Open() error = %v", err)
+		}
+		// The book's earlier runs do not count against this run's cap
+		if err := tracker.Reserve(spend); err != nil {
+			t.Fatalf("run %d: Reserve() error = %v", run, err)
+		}
+		if err := tracker.Commit(spend, spend, "anthropic/claude-3-5-haiku"); err != nil {
+			t.Fatalf("run %d: Commit() error = %v", run, err)
+		}
+
+		if got := tracker.Run(); got != spend {
+			t.Errorf("run %d: Run() = %+v, want %+v", run, got, spend)
+		}
+		if got, want := tracker.Total().Cost, 0.8*float64(run); got != want {
+			t.Errorf("run %d: Total().Cost = %v, want %v", run, got, want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Entry is a single cached translation.
+type Entry struct {
+	Key         string    `json:"key"`
+	Model       string    `json:"model"`
+	Source      string    `json:"source"`
+	Target      string    `json:"target"`
+	Content     string    `json:"content"`
+	Translation string    `json:"translation"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Stats summarises the contents of a Store.
+type Stats struct {
+	Entries int
+	Bytes   int64
+	Models  map[string]int
+	Oldest  time.Time
+	Newest  time.Time
+}
+
+// Store is a content-addressed translation cache on disk. Each entry is a JSON
+// file named after its key, sharded by the first two characters of the key.
+type Store struct {
+	dir string
+}
+
+// DefaultDir returns the cache location shared by all books of the current user.
+func DefaultDir() (string, error) {
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache directory: %w", err)
+	}
+
+	return filepath.Join(userCacheDir, "epubtrans", "translations"), nil
+}
+
+// Open opens the store in dir, creating the directory if needed.
+func Open(dir string) (*Store, error) {
+	if dir == "" {
+		return nil, errors.New("cache directory cannot be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	return &Store{dir: dir}, nil
+}
+
+// Dir returns the directory backing the store.
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+func (s *Store) entryPath(key string) string {
+	shard := key
+	if len(shard) > 2 {
+		shard = shard[:2]
+	}
+	return filepath.Join(s.dir, shard, key+".json")
+}
+
+// Get returns the entry stored under key.
+func (s *Store) Get(key string) (*Entry, bool) {
+	data, err := os.ReadFile(s.entryPath(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, false
+	}
+
+	return &entry, true
+}
+
+// Put stores entry under entry.Key. The file is written to a temporary name
+// first, so concurrent readers never see a partial entry.
+func (s *Store) Put(entry Entry) error {
+	if entry.Key == "" {
+		return errors.New("cache key cannot be empty")
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cache entry: %w", err)
+	}
+
+	path := s.entryPath(entry.Key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache shard: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), entry.Key+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create cache entry: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Walk calls fn for every entry in the store. Unreadable entries are skipped.
+func (s *Store) Walk(fn func(path string, entry Entry) error) error {
+	return filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil
+		}
+
+		return fn(path, entry)
+	})
+}
+
+// Stats returns entry counts and sizes for the store.
+func (s *Store) Stats() (Stats, error) {
+	stats := Stats{Models: make(map[string]int)}
+
+	err := s.Walk(func(path string, entry Entry) error {
+		stats.Entries++
+		stats.Models[entry.Model]++
+		if info, err := os.Stat(path); err == nil {
+			stats.Bytes += info.Size()
+		}
+		if stats.Oldest.IsZero() || entry.CreatedAt.Before(stats.Oldest) {
+			stats.Oldest = entry.CreatedAt
+		}
+		if entry.CreatedAt.After(stats.Newest) {
+			stats.Newest = entry.CreatedAt
+		}
+		return nil
+	})
+
+	return stats, err
+}
+
+// Prune removes entries created before olderThan. A non-empty model limits
+// pruning to entries produced by that model. It returns the number removed.
+func (s *Store) Prune(olderThan time.Time, model string) (int, error) {
+	removed := 0
+
+	err := s.Walk(func(path string, entry Entry) error {
+		if model != "" && entry.Model != model {
+			return nil
+		}
+		if !entry.CreatedAt.Before(olderThan) {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		removed++
+		return nil
+	})
+
+	return removed, err
+}
+
+// Export writes every entry to w as JSON lines and returns the number written.
+func (s *Store) Export(w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	exported := 0
+
+	err := s.Walk(func(path string, entry Entry) error {
+		if err := encoder.Encode(entry); err != nil {
+			return fmt.Errorf("failed to export entry %s: %w", entry.Key, err)
+		}
+		exported++
+		return nil
+	})
+
+	return exported, err
+}
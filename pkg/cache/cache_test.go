@@ -0,0 +1,192 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var (
+	day1 = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	day2 = time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	day3 = time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)
+)
+
+// testEntries are stored by newTestStore, one per day and two models.
+var testEntries = []Entry{
+	{Key: "aa01", Model: "model-a", Source: "English", Target: "Vietnamese", Content: "<p>One</p>", Translation: "<p>Một</p>", CreatedAt: day1},
+	{Key: "aa02", Model: "model-b", Source: "English", Target: "Vietnamese", Content: "<p>Two</p>", Translation: "<p>Hai</p>", CreatedAt: day2},
+	{Key: "bb03", Model: "model-a", Source: "English", Target: "Vietnamese", Content: "<p>Three</p>", Translation: "<p>Ba</p>", CreatedAt: day3},
+}
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, entry := range testEntries {
+		if err := store.Put(entry); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+	return store
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name       string
+		entries    []Entry
+		wantModels map[string]int
+		wantOldest time.Time
+		wantNewest time.Time
+	}{
+		{
+			name:       "Empty store",
+			entries:    nil,
+			wantModels: map[string]int{},
+		},
+		{
+			name:       "Entries of two models",
+			entries:    testEntries,
+			wantModels: map[string]int{"model-a": 2, "model-b": 1},
+			wantOldest: day1,
+			wantNewest: day3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, err := Open(t.TempDir())
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+			for _, entry := range tt.entries {
+				if err := store.Put(entry); err != nil {
+					t.Fatalf("Put() error = %v", err)
+				}
+			}
+
+			got, err := store.Stats()
+			if err != nil {
+				t.Fatalf("Stats() error = %v", err)
+			}
+			if got.Entries != len(tt.entries) {
+				t.Errorf("Stats().Entries = %d, want %d", got.Entries, len(tt.entries))
+			}
+			if (got.Bytes > 0) != (len(tt.entries) > 0) {
+				t.Errorf("Stats().Bytes = %d for %d entries", got.Bytes, len(tt.entries))
+			}
+			if !reflect.DeepEqual(got.Models, tt.wantModels) {
+				t.Errorf("Stats().Models = %v, want %v", got.Models, tt.wantModels)
+			}
+			if !got.Oldest.Equal(tt.wantOldest) || !got.Newest.Equal(tt.wantNewest) {
+				t.Errorf("Stats() oldest and newest = %v and %v, want %v and %v", got.Oldest, got.Newest, tt.wantOldest, tt.wantNewest)
+			}
+		})
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tests := []struct {
+		name      string
+		olderThan time.Time
+		model     string
+		wantKeys  []string
+	}{
+		{
+			name:      "Nothing older",
+			olderThan: day1,
+			wantKeys:  []string{"aa01", "aa02", "bb03"},
+		},
+		{
+			name:      "Older than a day",
+			olderThan: day2,
+			wantKeys:  []string{"aa02", "bb03"},
+		},
+		{
+			name:      "Everything",
+			olderThan: day3.Add(time.Second),
+			wantKeys:  nil,
+		},
+		{
+			name:      "Only one model",
+			olderThan: day3.Add(time.Second),
+			model:     "model-b",
+			wantKeys:  []string{"aa01", "bb03"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestStore(t)
+
+			removed, err := store.Prune(tt.olderThan, tt.model)
+			if err != nil {
+				t.Fatalf("Prune() error = %v", err)
+			}
+			if want := len(testEntries) - len(tt.wantKeys); removed != want {
+				t.Errorf("Prune() removed %d, want %d", removed, want)
+			}
+
+			var keys []string
+			if err := store.Walk(func(path string, entry Entry) error {
+				keys = append(keys, entry.Key)
+				return nil
+			}); err != nil {
+				t.Fatalf("Walk() error = %v", err)
+			}
+			if !reflect.DeepEqual(keys, tt.wantKeys) {
+				t.Errorf("entries left = %v, want %v", keys, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	store := newTestStore(t)
+
+	var buf bytes.Buffer
+	exported, err := store.Export(&buf)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if exported != len(testEntries) {
+		t.Errorf("Export() = %d, want %d", exported, len(testEntries))
+	}
+
+	// Every exported line restores its entry in a new store
+	restored, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("exported line %q: %v", scanner.Text(), err)
+		}
+		if err := restored.Put(entry); err != nil {
+			t.Fatalf("Put() error = %v", err)
+		}
+	}
+
+	for _, want := range testEntries {
+		got, ok := restored.Get(want.Key)
+		if !ok {
+			t.Errorf("entry %s was not exported", want.Key)
+			continue
+		}
+		if !got.CreatedAt.Equal(want.CreatedAt) {
+			t.Errorf("entry %s created at %v, want %v", want.Key, got.CreatedAt, want.CreatedAt)
+		}
+		got.CreatedAt = want.CreatedAt
+		if *got != want {
+			t.Errorf("entry %s = %+v, want %+v", want.Key, *got, want)
+		}
+	}
+}
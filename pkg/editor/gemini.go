@@ -10,35 +10,53 @@ import (
 	"google.golang.org/genai"
 )
 
-var genAiClient = sync.OnceValue[*genai.Client](func() *genai.Client {
+var genAiClient = sync.OnceValues(func() (*genai.Client, error) {
 	apiKey := os.Getenv("GOOGLE_AI_API_KEY")
 	if apiKey == "" {
-		panic("GOOGLE_AI_API_KEY environment variable must be set")
+		return nil, fmt.Errorf("GOOGLE_AI_API_KEY environment variable must be set")
 	}
 
+	return NewGenAIClient(context.Background(), apiKey, "")
+})
+
+// GenAIClient returns the process-wide Gemini client configured from GOOGLE_AI_API_KEY.
+func GenAIClient() (*genai.Client, error) {
+	return genAiClient()
+}
+
+// NewGenAIClient creates a Gemini API client. An empty baseURL uses the default endpoint.
+func NewGenAIClient(ctx context.Context, apiKey string, baseURL string) (*genai.Client, error) {
 	cfg := &genai.ClientConfig{
 		APIKey:  apiKey,
 		Backend: genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{
+			BaseURL: baseURL,
+		},
 	}
 
-	client, err := genai.NewClient(context.Background(), cfg)
+	client, err := genai.NewClient(ctx, cfg)
 	if err != nil {
-		panic(fmt.Sprintf("failed to create Gemini client: %s", err))
+		return nil, fmt.Errorf("failed to create Gemini client: %w", err)
 	}
 
-	return client
-})
+	return client, nil
+}
 
 type Gemini struct {
 	client *genai.Client
 }
 
-func NewGemini() *Gemini {
-	return &Gemini{client: genAiClient()}
+func NewGemini() (*Gemini, error) {
+	client, err := GenAIClient()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Gemini{client: client}, nil
 }
 
 func (g *Gemini) GenerateGuidelines(ctx context.Context, source string, target string, bookName string) (string, error) {
-	resp, err := genAiClient().Models.GenerateContent(context.Background(),
+	resp, err := g.client.Models.GenerateContent(ctx,
 		"gemini-2.0-flash-thinking-exp-01-21",
 		[]*genai.Content{
 			{
@@ -0,0 +1,253 @@
+package glossary
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Kinds of extracted candidates.
+const (
+	KindCode        = "code"
+	KindAcronym     = "acronym"
+	KindCapitalized = "capitalized"
+	KindPhrase      = "phrase"
+)
+
+// Candidate is a term found by Extract.
+type Candidate struct {
+	Term  string
+	Kind  string
+	Count int
+}
+
+// Entry returns a reviewable glossary entry for c. Code and acronyms default
+// to do-not-translate.
+func (c Candidate) Entry() Entry {
+	return Entry{
+		Source:         c.Term,
+		DoNotTranslate: c.Kind == KindCode || c.Kind == KindAcronym,
+		Notes:          fmt.Sprintf("candidate: %s, %d occurrences", c.Kind, c.Count),
+	}
+}
+
+// ExtractOptions tunes Extract. Zero values use the defaults.
+type ExtractOptions struct {
+	MinCount       int // minimum occurrences of code, acronyms and capitalized terms, default 2
+	MinPhraseCount int // minimum occurrences of lowercase phrases, default 4
+	MaxWords       int // longest phrase in words, default 3
+	MaxTerms       int // maximum number of candidates, default 200
+}
+
+func (o *ExtractOptions) defaults() {
+	if o.MinCount <= 0 {
+		o.MinCount = 2
+	}
+	if o.MinPhraseCount <= 0 {
+		o.MinPhraseCount = 4
+	}
+	if o.MaxWords <= 0 {
+		o.MaxWords = 3
+	}
+	if o.MaxTerms <= 0 {
+		o.MaxTerms = 200
+	}
+}
+
+var (
+	codeElementRegex = regexp.MustCompile(`(?is)<code[^>]*>(.*?)</code>`)
+	sentenceRegex    = regexp.MustCompile(`[.!?:;]+(\s+|$)`)
+	wordRegex        = regexp.MustCompile(`[\p{L}\p{N}][\p{L}\p{N}_'’./+#-]*[\p{L}\p{N}_+#]|[\p{L}\p{N}]`)
+	camelCaseRegex   = regexp.MustCompile(`\p{Ll}\p{Lu}`)
+)
+
+// Extract finds candidate glossary terms in contents, which may contain HTML,
+// without calling any service: text inside code elements and code-like tokens,
+// acronyms, capitalized words and phrases that do not start a sentence, and
+// frequent lowercase phrases.
+func Extract(contents []string, opts ExtractOptions) []Candidate {
+	opts.defaults()
+
+	counts := make(map[string]*Candidate)
+	add := func(term, kind string) {
+		key := strings.ToLower(term)
+		if c, ok := counts[key]; ok {
+			c.Count++
+			return
+		}
+		counts[key] = &Candidate{Term: term, Kind: kind, Count: 1}
+	}
+
+	for _, content := range contents {
+		for _, match := range codeElementRegex.FindAllStringSubmatch(content, -1) {
+			if code := strings.TrimSpace(PlainText(match[1])); code != "" && len(strings.Fields(code)) <= opts.MaxWords {
+				add(code, KindCode)
+			}
+		}
+
+		text := PlainText(codeElementRegex.ReplaceAllString(content, " "))
+		for _, sentence := range sentenceRegex.Split(text, -1) {
+			words := wordRegex.FindAllString(sentence, -1)
+			extractSentence(words, opts, add)
+		}
+	}
+
+	var candidates []Candidate
+	for _, c := range counts {
+		minCount := opts.MinCount
+		if c.Kind == KindPhrase {
+			minCount = opts.MinPhraseCount
+		}
+		if c.Count >= minCount {
+			candidates = append(candidates, *c)
+		}
+	}
+
+	candidates = dropSubsumed(candidates)
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Count != candidates[j].Count {
+			return candidates[i].Count > candidates[j].Count
+		}
+		return candidates[i].Term < candidates[j].Term
+	})
+	if len(candidates) > opts.MaxTerms {
+		candidates = candidates[:opts.MaxTerms]
+	}
+
+	return candidates
+}
+
+func extractSentence(words []string, opts ExtractOptions, add func(term, kind string)) {
+	for i := 0; i < len(words); i++ {
+		word := strings.TrimRight(words[i], "'’.-")
+
+		switch {
+		case isCodeLike(word):
+			add(word, KindCode)
+			continue
+		case isAcronym(word):
+			add(word, KindAcronym)
+			continue
+		}
+
+		// Capitalized runs, skipping the first word of the sentence
+		if i > 0 && isCapitalized(word) {
+			j := i
+			for j < len(words) && j-i < opts.MaxWords && isCapitalized(words[j]) && !isCodeLike(words[j]) && !isAcronym(words[j]) {
+				j++
+			}
+			add(strings.Join(words[i:j], " "), KindCapitalized)
+			i = j - 1
+			continue
+		}
+	}
+
+	// Lowercase phrases of two or more words that neither start nor end with a stop word
+	for n := 2; n <= opts.MaxWords; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			phrase := words[i : i+n]
+			if stopWords[strings.ToLower(phrase[0])] || stopWords[strings.ToLower(phrase[n-1])] {
+				continue
+			}
+			plain := true
+			for _, word := range phrase {
+				if !isLowerWord(word) {
+					plain = false
+					break
+				}
+			}
+			if plain {
+				add(strings.Join(phrase, " "), KindPhrase)
+			}
+		}
+	}
+}
+
+// dropSubsumed removes candidates that only occur as part of a longer one of
+// the same kind.
+func dropSubsumed(candidates []Candidate) []Candidate {
+	var kept []Candidate
+	for i, c := range candidates {
+		subsumed := false
+		for j, other := range candidates {
+			if i != j && other.Kind == c.Kind && other.Count >= c.Count && len(other.Term) > len(c.Term) && ContainsTerm(other.Term, c.Term) {
+				subsumed = true
+				break
+			}
+		}
+		if !subsumed {
+			kept = append(kept, c)
+		}
+	}
+	return kept
+}
+
+func isCodeLike(word string) bool {
+	if len(word) < 2 {
+		return false
+	}
+	if strings.ContainsAny(word, "_#+") || camelCaseRegex.MatchString(word) {
+		return true
+	}
+	// Dotted identifiers such as os.Open, but not abbreviations such as e.g
+	if i := strings.Index(word, "."); i > 0 && i < len(word)-1 && !strings.Contains(word, "..") {
+		return len(word)-i > 2
+	}
+	return false
+}
+
+func isAcronym(word string) bool {
+	letters := 0
+	for _, r := range word {
+		switch {
+		case unicode.IsUpper(r):
+			letters++
+		case unicode.IsDigit(r) || r == '-':
+		default:
+			return false
+		}
+	}
+	return letters >= 2
+}
+
+func isCapitalized(word string) bool {
+	for i, r := range word {
+		if i == 0 {
+			if !unicode.IsUpper(r) {
+				return false
+			}
+			continue
+		}
+		if !unicode.IsLetter(r) && r != '-' && r != '\'' && r != '’' {
+			return false
+		}
+	}
+	return word != "" && !stopWords[strings.ToLower(word)]
+}
+
+func isLowerWord(word string) bool {
+	for _, r := range word {
+		if !unicode.IsLower(r) && r != '-' {
+			return false
+		}
+	}
+	return len(word) > 1
+}
+
+var stopWords = func() map[string]bool {
+	words := strings.Fields(`a about above after again against all also am an and any are as at be because been
+before being below between both but by can could did do does doing down during each even ever every few for
+from further had has have having he her here hers herself him himself his how i if in into is it its itself
+just let like made make many may me might more most much must my myself no nor not now of off often on once
+one only or other our ours ourselves out over own same she should so some such than that the their theirs
+them themselves then there these they this those through to too under until up upon us very was we were
+what when where which while who whom why will with would yet you your yours yourself yourselves`)
+
+	set := make(map[string]bool, len(words))
+	for _, word := range words {
+		set[word] = true
+	}
+	return set
+}()
@@ -0,0 +1,48 @@
+package glossary
+
+import "testing"
+
+func TestExtract(t *testing.T) {
+	contents := []string{
+		"<p>Teams adopting Continuous Delivery ship small changes. The deployment pipeline runs every commit.</p>",
+		"<p>With Continuous Delivery, the <code>git push</code> command starts the deployment pipeline.</p>",
+		"<p>Call <code>git push</code> again. Each HTTP request is logged by the deployment pipeline.</p>",
+		"<p>Every HTTP handler calls http.HandleFunc, so the deployment pipeline stays green.</p>",
+		"<p>Teams also call http.HandleFunc directly.</p>",
+	}
+
+	candidates := Extract(contents, ExtractOptions{})
+	found := make(map[string]Candidate)
+	for _, c := range candidates {
+		found[c.Term] = c
+	}
+
+	want := map[string]string{
+		"Continuous Delivery": KindCapitalized,
+		"git push":            KindCode,
+		"HTTP":                KindAcronym,
+		"http.HandleFunc":     KindCode,
+		"deployment pipeline": KindPhrase,
+	}
+	for term, kind := range want {
+		c, ok := found[term]
+		if !ok {
+			t.Errorf("Extract() did not find %q in %+v", term, candidates)
+			continue
+		}
+		if c.Kind != kind {
+			t.Errorf("%q has kind %s, want %s", term, c.Kind, kind)
+		}
+	}
+
+	// Parts of a longer candidate and sentence-initial words are not candidates
+	for _, term := range []string{"Continuous", "Delivery", "deployment", "Teams", "Every"} {
+		if _, ok := found[term]; ok {
+			t.Errorf("Extract() returned unexpected candidate %q", term)
+		}
+	}
+
+	if entry := found["git push"].Entry(); !entry.DoNotTranslate {
+		t.Errorf("code candidate entry %+v should default to do-not-translate", entry)
+	}
+}
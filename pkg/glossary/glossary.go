@@ -0,0 +1,317 @@
+// Package glossary loads a book's terminology list and checks translations
+// against it.
+package glossary
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Candidate file names, relative to the unpacked book, in lookup order.
+var FileNames = []string{"META-INF/glossary.csv", "META-INF/glossary.tsv"}
+
+// Column names of a glossary file. Only source is required.
+const (
+	ColumnSource         = "source"
+	ColumnTarget         = "target"
+	ColumnPartOfSpeech   = "pos"
+	ColumnNotes          = "notes"
+	ColumnDoNotTranslate = "do_not_translate"
+)
+
+// Columns is the column order used when writing a glossary.
+var Columns = []string{ColumnSource, ColumnTarget, ColumnPartOfSpeech, ColumnNotes, ColumnDoNotTranslate}
+
+// Entry is one term of the glossary.
+type Entry struct {
+	Source         string
+	Target         string
+	PartOfSpeech   string
+	Notes          string
+	DoNotTranslate bool
+}
+
+// Violation is a glossary entry a translation does not follow.
+type Violation struct {
+	Entry   Entry
+	Message string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%q: %s", v.Entry.Source, v.Message)
+}
+
+// Glossary is the terminology of one book.
+type Glossary struct {
+	Entries []Entry
+}
+
+// Find returns the path of the glossary file of the book unpacked at
+// unzipPath, or an empty string if it has none.
+func Find(unzipPath string) string {
+	for _, name := range FileNames {
+		filePath := filepath.Join(unzipPath, name)
+		if _, err := os.Stat(filePath); err == nil {
+			return filePath
+		}
+	}
+	return ""
+}
+
+// Load reads the glossary of the book unpacked at unzipPath. A book without a
+// glossary file gets an empty glossary.
+func Load(unzipPath string) (*Glossary, error) {
+	filePath := Find(unzipPath)
+	if filePath == "" {
+		return &Glossary{}, nil
+	}
+	return LoadFile(filePath)
+}
+
+// LoadFile reads a glossary file. Files ending in .tsv are tab separated,
+// everything else is comma separated.
+func LoadFile(filePath string) (*Glossary, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open glossary: %w", err)
+	}
+	defer f.Close()
+
+	entries, err := Parse(f, Separator(filePath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse glossary %s: %w", filepath.Base(filePath), err)
+	}
+
+	return &Glossary{Entries: entries}, nil
+}
+
+// Separator returns the field separator for a glossary file name.
+func Separator(filePath string) rune {
+	if strings.EqualFold(filepath.Ext(filePath), ".tsv") {
+		return '\t'
+	}
+	return ','
+}
+
+// Parse reads glossary entries from r. The first row must name the columns.
+func Parse(r io.Reader, comma rune) ([]Entry, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	// Tabs count as leading space, so empty TSV fields would collapse
+	if comma == '\t' {
+		reader.LazyQuotes = true
+	} else {
+		reader.TrimLeadingSpace = true
+	}
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	if _, ok := columns[ColumnSource]; !ok {
+		return nil, fmt.Errorf("missing %q column", ColumnSource)
+	}
+
+	field := func(record []string, column string) string {
+		i, ok := columns[column]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var entries []Entry
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		entry := Entry{
+			Source:       field(record, ColumnSource),
+			Target:       field(record, ColumnTarget),
+			PartOfSpeech: field(record, ColumnPartOfSpeech),
+			Notes:        field(record, ColumnNotes),
+		}
+		if entry.Source == "" || strings.HasPrefix(entry.Source, "#") {
+			continue
+		}
+		if value := field(record, ColumnDoNotTranslate); value != "" {
+			entry.DoNotTranslate = parseFlag(value)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func parseFlag(value string) bool {
+	if b, err := strconv.ParseBool(value); err == nil {
+		return b
+	}
+	switch strings.ToLower(value) {
+	case "y", "yes", "x":
+		return true
+	}
+	return false
+}
+
+// Write writes entries to w with a header row.
+func Write(w io.Writer, entries []Entry, comma rune) error {
+	writer := csv.NewWriter(w)
+	writer.Comma = comma
+
+	if err := writer.Write(Columns); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		doNotTranslate := ""
+		if entry.DoNotTranslate {
+			doNotTranslate = "true"
+		}
+		if err := writer.Write([]string{entry.Source, entry.Target, entry.PartOfSpeech, entry.Notes, doNotTranslate}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// Relevant returns the entries whose source term appears in text, which may
+// contain HTML. Longer terms come first.
+func (g *Glossary) Relevant(text string) []Entry {
+	if g == nil || len(g.Entries) == 0 {
+		return nil
+	}
+
+	plain := PlainText(text)
+	var relevant []Entry
+	for _, entry := range g.Entries {
+		if ContainsTerm(plain, entry.Source) {
+			relevant = append(relevant, entry)
+		}
+	}
+
+	sort.SliceStable(relevant, func(i, j int) bool {
+		return len(relevant[i].Source) > len(relevant[j].Source)
+	})
+	return relevant
+}
+
+// Prompt formats entries as instructions for the system prompt.
+func Prompt(entries []Entry) string {
+	if len(entries) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("GLOSSARY:\nUse exactly these renderings for the following terms wherever they appear.\n")
+	for _, entry := range entries {
+		b.WriteString("- ")
+		b.WriteString(entry.Source)
+		if entry.PartOfSpeech != "" {
+			fmt.Fprintf(&b, " (%s)", entry.PartOfSpeech)
+		}
+		switch {
+		case entry.DoNotTranslate:
+			b.WriteString(": keep unchanged, do not translate")
+		case entry.Target != "":
+			fmt.Fprintf(&b, ": %s", entry.Target)
+		}
+		if entry.Notes != "" {
+			fmt.Fprintf(&b, ". %s", entry.Notes)
+		}
+		b.WriteString("\n")
+	}
+
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// Check returns the relevant entries of source that translation does not
+// follow: terms marked do-not-translate that are missing from the translation,
+// and target terms that are not used.
+func (g *Glossary) Check(source, translation string) []Violation {
+	var violations []Violation
+	plain := PlainText(translation)
+
+	for _, entry := range g.Relevant(source) {
+		switch {
+		case entry.DoNotTranslate:
+			if !ContainsTerm(plain, entry.Source) {
+				violations = append(violations, Violation{Entry: entry, Message: "must be kept untranslated"})
+			}
+		case entry.Target != "":
+			if !ContainsTerm(plain, entry.Target) {
+				violations = append(violations, Violation{Entry: entry, Message: fmt.Sprintf("must be translated as %q", entry.Target)})
+			}
+		}
+	}
+
+	return violations
+}
+
+var tagRegex = regexp.MustCompile(`<[^>]*>`)
+
+// PlainText strips tags and decodes entities.
+func PlainText(content string) string {
+	return html.UnescapeString(tagRegex.ReplaceAllString(content, " "))
+}
+
+// ContainsTerm reports whether term occurs in text as a whole word or phrase,
+// ignoring case.
+func ContainsTerm(text, term string) bool {
+	term = strings.TrimSpace(term)
+	if term == "" {
+		return false
+	}
+
+	lowerText := strings.ToLower(text)
+	lowerTerm := strings.ToLower(term)
+	for offset := 0; offset < len(lowerText); {
+		i := strings.Index(lowerText[offset:], lowerTerm)
+		if i < 0 {
+			return false
+		}
+		start := offset + i
+		end := start + len(lowerTerm)
+
+		before, _ := utf8.DecodeLastRuneInString(lowerText[:start])
+		after, _ := utf8.DecodeRuneInString(lowerText[end:])
+		if (start == 0 || !isWordRune(before)) && (end == len(lowerText) || !isWordRune(after)) {
+			return true
+		}
+
+		_, size := utf8.DecodeRuneInString(lowerText[start:])
+		offset = start + size
+	}
+
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r)
+}
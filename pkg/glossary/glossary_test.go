@@ -0,0 +1,64 @@
+package glossary
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const testGlossary = "source,target,pos,notes,do_not_translate\n" +
+	"pull request,yêu cầu hợp nhất,noun,,\n" +
+	"Kubernetes,,noun,product name,true\n" +
+	"# comment,,,,\n" +
+	"deploy,triển khai,verb,,\n"
+
+func TestParseAndWrite(t *testing.T) {
+	entries, err := Parse(strings.NewReader(testGlossary), ',')
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Parse() returned %d entries, want 3", len(entries))
+	}
+	if !entries[1].DoNotTranslate || entries[1].Notes != "product name" {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, entries, '\t'); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	again, err := Parse(&buf, '\t')
+	if err != nil {
+		t.Fatalf("Parse() of written glossary error = %v", err)
+	}
+	for i := range entries {
+		if again[i] != entries[i] {
+			t.Errorf("entry %d = %+v after round trip, want %+v", i, again[i], entries[i])
+		}
+	}
+}
+
+func TestRelevantAndCheck(t *testing.T) {
+	entries, _ := Parse(strings.NewReader(testGlossary), ',')
+	g := &Glossary{Entries: entries}
+
+	source := "<p>Open a <b>pull request</b> before you deploy to Kubernetes.</p>"
+	if got := g.Relevant(source); len(got) != 3 || got[0].Source != "pull request" {
+		t.Errorf("Relevant() = %+v, want all three entries, longest first", got)
+	}
+	if got := g.Relevant("<p>Redeployment is not the same word.</p>"); len(got) != 0 {
+		t.Errorf("Relevant() matched inside a word: %+v", got)
+	}
+
+	good := "<p>Mở một <b>yêu cầu hợp nhất</b> trước khi triển khai lên Kubernetes.</p>"
+	if violations := g.Check(source, good); len(violations) != 0 {
+		t.Errorf("Check() = %v, want no violations", violations)
+	}
+
+	bad := "<p>Mở một <b>pull request</b> trước khi triển khai lên Cúbơnétis.</p>"
+	violations := g.Check(source, bad)
+	if len(violations) != 2 {
+		t.Fatalf("Check() = %v, want two violations", violations)
+	}
+}
@@ -0,0 +1,294 @@
+// Package journal records the progress of a translate run inside the unpacked
+// book, so failed and interrupted batches can be reported and retried.
+package journal
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// FileName is the location of the journal relative to the unpacked book.
+const FileName = "META-INF/translation-journal.json"
+
+// Status is the state of a batch or segment.
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusDone    Status = "done"
+	StatusFailed  Status = "failed"
+)
+
+// Run holds the settings of the most recent translate run, so a resumed run
+// uses the same provider and languages.
+type Run struct {
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model"`
+	Source    string    `json:"source"`
+	Target    string    `json:"target"`
+	Prompt    string    `json:"prompt"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Batch records one translation request and its outcome.
+type Batch struct {
+	ID         string   `json:"id"`
+	File       string   `json:"file"`
+	ContentIDs []string `json:"content_ids"`
+	// Failed lists the content ids of a done batch that were not written,
+	// because the response dropped them or their translation was invalid.
+	Failed       []string  `json:"failed,omitempty"`
+	Status       Status    `json:"status"`
+	Attempts     int       `json:"attempts"`
+	Error        string    `json:"error,omitempty"`
+	Provider     string    `json:"provider"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cost         float64   `json:"cost"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Result is the outcome of a batch reported to Finish.
+type Result struct {
+	Err          error
+	Failed       []string
+	InputTokens  int
+	OutputTokens int
+	Cost         float64
+}
+
+// Segment is the journal's view of a single marked element.
+type Segment struct {
+	File   string
+	Status Status
+	Error  string
+}
+
+// Journal is safe for concurrent use. Every change is written to disk
+// immediately, so the journal survives an interrupted run.
+type Journal struct {
+	path string
+
+	mu      sync.Mutex
+	run     Run
+	batches []*Batch
+	byID    map[string]*Batch
+}
+
+type journalFile struct {
+	Run     Run      `json:"run"`
+	Batches []*Batch `json:"batches"`
+}
+
+// Path returns the journal location for the book unpacked at unzipPath.
+func Path(unzipPath string) string {
+	return filepath.Join(unzipPath, FileName)
+}
+
+// Exists reports whether the book unpacked at unzipPath has a journal.
+func Exists(unzipPath string) bool {
+	_, err := os.Stat(Path(unzipPath))
+	return err == nil
+}
+
+// Open loads the journal of the book unpacked at unzipPath, or returns an
+// empty journal if there is none yet.
+func Open(unzipPath string) (*Journal, error) {
+	j := &Journal{
+		path: Path(unzipPath),
+		byID: make(map[string]*Batch),
+	}
+
+	data, err := os.ReadFile(j.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return j, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read translation journal: %w", err)
+	}
+
+	var file journalFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse translation journal: %w", err)
+	}
+
+	j.run = file.Run
+	for _, batch := range file.Batches {
+		j.batches = append(j.batches, batch)
+		j.byID[batch.ID] = batch
+	}
+
+	return j, nil
+}
+
+// BatchID derives a stable id from a batch's file and content ids.
+func BatchID(file string, contentIDs []string) string {
+	sum := sha1.Sum([]byte(file + "\n" + strings.Join(contentIDs, "\n")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Run returns the settings of the last recorded run.
+func (j *Journal) Run() Run {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.run
+}
+
+// SetRun records the settings of the current run.
+func (j *Journal) SetRun(run Run) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.run = run
+	return j.save()
+}
+
+// Start marks batch as pending and counts an attempt. Tokens and cost of
+// earlier attempts of the same batch are kept.
+func (j *Journal) Start(batch Batch) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	existing := j.pending(batch)
+	existing.Error = ""
+	existing.Attempts++
+
+	return j.save()
+}
+
+// Skip records batch as pending without counting an attempt, for batches
+// the run decided not to send, such as when the budget ran out.
+func (j *Journal) Skip(batch Batch, reason string) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	existing := j.pending(batch)
+	existing.Error = reason
+
+	return j.save()
+}
+
+// pending adds or updates the record of batch and marks it pending.
+func (j *Journal) pending(batch Batch) *Batch {
+	existing, ok := j.byID[batch.ID]
+	if !ok {
+		existing = &Batch{ID: batch.ID}
+		j.batches = append(j.batches, existing)
+		j.byID[batch.ID] = existing
+	}
+
+	existing.File = batch.File
+	existing.ContentIDs = batch.ContentIDs
+	existing.Provider = batch.Provider
+	existing.Model = batch.Model
+	existing.Status = StatusPending
+	existing.Failed = nil
+	existing.UpdatedAt = time.Now()
+
+	return existing
+}
+
+// Finish records the outcome of the batch with the given id.
+func (j *Journal) Finish(id string, result Result) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	batch, ok := j.byID[id]
+	if !ok {
+		return fmt.Errorf("batch %s is not in the journal", id)
+	}
+
+	batch.Status = StatusDone
+	batch.Failed = result.Failed
+	batch.Error = ""
+	if result.Err != nil {
+		batch.Status = StatusFailed
+		batch.Error = result.Err.Error()
+	}
+	batch.InputTokens += result.InputTokens
+	batch.OutputTokens += result.OutputTokens
+	batch.Cost += result.Cost
+	batch.UpdatedAt = time.Now()
+
+	return j.save()
+}
+
+// Batches returns a copy of every recorded batch, oldest update first.
+func (j *Journal) Batches() []Batch {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	batches := make([]Batch, 0, len(j.batches))
+	for _, batch := range j.batches {
+		batches = append(batches, *batch)
+	}
+	sort.SliceStable(batches, func(a, b int) bool {
+		return batches[a].UpdatedAt.Before(batches[b].UpdatedAt)
+	})
+
+	return batches
+}
+
+// Segments returns the latest status of every content id in the journal.
+func (j *Journal) Segments() map[string]Segment {
+	segments := make(map[string]Segment)
+
+	for _, batch := range j.Batches() {
+		failed := make(map[string]bool, len(batch.Failed))
+		for _, id := range batch.Failed {
+			failed[id] = true
+		}
+
+		for _, id := range batch.ContentIDs {
+			segment := Segment{File: batch.File, Status: batch.Status, Error: batch.Error}
+			if batch.Status == StatusDone && failed[id] {
+				segment.Status = StatusFailed
+				segment.Error = "translation missing or invalid"
+			}
+			segments[id] = segment
+		}
+	}
+
+	return segments
+}
+
+// Totals returns the tokens and cost of every recorded batch.
+func (j *Journal) Totals() (inputTokens, outputTokens int, cost float64) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	for _, batch := range j.batches {
+		inputTokens += batch.InputTokens
+		outputTokens += batch.OutputTokens
+		cost += batch.Cost
+	}
+	return inputTokens, outputTokens, cost
+}
+
+func (j *Journal) save() error {
+	data, err := json.MarshalIndent(journalFile{Run: j.run, Batches: j.batches}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal translation journal: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(j.path), 0755); err != nil {
+		return fmt.Errorf("failed to create journal directory: %w", err)
+	}
+	if err := util.WriteFileAtomic(j.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write translation journal: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,236 @@
+// Package metadata finds the texts of a book that live outside its content
+// documents, such as its title, description and table of contents, and keeps
+// their translations.
+package metadata
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/loader"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// FileName is the location of the translations relative to the unpacked book.
+const FileName = "META-INF/metadata-translations.json"
+
+// Field is the kind of a text.
+type Field string
+
+const (
+	FieldTitle       Field = "title"
+	FieldDescription Field = "description"
+	FieldLabel       Field = "label"
+)
+
+// Documents are the files of a book that hold its metadata and navigation,
+// as slash separated paths relative to the unpacked book. NCX and Nav are
+// empty when the book has none.
+type Documents struct {
+	Package string
+	NCX     string
+	Nav     string
+}
+
+// Locate finds the package document, the NCX and the EPUB 3 navigation
+// document of the book unpacked at unzipPath.
+func Locate(unzipPath string) (Documents, error) {
+	container, err := loader.ParseContainer(unzipPath)
+	if err != nil {
+		return Documents{}, fmt.Errorf("failed to parse container: %w", err)
+	}
+	pkg, err := loader.ParsePackage(filepath.Join(unzipPath, container.Rootfile.FullPath))
+	if err != nil {
+		return Documents{}, fmt.Errorf("failed to parse package: %w", err)
+	}
+
+	docs := Documents{Package: container.Rootfile.FullPath}
+	contentDir := path.Dir(container.Rootfile.FullPath)
+	for _, item := range pkg.Manifest.Items {
+		switch {
+		case item.MediaType == "application/x-dtbncx+xml" && (docs.NCX == "" || item.ID == pkg.Spine.Toc):
+			docs.NCX = path.Join(contentDir, item.Href)
+		case item.MediaType == "application/xhtml+xml" && containsWord(item.Properties, "nav"):
+			docs.Nav = path.Join(contentDir, item.Href)
+		}
+	}
+
+	return docs, nil
+}
+
+// Texts returns the texts of docs in the book unpacked at unzipPath, once each,
+// in the order they appear: the title and description, then the NCX labels,
+// then the entries of the navigation document.
+func Texts(unzipPath string, docs Documents) ([]string, error) {
+	var texts []string
+	seen := make(map[string]bool)
+	collect := func(field Field, text string) string {
+		if !seen[text] {
+			seen[text] = true
+			texts = append(texts, text)
+		}
+		return ""
+	}
+
+	for _, doc := range []struct {
+		file    string
+		rewrite func([]byte, func(Field, string) string) []byte
+	}{
+		{docs.Package, RewritePackage},
+		{docs.NCX, RewriteNCX},
+		{docs.Nav, RewriteNav},
+	} {
+		if doc.file == "" {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(unzipPath, filepath.FromSlash(doc.file)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", doc.file, err)
+		}
+		doc.rewrite(content, collect)
+	}
+
+	return texts, nil
+}
+
+var (
+	// packageTextRegex matches the title and description of a package document
+	packageTextRegex = regexp.MustCompile(`(<dc:(title|description)\b[^>]*>)([^<]*)(</dc:(?:title|description)>)`)
+	// ncxTextRegex matches the text of the title and navigation labels of an NCX
+	ncxTextRegex = regexp.MustCompile(`(<(?:docTitle|navLabel)\b[^>]*>\s*<text\b[^>]*>)([^<]*)(</text>)`)
+	// navRegex matches the nav elements of a navigation document
+	navRegex = regexp.MustCompile(`(?s)<nav\b[^>]*>.*?</nav>`)
+	// navTextRegex matches the headings and entries of a nav element
+	navTextRegex = regexp.MustCompile(`(<(?:a|span|h[1-6])\b[^>]*>)([^<]*)(</(?:a|span|h[1-6])>)`)
+	// pageListRegex matches the opening tag of a page list, whose entries are page numbers
+	pageListRegex = regexp.MustCompile(`^<nav\b[^>]*epub:type="[^"]*\bpage-list\b`)
+)
+
+// RewritePackage returns content, a package document, with its title and
+// description replaced by render.
+func RewritePackage(content []byte, render func(Field, string) string) []byte {
+	return packageTextRegex.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := packageTextRegex.FindSubmatch(match)
+		field := FieldTitle
+		if string(groups[2]) == "description" {
+			field = FieldDescription
+		}
+		return rewriteText(match, groups[1], groups[3], groups[4], field, render)
+	})
+}
+
+// RewriteNCX returns content, an NCX, with the text of its title and
+// navigation labels replaced by render.
+func RewriteNCX(content []byte, render func(Field, string) string) []byte {
+	return ncxTextRegex.ReplaceAllFunc(content, func(match []byte) []byte {
+		groups := ncxTextRegex.FindSubmatch(match)
+		return rewriteText(match, groups[1], groups[2], groups[3], FieldLabel, render)
+	})
+}
+
+// RewriteNav returns content, an EPUB 3 navigation document, with the headings
+// and entries of its nav elements replaced by render. Page lists are left as
+// they are, as are entries with markup inside.
+func RewriteNav(content []byte, render func(Field, string) string) []byte {
+	return navRegex.ReplaceAllFunc(content, func(nav []byte) []byte {
+		if pageListRegex.Match(nav) {
+			return nav
+		}
+		return navTextRegex.ReplaceAllFunc(nav, func(match []byte) []byte {
+			groups := navTextRegex.FindSubmatch(match)
+			return rewriteText(match, groups[1], groups[2], groups[3], FieldLabel, render)
+		})
+	})
+}
+
+// rewriteText rebuilds match, the element open text end, with its text
+// replaced by render. Whitespace-only texts and texts render leaves empty are
+// kept as they are.
+func rewriteText(match, open, text, end []byte, field Field, render func(Field, string) string) []byte {
+	source := normalize(string(text))
+	if source == "" {
+		return match
+	}
+	rendered := render(field, source)
+	if rendered == "" {
+		return match
+	}
+
+	var b strings.Builder
+	b.Write(open)
+	b.WriteString(util.EscapeText(rendered))
+	b.Write(end)
+	return []byte(b.String())
+}
+
+// normalize unescapes text and collapses its whitespace.
+func normalize(text string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(text)), " ")
+}
+
+func containsWord(list, word string) bool {
+	for _, field := range strings.Fields(list) {
+		if field == word {
+			return true
+		}
+	}
+	return false
+}
+
+// Translations are the translated texts of a book, keyed by their source text.
+type Translations struct {
+	path    string
+	Target  string            `json:"target"`
+	Strings map[string]string `json:"strings"`
+}
+
+// Path returns the translations location for the book unpacked at unzipPath.
+func Path(unzipPath string) string {
+	return filepath.Join(unzipPath, FileName)
+}
+
+// Load reads the translations of the book unpacked at unzipPath. A book
+// without translations gets an empty set.
+func Load(unzipPath string) (*Translations, error) {
+	t := &Translations{path: Path(unzipPath), Strings: make(map[string]string)}
+
+	data, err := os.ReadFile(t.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metadata translations: %w", err)
+	}
+	if err := json.Unmarshal(data, t); err != nil {
+		return nil, fmt.Errorf("failed to parse metadata translations: %w", err)
+	}
+	if t.Strings == nil {
+		t.Strings = make(map[string]string)
+	}
+
+	return t, nil
+}
+
+// Save writes the translations back to the book.
+func (t *Translations) Save() error {
+	data, err := json.MarshalIndent(t, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal metadata translations: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return fmt.Errorf("failed to create metadata translations directory: %w", err)
+	}
+	if err := util.WriteFileAtomic(t.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metadata translations: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testBook = map[string]string{
+	"META-INF/container.xml": `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles><rootfile full-path="OEBPS/package.opf" media-type="application/oebps-package+xml"/></rootfiles>
+</container>`,
+	"OEBPS/package.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title id="t">Tom &amp; Jerry</dc:title>
+    <dc:description>A chase.</dc:description>
+    <dc:creator>Someone</dc:creator>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="ch1" href="ch1.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx"><itemref idref="ch1"/></spine>
+</package>`,
+	"OEBPS/toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <docTitle><text>Tom &amp; Jerry</text></docTitle>
+  <docAuthor><text>Someone</text></docAuthor>
+  <navMap>
+    <navPoint id="p1"><navLabel>
+      <text>The   Chase</text>
+    </navLabel><content src="ch1.xhtml"/></navPoint>
+  </navMap>
+</ncx>`,
+	"OEBPS/nav.xhtml": `<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><head><title>Nav</title></head><body>
+<nav epub:type="toc"><h1>Contents</h1><ol>
+  <li><a href="ch1.xhtml">The Chase</a></li>
+  <li><a href="ch1.xhtml#end"><em>The</em> End</a></li>
+</ol></nav>
+<nav epub:type="page-list"><ol><li><a href="ch1.xhtml#p1">1</a></li></ol></nav>
+</body></html>`,
+}
+
+func writeBook(t *testing.T) string {
+	t.Helper()
+
+	unzipPath := t.TempDir()
+	for name, content := range testBook {
+		filePath := filepath.Join(unzipPath, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return unzipPath
+}
+
+func TestLocateAndTexts(t *testing.T) {
+	unzipPath := writeBook(t)
+
+	docs, err := Locate(unzipPath)
+	if err != nil {
+		t.Fatalf("Locate() error = %v", err)
+	}
+	if want := (Documents{Package: "OEBPS/package.opf", NCX: "OEBPS/toc.ncx", Nav: "OEBPS/nav.xhtml"}); docs != want {
+		t.Errorf("Locate() = %+v, want %+v", docs, want)
+	}
+
+	texts, err := Texts(unzipPath, docs)
+	if err != nil {
+		t.Fatalf("Texts() error = %v", err)
+	}
+	// The author, the entry with markup and the page list are left out
+	if want := []string{"Tom & Jerry", "A chase.", "The Chase", "Contents"}; !reflect.DeepEqual(texts, want) {
+		t.Errorf("Texts() = %q, want %q", texts, want)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	render := func(field Field, text string) string {
+		if text == "Contents" {
+			return ""
+		}
+		return string(field) + ": " + strings.ToUpper(text)
+	}
+
+	pkg := string(RewritePackage([]byte(testBook["OEBPS/package.opf"]), render))
+	for _, want := range []string{
+		`<dc:title id="t">title: TOM &amp; JERRY</dc:title>`,
+		`<dc:description>description: A CHASE.</dc:description>`,
+		`<dc:creator>Someone</dc:creator>`,
+	} {
+		if !strings.Contains(pkg, want) {
+			t.Errorf("package does not contain %q:\n%s", want, pkg)
+		}
+	}
+
+	ncx := string(RewriteNCX([]byte(testBook["OEBPS/toc.ncx"]), render))
+	for _, want := range []string{
+		`<docTitle><text>label: TOM &amp; JERRY</text></docTitle>`,
+		`<docAuthor><text>Someone</text></docAuthor>`,
+		"<text>label: THE CHASE</text>",
+	} {
+		if !strings.Contains(ncx, want) {
+			t.Errorf("NCX does not contain %q:\n%s", want, ncx)
+		}
+	}
+
+	nav := string(RewriteNav([]byte(testBook["OEBPS/nav.xhtml"]), render))
+	for _, want := range []string{
+		"<h1>Contents</h1>",
+		`<a href="ch1.xhtml">label: THE CHASE</a>`,
+		`<a href="ch1.xhtml#end"><em>The</em> End</a>`,
+		`<a href="ch1.xhtml#p1">1</a>`,
+	} {
+		if !strings.Contains(nav, want) {
+			t.Errorf("nav does not contain %q:\n%s", want, nav)
+		}
+	}
+}
+
+func TestLoadAndSave(t *testing.T) {
+	unzipPath := t.TempDir()
+
+	translations, err := Load(unzipPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	translations.Target = "Vietnamese"
+	translations.Strings["The Chase"] = "Cuộc rượt đuổi"
+	if err := translations.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	again, err := Load(unzipPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if again.Target != "Vietnamese" || again.Strings["The Chase"] != "Cuộc rượt đuổi" {
+		t.Errorf("Load() = %+v, want the saved translations", again)
+	}
+}
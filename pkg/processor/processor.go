@@ -22,21 +22,76 @@ type Config struct {
 // EpubItemProcessor is a function type for processing individual EPUB items
 type EpubItemProcessor func(ctx context.Context, filePath string) error
 
-// ProcessEpub processes an EPUB file with the given configuration and processor
-func ProcessEpub(ctx context.Context, unzipPath string, cfg Config, processor EpubItemProcessor) error {
+// ContentFiles returns the absolute paths of the XHTML documents in the
+// manifest that should be translated, in reading order, and the hrefs of those
+// that were excluded. Documents in the spine come first, in spine order.
+func ContentFiles(unzipPath string) (files []string, excluded []string, err error) {
 	container, err := loader.ParseContainer(unzipPath)
 	if err != nil {
-		return errors.Wrap(err, "failed to load EPUB container")
+		return nil, nil, errors.Wrap(err, "failed to load EPUB container")
 	}
 
 	containerFileAbsPath := filepath.Join(unzipPath, container.Rootfile.FullPath)
 	pkg, err := loader.ParsePackage(containerFileAbsPath)
 	if err != nil {
-		return fmt.Errorf("failed to parse package: %w", err)
+		return nil, nil, fmt.Errorf("failed to parse package: %w", err)
 	}
 
 	contentDir := filepath.Dir(containerFileAbsPath)
 
+	for _, item := range readingOrder(pkg) {
+		if item.MediaType != "application/xhtml+xml" {
+			continue
+		}
+
+		if ShouldExcludeFile(item.Href) {
+			excluded = append(excluded, item.Href)
+			continue
+		}
+
+		filePath := filepath.Join(contentDir, item.Href)
+
+		// check the file content to see if we need to exclude it or not
+		if ShouldExcludeByTitle(filePath) {
+			excluded = append(excluded, item.Href)
+			continue
+		}
+
+		files = append(files, filePath)
+	}
+
+	return files, excluded, nil
+}
+
+// readingOrder returns the manifest items of pkg referenced by the spine, in
+// spine order, followed by the others in manifest order.
+func readingOrder(pkg *loader.Package) []loader.Item {
+	items := make([]loader.Item, 0, len(pkg.Manifest.Items))
+	inSpine := make(map[string]bool, len(pkg.Spine.ItemRefs))
+	for _, ref := range pkg.Spine.ItemRefs {
+		if item := pkg.Manifest.GetItemByID(ref.IDRef); item != nil && !inSpine[item.ID] {
+			inSpine[item.ID] = true
+			items = append(items, *item)
+		}
+	}
+	for _, item := range pkg.Manifest.Items {
+		if !inSpine[item.ID] {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ProcessEpub processes an EPUB file with the given configuration and processor
+func ProcessEpub(ctx context.Context, unzipPath string, cfg Config, processor EpubItemProcessor) error {
+	files, excluded, err := ContentFiles(unzipPath)
+	if err != nil {
+		return err
+	}
+	for _, href := range excluded {
+		fmt.Printf("Excluded file: %s\n", href)
+	}
+
 	jobs := make(chan string, cfg.JobBuffer)
 	results := make(chan error, cfg.ResultBuffer)
 
@@ -52,24 +107,7 @@ func ProcessEpub(ctx context.Context, unzipPath string, cfg Config, processor Ep
 	// Feed jobs
 	go func() {
 		defer close(jobs)
-		for _, item := range pkg.Manifest.Items {
-			if item.MediaType != "application/xhtml+xml" {
-				continue
-			}
-
-			if ShouldExcludeFile(item.Href) {
-				fmt.Printf("Excluded file: %s\n", item.Href)
-				continue
-			}
-
-			filePath := filepath.Join(contentDir, item.Href)
-
-			// check the file content to see if we need to exclude it or not
-			if ShouldExcludeByTitle(filePath) {
-				fmt.Printf("Excluded file: %s\n", item.Href)
-				continue
-			}
-
+		for _, filePath := range files {
 			select {
 			case jobs <- filePath:
 			case <-ctx.Done():
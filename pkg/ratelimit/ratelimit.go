@@ -0,0 +1,51 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Limiter enforces a requests-per-minute and a tokens-per-minute budget. A
+// single Limiter is shared by every worker so parallel translation stays
+// within the provider's quota.
+type Limiter struct {
+	requests *rate.Limiter
+	tokens   *rate.Limiter
+}
+
+// New creates a limiter. Zero or negative values disable the matching limit.
+func New(requestsPerMinute, tokensPerMinute int) *Limiter {
+	l := &Limiter{}
+
+	if requestsPerMinute > 0 {
+		burst := max(1, requestsPerMinute/5)
+		l.requests = rate.NewLimiter(rate.Every(time.Minute/time.Duration(requestsPerMinute)), burst)
+	}
+
+	if tokensPerMinute > 0 {
+		l.tokens = rate.NewLimiter(rate.Limit(float64(tokensPerMinute)/60), tokensPerMinute)
+	}
+
+	return l
+}
+
+// Wait blocks until one request carrying the given number of tokens may be sent.
+// Requests larger than a whole minute's token budget wait for the full budget.
+func (l *Limiter) Wait(ctx context.Context, tokens int) error {
+	if l.requests != nil {
+		if err := l.requests.Wait(ctx); err != nil {
+			return fmt.Errorf("request limit: %w", err)
+		}
+	}
+
+	if l.tokens != nil && tokens > 0 {
+		if err := l.tokens.WaitN(ctx, min(tokens, l.tokens.Burst())); err != nil {
+			return fmt.Errorf("token limit: %w", err)
+		}
+	}
+
+	return nil
+}
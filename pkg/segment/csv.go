@@ -0,0 +1,87 @@
+package segment
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVColumns are the header of a segment CSV file, in the order WriteCSV writes them.
+var CSVColumns = []string{"id", "file", "spine", "state", "source", "target"}
+
+// WriteCSV writes segments as CSV with a header row. CSV carries no languages.
+func WriteCSV(w io.Writer, segments []Segment) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(CSVColumns); err != nil {
+		return err
+	}
+	for _, seg := range segments {
+		record := []string{seg.ID, seg.File, strconv.Itoa(seg.Spine), string(seg.State), seg.Source, seg.Target}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads a segment CSV file. Columns are matched by the header, so they
+// may be reordered in a spreadsheet; only id and target are required.
+func ReadCSV(r io.Reader) (*Document, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return &Document{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	for _, required := range []string{"id", "target"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header has no %s column", required)
+		}
+	}
+
+	doc := &Document{}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return record[i]
+			}
+			return ""
+		}
+
+		seg := Segment{
+			ID:     strings.TrimSpace(field("id")),
+			File:   field("file"),
+			Source: field("source"),
+			Target: field("target"),
+		}
+		if seg.ID == "" {
+			continue
+		}
+		seg.Spine, _ = strconv.Atoi(field("spine"))
+		seg.State = editedState(ParseState(field("state")), seg.Target)
+		doc.Segments = append(doc.Segments, seg)
+	}
+
+	return doc, nil
+}
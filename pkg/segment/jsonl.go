@@ -0,0 +1,50 @@
+package segment
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// WriteJSONL writes one JSON object per segment. JSON lines carry no languages.
+func WriteJSONL(w io.Writer, segments []Segment) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	for _, seg := range segments {
+		if err := encoder.Encode(seg); err != nil {
+			return fmt.Errorf("failed to encode segment %s: %w", seg.ID, err)
+		}
+	}
+	return nil
+}
+
+// ReadJSONL reads segments written by WriteJSONL. Blank lines are skipped.
+func ReadJSONL(r io.Reader) (*Document, error) {
+	doc := &Document{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var seg Segment
+		if err := json.Unmarshal(line, &seg); err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		if seg.ID == "" {
+			continue
+		}
+		seg.State = editedState(ParseState(string(seg.State)), seg.Target)
+		doc.Segments = append(doc.Segments, seg)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSON lines: %w", err)
+	}
+
+	return doc, nil
+}
@@ -0,0 +1,259 @@
+package segment
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+const (
+	poSpineComment = "spine: "
+	poStateComment = "state: "
+)
+
+// WritePO writes segments as a gettext PO file. Each entry uses the content ID
+// as msgctxt, the file as reference and the spine position as an extracted
+// comment. Reviewed and final segments record their state in a comment, and
+// initial segments with a target are marked fuzzy.
+func WritePO(w io.Writer, sourceLang, targetLang string, segments []Segment) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, `msgid ""`)
+	fmt.Fprintln(bw, `msgstr ""`)
+	fmt.Fprintln(bw, `"Content-Type: text/plain; charset=UTF-8\n"`)
+	fmt.Fprintln(bw, `"Content-Transfer-Encoding: 8bit\n"`)
+	if targetLang != "" {
+		fmt.Fprintf(bw, "\"Language: %s\\n\"\n", util.LanguageCode(targetLang))
+	}
+	if sourceLang != "" {
+		fmt.Fprintf(bw, "\"X-Source-Language: %s\\n\"\n", util.LanguageCode(sourceLang))
+	}
+	fmt.Fprintln(bw, `"X-Generator: epubtrans\n"`)
+
+	for _, seg := range segments {
+		fmt.Fprintln(bw)
+		fmt.Fprintf(bw, "#. %s%d\n", poSpineComment, seg.Spine)
+		if seg.State == StateReviewed || seg.State == StateFinal {
+			fmt.Fprintf(bw, "#. %s%s\n", poStateComment, seg.State)
+		}
+		fmt.Fprintf(bw, "#: %s\n", poReference(seg.File))
+		if seg.State == StateInitial && seg.Target != "" {
+			fmt.Fprintln(bw, "#, fuzzy")
+		}
+		writePOString(bw, "msgctxt", seg.ID)
+		writePOString(bw, "msgid", seg.Source)
+		writePOString(bw, "msgstr", seg.Target)
+	}
+
+	return bw.Flush()
+}
+
+// writePOString writes a keyword and its quoted value, one quoted line per
+// line of the value.
+func writePOString(w io.Writer, keyword, value string) {
+	lines := strings.SplitAfter(value, "\n")
+	if len(lines) > 1 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 1 {
+		fmt.Fprintf(w, "%s \"%s\"\n", keyword, poEscaper.Replace(value))
+		return
+	}
+
+	fmt.Fprintf(w, "%s \"\"\n", keyword)
+	for _, line := range lines {
+		fmt.Fprintf(w, "\"%s\"\n", poEscaper.Replace(line))
+	}
+}
+
+var poEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+
+// ReadPO reads the entries of a PO file written by WritePO, or by any tool
+// that keeps their msgctxt. Entries without a msgctxt are skipped.
+func ReadPO(r io.Reader) (*Document, error) {
+	doc := &Document{}
+
+	var entry poEntry
+	var field *string
+	flush := func() {
+		defer func() { entry = poEntry{}; field = nil }()
+
+		if !entry.hasID {
+			return
+		}
+		if entry.msgid == "" && !entry.hasContext {
+			// The header entry
+			headers := parsePOHeader(entry.msgstr)
+			doc.TargetLang = util.LanguageName(headers["Language"])
+			doc.SourceLang = util.LanguageName(headers["X-Source-Language"])
+			return
+		}
+		if !entry.hasContext {
+			return
+		}
+
+		state := editedState(ParseState(string(entry.state)), entry.msgstr)
+		if entry.fuzzy {
+			state = StateInitial
+		}
+		doc.Segments = append(doc.Segments, Segment{
+			ID:     entry.msgctxt,
+			File:   entry.file,
+			Spine:  entry.spine,
+			Source: entry.msgid,
+			Target: entry.msgstr,
+			State:  state,
+		})
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") && entry.hasID {
+			// Comments start a new entry when the previous one was not followed by a blank line
+			flush()
+		}
+
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, "#~"):
+			// Obsolete entries are not part of the book any more
+		case strings.HasPrefix(line, "#. "+poSpineComment):
+			entry.spine, _ = strconv.Atoi(strings.TrimPrefix(line, "#. "+poSpineComment))
+		case strings.HasPrefix(line, "#. "+poStateComment):
+			entry.state = ParseState(strings.TrimPrefix(line, "#. "+poStateComment))
+		case strings.HasPrefix(line, "#:"):
+			if entry.file == "" {
+				entry.file = parsePOReference(strings.TrimSpace(strings.TrimPrefix(line, "#:")))
+			}
+		case strings.HasPrefix(line, "#,"):
+			for _, flag := range strings.Split(strings.TrimPrefix(line, "#,"), ",") {
+				if strings.TrimSpace(flag) == "fuzzy" {
+					entry.fuzzy = true
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+			// Translator comments
+		case strings.HasPrefix(line, `"`):
+			if field == nil {
+				return nil, fmt.Errorf("line %d: string without a keyword", lineNumber)
+			}
+			value, err := unquotePO(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+			*field += value
+		default:
+			keyword, quoted, ok := strings.Cut(line, " ")
+			if !ok {
+				return nil, fmt.Errorf("line %d: unexpected %q", lineNumber, line)
+			}
+			value, err := unquotePO(strings.TrimSpace(quoted))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+
+			switch keyword {
+			case "msgctxt":
+				if entry.hasID {
+					flush()
+				}
+				entry.hasContext = true
+				field = &entry.msgctxt
+			case "msgid":
+				entry.hasID = true
+				field = &entry.msgid
+			case "msgstr", "msgstr[0]":
+				field = &entry.msgstr
+			default:
+				// Plural forms and previous strings are not used for segments
+				var ignored string
+				field = &ignored
+			}
+			*field = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read PO file: %w", err)
+	}
+	flush()
+
+	return doc, nil
+}
+
+type poEntry struct {
+	msgctxt    string
+	msgid      string
+	msgstr     string
+	hasContext bool
+	hasID      bool
+	file       string
+	spine      int
+	state      State
+	fuzzy      bool
+}
+
+func unquotePO(quoted string) (string, error) {
+	if len(quoted) < 2 || quoted[0] != '"' || quoted[len(quoted)-1] != '"' {
+		return "", fmt.Errorf("invalid PO string %s", quoted)
+	}
+
+	var b strings.Builder
+	inner := quoted[1 : len(quoted)-1]
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		if c != '\\' || i+1 == len(inner) {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		switch inner[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		default:
+			b.WriteByte(inner[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// poReference formats a file reference, isolating names that contain spaces
+// with U+2068 and U+2069 as GNU gettext does.
+func poReference(file string) string {
+	if strings.ContainsAny(file, " \t") {
+		return "\u2068" + file + "\u2069"
+	}
+	return file
+}
+
+// parsePOReference returns the file of the first reference on a "#:" line.
+func parsePOReference(references string) string {
+	if rest, ok := strings.CutPrefix(references, "\u2068"); ok {
+		file, _, _ := strings.Cut(rest, "\u2069")
+		return file
+	}
+	if fields := strings.Fields(references); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+func parsePOHeader(header string) map[string]string {
+	headers := make(map[string]string)
+	for _, line := range strings.Split(header, "\n") {
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
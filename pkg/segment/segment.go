@@ -0,0 +1,178 @@
+package segment
+
+import (
+	"fmt"
+	"html"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/nguyenvanduocit/epubtrans/pkg/loader"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// State is the review state of a segment, using the XLIFF 2 state values.
+type State string
+
+const (
+	StateInitial    State = "initial"
+	StateTranslated State = "translated"
+	StateReviewed   State = "reviewed"
+	StateFinal      State = "final"
+)
+
+// Segment is one marked element of the book, the unit exchanged with
+// translators and CAT tools.
+type Segment struct {
+	ID     string `json:"id"`
+	File   string `json:"file"`  // path relative to the unpacked book, slash separated
+	Spine  int    `json:"spine"` // position of the file in the spine, starting at 1
+	Source string `json:"source"`
+	Target string `json:"target,omitempty"`
+	State  State  `json:"state"`
+}
+
+// Document is a set of segments exchanged with another tool, and their
+// languages when the file format records them.
+type Document struct {
+	SourceLang string
+	TargetLang string
+	Segments   []Segment
+}
+
+// ParseState returns the State named by value, defaulting to StateInitial.
+func ParseState(value string) State {
+	switch State(value) {
+	case StateTranslated, StateReviewed, StateFinal:
+		return State(value)
+	default:
+		return StateInitial
+	}
+}
+
+// editedState returns the state of a segment read from a file that a
+// translator may have edited by hand, where filling in the target of an
+// initial segment is enough to translate it.
+func editedState(state State, target string) State {
+	switch {
+	case target == "":
+		return StateInitial
+	case state == StateInitial:
+		return StateTranslated
+	default:
+		return state
+	}
+}
+
+// Collect returns the segments of the unpacked book at unzipPath in spine
+// order. Source and Target hold the inner HTML of the marked element and of
+// its translated sibling, if there is one.
+func Collect(unzipPath string) ([]Segment, error) {
+	files, err := SpineFiles(unzipPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for i, file := range files {
+		doc, err := util.OpenAndReadFile(filepath.Join(unzipPath, filepath.FromSlash(file)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open and read file: %w", err)
+		}
+
+		var collectErr error
+		doc.Find("[" + util.ContentIdKey + "]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+			id, _ := s.Attr(util.ContentIdKey)
+			source, err := s.Html()
+			if err != nil {
+				collectErr = fmt.Errorf("failed to read %s in %s: %w", id, file, err)
+				return false
+			}
+
+			segment := Segment{ID: id, File: file, Spine: i + 1, Source: source, State: StateInitial}
+			if translated := Translation(doc.Selection, s); translated != nil {
+				if segment.Target, err = translated.Html(); err != nil {
+					collectErr = fmt.Errorf("failed to read the translation of %s in %s: %w", id, file, err)
+					return false
+				}
+				segment.State = StateTranslated
+				if state, ok := translated.Attr(util.TranslationStateKey); ok {
+					segment.State = ParseState(state)
+				}
+			}
+
+			segments = append(segments, segment)
+			return true
+		})
+		if collectErr != nil {
+			return nil, collectErr
+		}
+	}
+
+	return segments, nil
+}
+
+// Translation returns the translated sibling of the marked element source, or
+// nil if it has not been translated.
+func Translation(doc, source *goquery.Selection) *goquery.Selection {
+	translationID, ok := source.Attr(util.TranslationByIdKey)
+	if !ok {
+		return nil
+	}
+
+	translated := doc.Find(fmt.Sprintf("[%s=%q]", util.TranslationIdKey, translationID)).First()
+	if translated.Length() == 0 {
+		return nil
+	}
+	return translated
+}
+
+// SpineFiles returns the XHTML documents of the spine in reading order, as
+// slash separated paths relative to unzipPath.
+func SpineFiles(unzipPath string) ([]string, error) {
+	container, err := loader.ParseContainer(unzipPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load EPUB container: %w", err)
+	}
+
+	pkg, err := loader.ParsePackage(filepath.Join(unzipPath, container.Rootfile.FullPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse package: %w", err)
+	}
+
+	contentDir := filepath.Dir(filepath.FromSlash(container.Rootfile.FullPath))
+
+	var files []string
+	for _, itemRef := range pkg.Spine.ItemRefs {
+		item := pkg.Manifest.GetItemByID(itemRef.IDRef)
+		if item == nil || item.MediaType != "application/xhtml+xml" {
+			continue
+		}
+		files = append(files, filepath.ToSlash(filepath.Join(contentDir, filepath.FromSlash(item.Href))))
+	}
+
+	return files, nil
+}
+
+var (
+	tagRegex        = regexp.MustCompile(`<[^>]*>`)
+	elementTagRegex = regexp.MustCompile(`<([a-zA-Z][a-zA-Z0-9:-]*)`)
+)
+
+// Text returns the plain text of an HTML fragment with whitespace collapsed,
+// which is how segments are compared across exports and imports.
+func Text(content string) string {
+	return strings.Join(strings.Fields(html.UnescapeString(tagRegex.ReplaceAllString(content, " "))), " ")
+}
+
+// Tags returns the sorted names of the elements opened in an HTML fragment.
+func Tags(content string) []string {
+	var tags []string
+	for _, match := range elementTagRegex.FindAllStringSubmatch(content, -1) {
+		tags = append(tags, strings.ToLower(match[1]))
+	}
+	sort.Strings(tags)
+	return tags
+}
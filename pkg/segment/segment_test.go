@@ -0,0 +1,82 @@
+package segment
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var roundTripSegments = []Segment{
+	{ID: "a1", File: "OEBPS/chapter1.xhtml", Spine: 1, Source: "The first chapter", Target: "Chương một", State: StateTranslated},
+	{ID: "a2", File: "OEBPS/chapter1.xhtml", Spine: 1, Source: `Say "hi" &amp; <em class="x">wave</em>,	then\\leave`, Target: `Nói "chào" &amp; <em class="x">vẫy tay</em>`, State: StateReviewed},
+	{ID: "a3", File: "OEBPS/chapter1.xhtml", Spine: 1, Source: "Two\nlines\n", Target: "Hai\ndòng\n", State: StateFinal},
+	{ID: "b1", File: "OEBPS/Text/chapter 2.xhtml", Spine: 2, Source: "Not translated yet", State: StateInitial},
+}
+
+func TestFormatsRoundTrip(t *testing.T) {
+	formats := []struct {
+		name  string
+		write func(w io.Writer, segments []Segment) error
+		read  func(r io.Reader) (*Document, error)
+	}{
+		{"po", func(w io.Writer, segments []Segment) error { return WritePO(w, "English", "Vietnamese", segments) }, ReadPO},
+		{"csv", WriteCSV, ReadCSV},
+		{"jsonl", WriteJSONL, ReadJSONL},
+	}
+
+	for _, format := range formats {
+		t.Run(format.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := format.write(&buf, roundTripSegments); err != nil {
+				t.Fatalf("write error = %v", err)
+			}
+			doc, err := format.read(&buf)
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+			if !reflect.DeepEqual(doc.Segments, roundTripSegments) {
+				t.Errorf("round trip = %+v, want %+v", doc.Segments, roundTripSegments)
+			}
+		})
+	}
+}
+
+func TestReadPOEditedByHand(t *testing.T) {
+	input := `msgid ""
+msgstr ""
+"Language: vi\n"
+"X-Source-Language: en\n"
+
+#. spine: 1
+#: OEBPS/chapter1.xhtml
+msgctxt "a1"
+msgid "Filled in by a volunteer"
+msgstr "Do tình nguyện viên điền"
+#, fuzzy
+msgctxt "a2"
+msgid "Needs work"
+msgstr "Cần sửa"
+
+# An entry from another tool
+msgid "No context"
+msgstr "Không có ngữ cảnh"
+`
+
+	doc, err := ReadPO(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ReadPO() error = %v", err)
+	}
+
+	if doc.SourceLang != "English" || doc.TargetLang != "Vietnamese" {
+		t.Errorf("ReadPO() languages = %q, %q", doc.SourceLang, doc.TargetLang)
+	}
+	want := []Segment{
+		{ID: "a1", File: "OEBPS/chapter1.xhtml", Spine: 1, Source: "Filled in by a volunteer", Target: "Do tình nguyện viên điền", State: StateTranslated},
+		{ID: "a2", Source: "Needs work", Target: "Cần sửa", State: StateInitial},
+	}
+	if !reflect.DeepEqual(doc.Segments, want) {
+		t.Errorf("ReadPO() = %+v, want %+v", doc.Segments, want)
+	}
+}
@@ -0,0 +1,221 @@
+// Package summary keeps the chapter summaries of a book, generated before
+// translation so every batch knows the story so far and who is who.
+package summary
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// FileName is the location of the summaries relative to the unpacked book.
+const FileName = "META-INF/summaries.json"
+
+// MaxRunningChapters bounds the earlier chapters whose summaries are sent with
+// a batch. The characters and terms of all earlier chapters are always sent.
+const MaxRunningChapters = 10
+
+// Term is a character, place or recurring term of a chapter.
+type Term struct {
+	Name string `json:"name"`
+	Note string `json:"note,omitempty"`
+}
+
+// Chapter is the summary of one spine document.
+type Chapter struct {
+	// File is the path of the document relative to the unpacked book
+	File    string `json:"file"`
+	Summary string `json:"summary"`
+	Terms   []Term `json:"terms,omitempty"`
+}
+
+// Summaries holds the chapter summaries of a book in reading order.
+type Summaries struct {
+	path     string
+	Chapters []Chapter
+}
+
+type summariesFile struct {
+	Chapters []Chapter `json:"chapters"`
+}
+
+// Path returns the summaries location for the book unpacked at unzipPath.
+func Path(unzipPath string) string {
+	return filepath.Join(unzipPath, FileName)
+}
+
+// Load reads the summaries of the book unpacked at unzipPath. A book without
+// summaries gets an empty set.
+func Load(unzipPath string) (*Summaries, error) {
+	s := &Summaries{path: Path(unzipPath)}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chapter summaries: %w", err)
+	}
+
+	var file summariesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse chapter summaries: %w", err)
+	}
+	s.Chapters = file.Chapters
+
+	return s, nil
+}
+
+// Save writes the summaries back to the book.
+func (s *Summaries) Save() error {
+	data, err := json.MarshalIndent(summariesFile{Chapters: s.Chapters}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal chapter summaries: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create summaries directory: %w", err)
+	}
+	if err := util.WriteFileAtomic(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write chapter summaries: %w", err)
+	}
+
+	return nil
+}
+
+// Get returns the summary of file.
+func (s *Summaries) Get(file string) (Chapter, bool) {
+	if s == nil {
+		return Chapter{}, false
+	}
+	for _, chapter := range s.Chapters {
+		if chapter.File == file {
+			return chapter, true
+		}
+	}
+	return Chapter{}, false
+}
+
+// Set adds or replaces the summary of chapter.File, keeping the chapters
+// sorted by their position in order. Files missing from order go last.
+func (s *Summaries) Set(chapter Chapter, order []string) {
+	if i := slices.IndexFunc(s.Chapters, func(c Chapter) bool { return c.File == chapter.File }); i >= 0 {
+		s.Chapters[i] = chapter
+	} else {
+		s.Chapters = append(s.Chapters, chapter)
+	}
+
+	position := func(file string) int {
+		if i := slices.Index(order, file); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(s.Chapters, func(a, b Chapter) int {
+		return position(a.File) - position(b.File)
+	})
+}
+
+// Prompt formats the running summary of the book up to file for the system
+// prompt: the summaries of the chapters before it in order, most recent last,
+// the summary of file itself and the characters and terms met so far. A file
+// missing from order has no chapters before it. It returns an empty string
+// when there is nothing to tell.
+func (s *Summaries) Prompt(file string, order []string) string {
+	if s == nil {
+		return ""
+	}
+
+	position := slices.Index(order, file)
+	var earlier []Chapter
+	for _, chapter := range s.Chapters {
+		if i := slices.Index(order, chapter.File); i >= 0 && i < position {
+			earlier = append(earlier, chapter)
+		}
+	}
+	current, found := s.Get(file)
+
+	var b strings.Builder
+	if len(earlier) > 0 {
+		b.WriteString("STORY SO FAR:\nSummaries of the earlier chapters, for consistent names, honorifics and references. Do not translate them.\n")
+		for _, chapter := range earlier[max(0, len(earlier)-MaxRunningChapters):] {
+			fmt.Fprintf(&b, "- %s\n", chapter.Summary)
+		}
+	}
+	if found && current.Summary != "" {
+		fmt.Fprintf(&b, "\nTHIS CHAPTER:\n%s\n", current.Summary)
+	}
+
+	chapters := earlier
+	if found {
+		chapters = append(chapters, current)
+	}
+	if terms := mergeTerms(chapters); len(terms) > 0 {
+		b.WriteString("\nCHARACTERS AND TERMS:\nRender them the same way in every chapter.\n")
+		for _, term := range terms {
+			b.WriteString("- ")
+			b.WriteString(term.Name)
+			if term.Note != "" {
+				fmt.Fprintf(&b, ": %s", term.Note)
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	return strings.TrimSpace(b.String())
+}
+
+// mergeTerms returns the terms of chapters once each, in order of first
+// appearance, with the most recent note.
+func mergeTerms(chapters []Chapter) []Term {
+	var terms []Term
+	index := make(map[string]int)
+	for _, chapter := range chapters {
+		for _, term := range chapter.Terms {
+			key := strings.ToLower(strings.TrimSpace(term.Name))
+			if key == "" {
+				continue
+			}
+			if i, ok := index[key]; ok {
+				if term.Note != "" {
+					terms[i].Note = term.Note
+				}
+				continue
+			}
+			index[key] = len(terms)
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// Parse reads the summary of file from a model's response, which is asked for
+// a JSON object with a summary and a list of terms. A response without such an
+// object is kept whole as the summary.
+func Parse(file, response string) Chapter {
+	chapter := Chapter{File: file}
+
+	var parsed struct {
+		Summary string `json:"summary"`
+		Terms   []Term `json:"terms"`
+	}
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start >= 0 && end > start && json.Unmarshal([]byte(response[start:end+1]), &parsed) == nil && parsed.Summary != "" {
+		chapter.Summary = strings.TrimSpace(parsed.Summary)
+		for _, term := range parsed.Terms {
+			if name := strings.TrimSpace(term.Name); name != "" {
+				chapter.Terms = append(chapter.Terms, Term{Name: name, Note: strings.TrimSpace(term.Note)})
+			}
+		}
+		return chapter
+	}
+
+	chapter.Summary = strings.TrimSpace(response)
+	return chapter
+}
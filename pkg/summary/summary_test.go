@@ -0,0 +1,108 @@
+package summary
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	response := "Here it is:\n```json\n" + `{"summary": " Winston walks home. ", "terms": [
+  {"name": "Winston Smith", "note": "the narrator, called Comrade Smith"},
+  {"name": " ", "note": "nameless"},
+  {"name": "Victory Mansions"}
+]}` + "\n```"
+
+	got := Parse("OEBPS/ch1.xhtml", response)
+	want := Chapter{
+		File:    "OEBPS/ch1.xhtml",
+		Summary: "Winston walks home.",
+		Terms: []Term{
+			{Name: "Winston Smith", Note: "the narrator, called Comrade Smith"},
+			{Name: "Victory Mansions"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse() = %+v, want %+v", got, want)
+	}
+
+	if got := Parse("ch2.xhtml", " Just a summary. "); got.Summary != "Just a summary." || got.Terms != nil {
+		t.Errorf("Parse() of a plain response = %+v, want it kept as the summary", got)
+	}
+}
+
+func TestLoadSetAndSave(t *testing.T) {
+	unzipPath := t.TempDir()
+	order := []string{"ch1.xhtml", "ch2.xhtml", "ch3.xhtml"}
+
+	s, err := Load(unzipPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	s.Set(Chapter{File: "ch3.xhtml", Summary: "Three"}, order)
+	s.Set(Chapter{File: "ch1.xhtml", Summary: "One"}, order)
+	s.Set(Chapter{File: "ch3.xhtml", Summary: "Three again"}, order)
+	if err := s.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	again, err := Load(unzipPath)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	want := []Chapter{{File: "ch1.xhtml", Summary: "One"}, {File: "ch3.xhtml", Summary: "Three again"}}
+	if !reflect.DeepEqual(again.Chapters, want) {
+		t.Errorf("chapters = %+v, want %+v", again.Chapters, want)
+	}
+}
+
+func TestPrompt(t *testing.T) {
+	s := &Summaries{Chapters: []Chapter{
+		{File: "ch1.xhtml", Summary: "Winston buys a diary.", Terms: []Term{{Name: "Winston"}, {Name: "Big Brother", Note: "the leader"}}},
+		{File: "ch2.xhtml", Summary: "Winston meets Julia.", Terms: []Term{{Name: "Julia"}, {Name: "winston", Note: "a clerk at the Ministry"}}},
+		{File: "ch3.xhtml", Summary: "They are caught.", Terms: []Term{{Name: "O'Brien"}}},
+	}}
+
+	order := []string{"ch1.xhtml", "ch2.xhtml", "ch2b.xhtml", "ch3.xhtml"}
+
+	got := s.Prompt("ch2.xhtml", order)
+	for _, want := range []string{
+		"STORY SO FAR:",
+		"- Winston buys a diary.\n",
+		"THIS CHAPTER:\nWinston meets Julia.\n",
+		"- Winston: a clerk at the Ministry\n- Big Brother: the leader\n- Julia",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Prompt() does not contain %q:\n%s", want, got)
+		}
+	}
+	for _, unwanted := range []string{"They are caught", "O'Brien"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("Prompt() tells about a later chapter, %q:\n%s", unwanted, got)
+		}
+	}
+
+	if got := s.Prompt("ch1.xhtml", order); strings.Contains(got, "STORY SO FAR") || !strings.HasPrefix(got, "THIS CHAPTER:") {
+		t.Errorf("Prompt() of the first chapter = %q, want only the chapter itself", got)
+	}
+
+	// A chapter without a summary still gets only the chapters before it
+	got = s.Prompt("ch2b.xhtml", order)
+	if !strings.Contains(got, "- Winston meets Julia.\n") || strings.Contains(got, "THIS CHAPTER") {
+		t.Errorf("Prompt() of a chapter without summary = %q, want the earlier chapters only", got)
+	}
+	for _, unwanted := range []string{"They are caught", "O'Brien"} {
+		if strings.Contains(got, unwanted) {
+			t.Errorf("Prompt() of a chapter without summary tells about a later chapter, %q:\n%s", unwanted, got)
+		}
+	}
+
+	if got := s.Prompt("notes.xhtml", order); got != "" {
+		t.Errorf("Prompt() of a document outside the reading order = %q, want empty", got)
+	}
+
+	var none *Summaries
+	if got := none.Prompt("ch1.xhtml", order); got != "" {
+		t.Errorf("Prompt() without summaries = %q, want empty", got)
+	}
+}
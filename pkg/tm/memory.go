@@ -0,0 +1,281 @@
+// Package tm is a local translation memory shared by every book translated
+// on the machine. Entries are appended to a JSON lines file.
+package tm
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultThreshold is the minimum similarity of a fuzzy match.
+const DefaultThreshold = 0.75
+
+// Entry is a translated segment. Source and Target are HTML fragments.
+type Entry struct {
+	SourceLang string    `json:"source_lang"`
+	TargetLang string    `json:"target_lang"`
+	Source     string    `json:"source"`
+	Target     string    `json:"target"`
+	Book       string    `json:"book,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Match is an entry similar to a looked up segment. Score is 1 for an exact
+// match and falls towards 0 as more words differ.
+type Match struct {
+	Entry Entry
+	Score float64
+}
+
+type record struct {
+	entry  Entry
+	tokens []string
+}
+
+// Memory is safe for concurrent use.
+type Memory struct {
+	path string
+
+	mu      sync.RWMutex
+	records []*record
+	byKey   map[string]*record
+}
+
+// DefaultPath returns the memory shared by all books of the current user.
+func DefaultPath() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user config directory: %w", err)
+	}
+
+	return filepath.Join(configDir, "epubtrans", "memory.jsonl"), nil
+}
+
+// Open loads the memory stored at path, which is created on the first Add.
+func Open(path string) (*Memory, error) {
+	if path == "" {
+		return nil, errors.New("translation memory path cannot be empty")
+	}
+
+	m := &Memory{
+		path:  path,
+		byKey: make(map[string]*record),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open translation memory: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			// A line cut short by a crash should not lose the whole memory
+			continue
+		}
+		m.insert(entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read translation memory: %w", err)
+	}
+
+	return m, nil
+}
+
+// Path returns the file backing the memory.
+func (m *Memory) Path() string {
+	return m.path
+}
+
+// Len returns the number of entries.
+func (m *Memory) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.byKey)
+}
+
+// Add stores entry, replacing an earlier translation of the same source. It
+// returns without writing if the memory already holds the same translation.
+func (m *Memory) Add(entry Entry) error {
+	if strings.TrimSpace(entry.Source) == "" || strings.TrimSpace(entry.Target) == "" {
+		return nil
+	}
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing, ok := m.byKey[entryKey(entry.SourceLang, entry.TargetLang, entry.Source)]; ok && existing.entry.Target == entry.Target {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal translation memory entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to create translation memory directory: %w", err)
+	}
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open translation memory: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write translation memory: %w", err)
+	}
+
+	m.insert(entry)
+	return nil
+}
+
+// insert adds entry to the in-memory index; the caller holds the lock.
+func (m *Memory) insert(entry Entry) {
+	key := entryKey(entry.SourceLang, entry.TargetLang, entry.Source)
+	if existing, ok := m.byKey[key]; ok {
+		existing.entry = entry
+		return
+	}
+
+	r := &record{entry: entry, tokens: tokenize(entry.Source)}
+	m.records = append(m.records, r)
+	m.byKey[key] = r
+}
+
+// Entries returns every entry, oldest first.
+func (m *Memory) Entries() []Entry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(m.records))
+	for _, r := range m.records {
+		entries = append(entries, r.entry)
+	}
+	return entries
+}
+
+// Exact returns the translation of source, ignoring differences in whitespace.
+func (m *Memory) Exact(sourceLang, targetLang, source string) (Entry, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	r, ok := m.byKey[entryKey(sourceLang, targetLang, source)]
+	if !ok {
+		return Entry{}, false
+	}
+	return r.entry, true
+}
+
+// Fuzzy returns up to limit entries whose source scores at least threshold
+// against source, best first. Scores are one minus the word-level edit
+// distance divided by the length of the longer segment.
+func (m *Memory) Fuzzy(sourceLang, targetLang, source string, threshold float64, limit int) []Match {
+	tokens := tokenize(source)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var matches []Match
+	for _, r := range m.records {
+		if !strings.EqualFold(r.entry.SourceLang, sourceLang) || !strings.EqualFold(r.entry.TargetLang, targetLang) {
+			continue
+		}
+
+		// The edit distance is at least the difference in length
+		shorter, longer := len(tokens), len(r.tokens)
+		if shorter > longer {
+			shorter, longer = longer, shorter
+		}
+		if longer == 0 || float64(shorter)/float64(longer) < threshold {
+			continue
+		}
+
+		score := similarity(tokens, r.tokens)
+		if score >= threshold {
+			matches = append(matches, Match{Entry: r.entry, Score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Score > matches[j].Score
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	return matches
+}
+
+func entryKey(sourceLang, targetLang, source string) string {
+	return strings.ToLower(sourceLang) + "\x00" + strings.ToLower(targetLang) + "\x00" + strings.Join(strings.Fields(source), " ")
+}
+
+var (
+	tagRegex  = regexp.MustCompile(`<[^>]*>`)
+	wordRegex = regexp.MustCompile(`[\p{L}\p{N}]+`)
+)
+
+// tokenize returns the lowercase words of the text in an HTML fragment.
+func tokenize(content string) []string {
+	text := html.UnescapeString(tagRegex.ReplaceAllString(content, " "))
+	return wordRegex.FindAllString(strings.ToLower(text), -1)
+}
+
+func similarity(a, b []string) float64 {
+	longer := max(len(a), len(b))
+	if longer == 0 {
+		return 1
+	}
+	return 1 - float64(editDistance(a, b))/float64(longer)
+}
+
+// editDistance is the Levenshtein distance between two word sequences.
+func editDistance(a, b []string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
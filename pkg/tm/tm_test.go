@@ -0,0 +1,82 @@
+package tm
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryExactAndFuzzy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "memory.jsonl")
+	m, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	entries := []Entry{
+		{SourceLang: "English", TargetLang: "Vietnamese", Source: "<p>The cat sat on the mat today.</p>", Target: "<p>Con mèo ngồi trên thảm hôm nay.</p>"},
+		{SourceLang: "English", TargetLang: "Vietnamese", Source: "<p>Something else entirely.</p>", Target: "<p>Một thứ khác hẳn.</p>"},
+		{SourceLang: "English", TargetLang: "French", Source: "<p>The cat sat on the mat today.</p>", Target: "<p>Le chat était assis sur le tapis.</p>"},
+	}
+	for _, entry := range entries {
+		if err := m.Add(entry); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+
+	// Reopening reads the entries back from disk
+	m, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if m.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", m.Len())
+	}
+
+	if got, ok := m.Exact("English", "Vietnamese", "<p>The cat sat on   the mat today.</p>"); !ok || got.Target != entries[0].Target {
+		t.Errorf("Exact() = %+v, %v, want the Vietnamese entry", got, ok)
+	}
+
+	matches := m.Fuzzy("English", "Vietnamese", "<p>The <em>dog</em> sat on the mat today.</p>", DefaultThreshold, 5)
+	if len(matches) != 1 || matches[0].Entry.Target != entries[0].Target {
+		t.Fatalf("Fuzzy() = %+v, want one Vietnamese match", matches)
+	}
+	if matches[0].Score < 0.85 || matches[0].Score >= 1 {
+		t.Errorf("Fuzzy() score = %v, want one word in seven to differ", matches[0].Score)
+	}
+
+	if matches := m.Fuzzy("English", "Vietnamese", "<p>A completely unrelated sentence here.</p>", DefaultThreshold, 5); len(matches) != 0 {
+		t.Errorf("Fuzzy() = %+v, want no matches", matches)
+	}
+}
+
+func TestTMXRoundTrip(t *testing.T) {
+	entries := []Entry{
+		{SourceLang: "English", TargetLang: "Vietnamese", Source: `Tom &amp; <b>Jerry</b><br/> <a href="x.html">link</a>`, Target: `Tom &amp; <b>Jerry</b><br/> <a href="x.html">liên kết</a>`, Book: "Series"},
+	}
+
+	var buf bytes.Buffer
+	if err := WriteTMX(&buf, entries); err != nil {
+		t.Fatalf("WriteTMX() error = %v", err)
+	}
+	for _, want := range []string{`version="1.4"`, `xml:lang="en"`, `xml:lang="vi"`, `<bpt i="1">&lt;b&gt;</bpt>`, `<ept i="1">&lt;/b&gt;</ept>`, `<ph>&lt;br/&gt;</ph>`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("TMX output does not contain %s:\n%s", want, buf.String())
+		}
+	}
+
+	got, err := ReadTMX(&buf)
+	if err != nil {
+		t.Fatalf("ReadTMX() error = %v", err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("ReadTMX() returned %d entries, want 1", len(got))
+	}
+	if got[0].Source != entries[0].Source || got[0].Target != entries[0].Target {
+		t.Errorf("round trip = %q -> %q, want %q -> %q", got[0].Source, got[0].Target, entries[0].Source, entries[0].Target)
+	}
+	if got[0].SourceLang != "English" || got[0].TargetLang != "Vietnamese" || got[0].Book != "Series" {
+		t.Errorf("round trip lost metadata: %+v", got[0])
+	}
+}
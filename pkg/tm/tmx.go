@@ -0,0 +1,251 @@
+package tm
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// tmxTimeFormat is the UTC timestamp format of TMX creationdate attributes.
+const tmxTimeFormat = "20060102T150405Z"
+
+type tmxDocument struct {
+	XMLName xml.Name  `xml:"tmx"`
+	Version string    `xml:"version,attr"`
+	Header  tmxHeader `xml:"header"`
+	Units   []tmxUnit `xml:"body>tu"`
+}
+
+type tmxHeader struct {
+	CreationTool        string `xml:"creationtool,attr"`
+	CreationToolVersion string `xml:"creationtoolversion,attr"`
+	SegType             string `xml:"segtype,attr"`
+	OTMF                string `xml:"o-tmf,attr"`
+	AdminLang           string `xml:"adminlang,attr"`
+	SrcLang             string `xml:"srclang,attr"`
+	DataType            string `xml:"datatype,attr"`
+}
+
+type tmxUnit struct {
+	CreationDate string       `xml:"creationdate,attr,omitempty"`
+	Props        []tmxProp    `xml:"prop"`
+	Variants     []tmxVariant `xml:"tuv"`
+}
+
+type tmxProp struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type tmxVariant struct {
+	Lang    string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	Segment tmxSeg `xml:"seg"`
+}
+
+type tmxSeg struct {
+	Inner string `xml:",innerxml"`
+}
+
+// WriteTMX writes entries to w as a TMX 1.4 document. Languages are written as
+// BCP 47 tags and HTML tags become paired bpt/ept or standalone ph codes.
+func WriteTMX(w io.Writer, entries []Entry) error {
+	doc := tmxDocument{
+		Version: "1.4",
+		Header: tmxHeader{
+			CreationTool:        "epubtrans",
+			CreationToolVersion: "1",
+			SegType:             "paragraph",
+			OTMF:                "epubtrans",
+			AdminLang:           "en",
+			SrcLang:             "*all*",
+			DataType:            "html",
+		},
+	}
+
+	for _, entry := range entries {
+		unit := tmxUnit{
+			Variants: []tmxVariant{
+				{Lang: util.LanguageCode(entry.SourceLang), Segment: tmxSeg{Inner: htmlToSeg(entry.Source)}},
+				{Lang: util.LanguageCode(entry.TargetLang), Segment: tmxSeg{Inner: htmlToSeg(entry.Target)}},
+			},
+		}
+		if !entry.CreatedAt.IsZero() {
+			unit.CreationDate = entry.CreatedAt.UTC().Format(tmxTimeFormat)
+		}
+		if entry.Book != "" {
+			unit.Props = append(unit.Props, tmxProp{Type: "x-book", Value: entry.Book})
+		}
+		doc.Units = append(doc.Units, unit)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode TMX: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// ReadTMX reads the translation units of a TMX document. Each unit becomes one
+// entry per target variant, paired with the first variant as the source.
+func ReadTMX(r io.Reader) ([]Entry, error) {
+	var doc tmxDocument
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode TMX: %w", err)
+	}
+
+	var entries []Entry
+	for _, unit := range doc.Units {
+		if len(unit.Variants) < 2 {
+			continue
+		}
+
+		// Prefer the declared source language when the header names one
+		sourceIndex := 0
+		for i, variant := range unit.Variants {
+			if doc.Header.SrcLang != "" && strings.EqualFold(variant.Lang, doc.Header.SrcLang) {
+				sourceIndex = i
+				break
+			}
+		}
+		sourceVariant := unit.Variants[sourceIndex]
+		source, err := segToHTML(sourceVariant.Segment.Inner)
+		if err != nil {
+			return nil, err
+		}
+
+		createdAt, _ := time.Parse(tmxTimeFormat, unit.CreationDate)
+		var book string
+		for _, prop := range unit.Props {
+			if prop.Type == "x-book" {
+				book = prop.Value
+			}
+		}
+
+		for i, variant := range unit.Variants {
+			if i == sourceIndex {
+				continue
+			}
+			target, err := segToHTML(variant.Segment.Inner)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, Entry{
+				SourceLang: util.LanguageName(sourceVariant.Lang),
+				TargetLang: util.LanguageName(variant.Lang),
+				Source:     source,
+				Target:     target,
+				Book:       book,
+				CreatedAt:  createdAt,
+			})
+		}
+	}
+
+	return entries, nil
+}
+
+var htmlTagRegex = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9:-]*)[^>]*?(/?)>`)
+
+// htmlToSeg converts an HTML fragment to the inner XML of a TMX seg element.
+func htmlToSeg(content string) string {
+	var b strings.Builder
+	var open []int
+	next := 1
+
+	text := func(s string) {
+		xml.EscapeText(&b, []byte(html.UnescapeString(s)))
+	}
+	code := func(element string, i int, tag string) {
+		if i > 0 {
+			fmt.Fprintf(&b, `<%s i="%d">`, element, i)
+		} else {
+			fmt.Fprintf(&b, `<%s>`, element)
+		}
+		xml.EscapeText(&b, []byte(tag))
+		fmt.Fprintf(&b, `</%s>`, element)
+	}
+
+	last := 0
+	for _, loc := range htmlTagRegex.FindAllStringSubmatchIndex(content, -1) {
+		text(content[last:loc[0]])
+		tag := content[loc[0]:loc[1]]
+		closing := loc[3] > loc[2]
+		selfClosing := loc[7] > loc[6] || voidElements[strings.ToLower(content[loc[4]:loc[5]])]
+
+		switch {
+		case closing && len(open) > 0:
+			code("ept", open[len(open)-1], tag)
+			open = open[:len(open)-1]
+		case closing, selfClosing:
+			code("ph", 0, tag)
+		default:
+			code("bpt", next, tag)
+			open = append(open, next)
+			next++
+		}
+		last = loc[1]
+	}
+	text(content[last:])
+
+	return b.String()
+}
+
+// segToHTML converts the inner XML of a TMX seg element back to HTML.
+func segToHTML(inner string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<seg>" + inner + "</seg>"))
+
+	var b strings.Builder
+	depth := 0
+	inCode := false
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to decode TMX segment: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "bpt", "ept", "ph", "it":
+				inCode = true
+			}
+		case xml.EndElement:
+			depth--
+			switch t.Name.Local {
+			case "bpt", "ept", "ph", "it":
+				inCode = false
+			}
+		case xml.CharData:
+			if depth == 0 {
+				continue
+			}
+			if inCode {
+				b.Write(t)
+			} else {
+				b.WriteString(util.EscapeText(string(t)))
+			}
+		}
+	}
+
+	return b.String(), nil
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
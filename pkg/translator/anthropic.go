@@ -21,20 +21,16 @@ import (
 	"github.com/liushuangls/go-anthropic/v2"
 )
 
-var (
-	_anthropic    *Anthropic
-	anthropicOnce sync.Once
-)
+const defaultAnthropicModel = "claude-3-5-sonnet-20241022"
+
+// anthropicBatchTool is the tool Claude is made to call with the translated
+// batch when a JSON response is requested
+const anthropicBatchTool = "submit_translations"
 
-type Config struct {
-	APIKey                string
-	Model                 string
-	Temperature           float32
-	MaxTokens             int
-	CacheTTL              time.Duration
-	CacheMaxCost          int64
-	TranslationGuidelines string // New field for translation guidelines
-	SystemPrompt          string // New field for system prompt
+func init() {
+	Register("anthropic", func(cfg *Config) (Translator, error) {
+		return NewAnthropic(cfg)
+	})
 }
 
 type UsageMetadata struct {
@@ -46,60 +42,60 @@ type UsageMetadata struct {
 	TokenUsageList []anthropic.MessagesUsage `json:"token_usage_list"`
 }
 
-func GetAnthropicTranslator(cfg *Config) (*Anthropic, error) {
-	var err error
-	anthropicOnce.Do(func() {
-		if cfg == nil {
-			cfg = &Config{
-				APIKey:      os.Getenv("ANTHROPIC_KEY"),
-				Model:       string(anthropic.ModelClaude3Dot5SonnetLatest),
-				Temperature: 0.3,
-				MaxTokens:   8192,
-			}
-		}
-
-		if cfg.APIKey == "" {
-			err = errors.New("missing ANTHROPIC_KEY")
-			return
+// NewAnthropic creates an independent Anthropic translator. A nil cfg uses
+// defaults with the key read from ANTHROPIC_API_KEY (or ANTHROPIC_KEY).
+func NewAnthropic(cfg *Config) (*Anthropic, error) {
+	if cfg == nil {
+		cfg = &Config{
+			Temperature: 0.3,
+			MaxTokens:   8192,
 		}
+	}
 
-		if cfg.TranslationGuidelines == "" {
-			cfg.TranslationGuidelines = os.Getenv("TRANSLATION_GUIDELINES")
-		}
-		if cfg.SystemPrompt == "" {
-			cfg.SystemPrompt = os.Getenv("SYSTEM_PROMPT")
-		}
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+	}
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("ANTHROPIC_KEY")
+	}
+	if cfg.APIKey == "" {
+		return nil, errors.New("missing ANTHROPIC_API_KEY")
+	}
 
-		cfg.CacheTTL = 15 * time.Minute
-		cfg.CacheMaxCost = 1e7
-
-		cache, cacheErr := ristretto.NewCache(&ristretto.Config{
-			NumCounters: 1e7,              // number of keys to track frequency of (10M).
-			MaxCost:     cfg.CacheMaxCost, // maximum cost of cache (1GB).
-			BufferItems: 64,               // number of keys per Get buffer.
-		})
-		if cacheErr != nil {
-			err = fmt.Errorf("failed to create cache: %w", cacheErr)
-			return
-		}
+	if cfg.Model == "" {
+		cfg.Model = defaultAnthropicModel
+	}
+	if cfg.TranslationGuidelines == "" {
+		cfg.TranslationGuidelines = os.Getenv("TRANSLATION_GUIDELINES")
+	}
+	if cfg.SystemPrompt == "" {
+		cfg.SystemPrompt = os.Getenv("SYSTEM_PROMPT")
+	}
 
-		_anthropic = &Anthropic{
-			client: anthropic.NewClient(cfg.APIKey, anthropic.WithBetaVersion(anthropic.BetaPromptCaching20240731),),
-			cache:  cache,
-			config: cfg,
-			metadata: &UsageMetadata{
-				ModelUsage: make(map[string]int),
-			},
-		}
+	cfg.CacheTTL = 15 * time.Minute
+	cfg.CacheMaxCost = 1e7
 
-		_anthropic.loadMetadata(context.Background()) // Pass a background context
+	cache, err := ristretto.NewCache(&ristretto.Config{
+		NumCounters: 1e7,              // number of keys to track frequency of (10M).
+		MaxCost:     cfg.CacheMaxCost, // maximum cost of cache (1GB).
+		BufferItems: 64,               // number of keys per Get buffer.
 	})
-
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to create cache: %w", err)
 	}
 
-	return _anthropic, nil
+	a := &Anthropic{
+		client: anthropic.NewClient(cfg.APIKey, anthropic.WithBetaVersion(anthropic.BetaPromptCaching20240731)),
+		cache:  cache,
+		config: cfg,
+		metadata: &UsageMetadata{
+			ModelUsage: make(map[string]int),
+		},
+	}
+
+	a.loadMetadata(context.Background()) // Pass a background context
+
+	return a, nil
 }
 
 func (a *Anthropic) loadMetadata(ctx context.Context) {
@@ -134,7 +130,14 @@ func (a *Anthropic) saveMetadata(ctx context.Context) {
 }
 
 func (a *Anthropic) getMetadataFilePath() string {
-	return filepath.Join("unpackage", "translator_metadata.json")
+	return filepath.Join(a.dataDir(), "translator_metadata.json")
+}
+
+func (a *Anthropic) dataDir() string {
+	if a.config.DataDir != "" {
+		return a.config.DataDir
+	}
+	return "unpackage"
 }
 
 type Anthropic struct {
@@ -164,10 +167,13 @@ func createTranslationSystem(source, target, guidelines, bookName, promptPreset
 	return fmt.Sprintf(guidelines, source, target, bookName)
 }
 
-func (a *Anthropic) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
+// TranslationSystem returns the system prompt sent with every translation
+// request, for callers that need to count its tokens.
+func TranslationSystem(source, target, guidelines, bookName, promptPreset string) string {
+	return createTranslationSystem(source, target, guidelines, bookName, promptPreset)
+}
 
+func (a *Anthropic) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
 	// Create log entry
 	logEntry := struct {
 		Timestamp time.Time              `json:"timestamp"`
@@ -178,7 +184,7 @@ func (a *Anthropic) Translate(ctx context.Context, promptPreset, content, source
 		Timestamp: time.Now(),
 	}
 
-	cacheKey := generateCacheKey(promptPreset+content, source, target)
+	cacheKey := generateCacheKey(promptPreset+notesKey(ctx)+content, source, target)
 
 	if promptPreset != "" {
 		if cachedTranslation, found := a.cache.Get(cacheKey); found {
@@ -189,7 +195,7 @@ func (a *Anthropic) Translate(ctx context.Context, promptPreset, content, source
 	systemMessages := []anthropic.MessageSystemPart{
 		{
 			Type: "text",
-			Text: createTranslationSystem(source, target, a.config.TranslationGuidelines, bookName, promptPreset),
+			Text: systemPrompt(ctx, source, target, a.config.TranslationGuidelines, bookName, promptPreset),
 			CacheControl: &anthropic.MessageCacheControl{
 				Type: anthropic.CacheControlTypeEphemeral,
 			},
@@ -202,9 +208,22 @@ func (a *Anthropic) Translate(ctx context.Context, promptPreset, content, source
 		Temperature: &a.config.Temperature,
 		MaxTokens:   a.config.MaxTokens,
 	}
+	if JSONResponse(ctx) {
+		req.Tools = []anthropic.ToolDefinition{{
+			Name:        anthropicBatchTool,
+			Description: "Submit the translated segments, one per source segment, with their ids unchanged.",
+			InputSchema: JSONBatchSchema,
+		}}
+		req.ToolChoice = &anthropic.ToolChoice{Type: "tool", Name: anthropicBatchTool}
+	}
 	logEntry.Request = req
 
 	resp, err := a.createMessageWithRetry(ctx, req)
+
+	// Only the bookkeeping is serialised, requests run in parallel
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
 	if err != nil {
 		logEntry.Error = err.Error()
 		a.writeLog(logEntry)
@@ -218,7 +237,9 @@ func (a *Anthropic) Translate(ctx context.Context, promptPreset, content, source
 		return "", errors.New("no translation received")
 	}
 
-	translation := resp.GetFirstContentText()
+	recordUsage(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+
+	translation := responseText(resp)
 	a.cache.SetWithTTL(cacheKey, translation, 0, a.config.CacheTTL)
 
 	// Update metadata
@@ -240,6 +261,68 @@ func (a *Anthropic) Translate(ctx context.Context, promptPreset, content, source
 	return translation, nil
 }
 
+// Complete skips the in-memory cache and the running usage metadata, which
+// are kept for translations only.
+func (a *Anthropic) Complete(ctx context.Context, system, prompt string) (string, error) {
+	logEntry := struct {
+		Timestamp time.Time                   `json:"timestamp"`
+		Request   anthropic.MessagesRequest   `json:"request"`
+		Response  *anthropic.MessagesResponse `json:"response"`
+		Error     string                      `json:"error,omitempty"`
+	}{
+		Timestamp: time.Now(),
+	}
+
+	req := anthropic.MessagesRequest{
+		Model:       anthropic.Model(a.config.Model),
+		System:      system,
+		Messages:    []anthropic.Message{anthropic.NewUserTextMessage(prompt)},
+		Temperature: &a.config.Temperature,
+		MaxTokens:   a.config.MaxTokens,
+	}
+	logEntry.Request = req
+
+	resp, err := a.createMessageWithRetry(ctx, req)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err != nil {
+		logEntry.Error = err.Error()
+		a.writeLog(logEntry)
+		return "", fmt.Errorf("createMessageWithRetry: %w", err)
+	}
+
+	logEntry.Response = resp
+	a.writeLog(logEntry)
+
+	recordUsage(ctx, resp.Usage.InputTokens, resp.Usage.OutputTokens)
+
+	completion := resp.GetFirstContentText()
+	if completion == "" {
+		return "", errors.New("no completion received")
+	}
+
+	return completion, nil
+}
+
+// SupportsJSON reports that Claude answers through a tool call when asked for
+// JSON.
+func (a *Anthropic) SupportsJSON() bool {
+	return true
+}
+
+// responseText returns the input of the tool call in resp, if any, or else
+// its first text.
+func responseText(resp *anthropic.MessagesResponse) string {
+	for _, content := range resp.Content {
+		if content.Type == anthropic.MessagesContentTypeToolUse && content.MessageContentToolUse != nil {
+			return string(content.Input)
+		}
+	}
+	return resp.GetFirstContentText()
+}
+
 const maxRetries = 3
 
 func (a *Anthropic) createMessageWithRetry(ctx context.Context, req anthropic.MessagesRequest) (*anthropic.MessagesResponse, error) {
@@ -335,7 +418,7 @@ func generateCacheKey(content, source, target string) string {
 }
 
 func (a *Anthropic) writeLog(entry interface{}) {
-	logFile := filepath.Join("unpackage", "translator.log")
+	logFile := filepath.Join(a.dataDir(), "translator.log")
 	
 	// Ensure directory exists
 	if err := os.MkdirAll(filepath.Dir(logFile), 0755); err != nil {
@@ -0,0 +1,80 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/cache"
+)
+
+// Cached decorates a Translator with a persistent on-disk cache, so
+// translations survive crashes and are shared between runs.
+type Cached struct {
+	next  Translator
+	store *cache.Store
+	model string
+}
+
+// NewCached wraps next with store. model is part of the cache key, so switching
+// models never returns another model's translations.
+func NewCached(next Translator, store *cache.Store, model string) *Cached {
+	return &Cached{
+		next:  next,
+		store: store,
+		model: model,
+	}
+}
+
+func (c *Cached) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	cacheKey := generateCacheKey(c.model+":"+promptPreset+notesKey(ctx)+content, source, target)
+
+	if entry, found := c.store.Get(cacheKey); found && responseAccepted(ctx, entry.Translation) {
+		return entry.Translation, nil
+	}
+
+	translation, err := c.next.Translate(ctx, promptPreset, content, source, target, bookName)
+	if err != nil {
+		return "", err
+	}
+	if !responseAccepted(ctx, translation) {
+		return translation, nil
+	}
+
+	if err := c.store.Put(cache.Entry{
+		Key:         cacheKey,
+		Model:       c.model,
+		Source:      source,
+		Target:      target,
+		Content:     content,
+		Translation: translation,
+	}); err != nil {
+		fmt.Printf("Warning: failed to cache translation: %v\n", err)
+	}
+
+	return translation, nil
+}
+
+func (c *Cached) CountTokens(ctx context.Context, content string) (float32, error) {
+	return c.next.CountTokens(ctx, content)
+}
+
+// Unwrap returns the decorated translator.
+func (c *Cached) Unwrap() Translator {
+	return c.next
+}
+
+type responseCheckKey struct{}
+
+// WithResponseCheck returns a context under which Cached only stores and
+// replays responses that check accepts, so a response the caller rejects is
+// requested again instead of being replayed on the next attempt.
+func WithResponseCheck(ctx context.Context, check func(response string) bool) context.Context {
+	return context.WithValue(ctx, responseCheckKey{}, check)
+}
+
+// responseAccepted reports whether the check added to ctx with
+// WithResponseCheck, if any, accepts response.
+func responseAccepted(ctx context.Context, response string) bool {
+	check, ok := ctx.Value(responseCheckKey{}).(func(string) bool)
+	return !ok || check(response)
+}
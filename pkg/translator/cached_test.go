@@ -0,0 +1,128 @@
+package translator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/cache"
+)
+
+func TestCachedTranslatorPersistsAcrossInstances(t *testing.T) {
+	dir := t.TempDir()
+	translate := func(model string) (*Mock, string) {
+		store, err := cache.Open(dir)
+		if err != nil {
+			t.Fatalf("cache.Open() error = %v", err)
+		}
+		mock, _ := NewMock(nil)
+
+		got, err := NewCached(mock, store, model).Translate(context.Background(), "technical", "<p>Hello</p>", "English", "Vietnamese", "Book")
+		if err != nil {
+			t.Fatalf("Translate() error = %v", err)
+		}
+		return mock, got
+	}
+
+	first, want := translate("model-a")
+	if first.Calls() != 1 {
+		t.Fatalf("first run made %d calls, want 1", first.Calls())
+	}
+
+	second, got := translate("model-a")
+	if second.Calls() != 0 {
+		t.Errorf("second run made %d calls, want a cache hit", second.Calls())
+	}
+	if got != want {
+		t.Errorf("cached translation = %q, want %q", got, want)
+	}
+
+	other, _ := translate("model-b")
+	if other.Calls() != 1 {
+		t.Errorf("different model made %d calls, want a cache miss", other.Calls())
+	}
+}
+
+func TestCachedTranslatorKeysOnSystemNotes(t *testing.T) {
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.Open() error = %v", err)
+	}
+	mock, _ := NewMock(nil)
+	cached := NewCached(mock, store, "model")
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		WithSystemNotes(context.Background(), "GLOSSARY: keep API in English"),
+		WithSystemNotes(context.Background(), "GLOSSARY: keep API in English"),
+	} {
+		if _, err := cached.Translate(ctx, "technical", "<p>Hello API</p>", "English", "Vietnamese", "Book"); err != nil {
+			t.Fatalf("Translate() error = %v", err)
+		}
+	}
+
+	if mock.Calls() != 2 {
+		t.Errorf("made %d calls, want one per distinct set of notes", mock.Calls())
+	}
+}
+
+func TestCachedTranslatorSkipsRejectedResponses(t *testing.T) {
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.Open() error = %v", err)
+	}
+	mock, _ := NewMock(nil)
+	cached := NewCached(mock, store, "model")
+
+	translate := func(accept bool) {
+		ctx := WithResponseCheck(context.Background(), func(string) bool { return accept })
+		if _, err := cached.Translate(ctx, "technical", "<p>Hello</p>", "English", "Vietnamese", "Book"); err != nil {
+			t.Fatalf("Translate() error = %v", err)
+		}
+	}
+
+	// A rejected response is neither stored nor replayed
+	translate(false)
+	translate(false)
+	if mock.Calls() != 2 {
+		t.Fatalf("made %d calls for rejected responses, want 2", mock.Calls())
+	}
+
+	translate(true)
+	translate(true)
+	if mock.Calls() != 3 {
+		t.Errorf("made %d calls, want the accepted response cached", mock.Calls())
+	}
+
+	// A cached response the caller now rejects is requested again
+	translate(false)
+	if mock.Calls() != 4 {
+		t.Errorf("made %d calls, want the rejected cache entry skipped", mock.Calls())
+	}
+}
+
+func TestAsCompleterUnwrapsCached(t *testing.T) {
+	store, err := cache.Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("cache.Open() error = %v", err)
+	}
+	mock, _ := NewMock(nil)
+
+	completer, ok := AsCompleter(NewCached(mock, store, "mock"))
+	if !ok {
+		t.Fatal("AsCompleter() found no completer behind the cache")
+	}
+	if completer != Completer(mock) {
+		t.Errorf("AsCompleter() = %T, want the decorated mock", completer)
+	}
+
+	got, err := completer.Complete(context.Background(), "Summarize.", "one two three")
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if want := "Mock completion of 3 words."; got != want {
+		t.Errorf("Complete() = %q, want %q", got, want)
+	}
+	if mock.Calls() != 0 {
+		t.Errorf("Complete() counted %d translate calls, want 0", mock.Calls())
+	}
+}
@@ -0,0 +1,28 @@
+package translator
+
+import "context"
+
+// Completer is implemented by translators that can answer a free-form prompt
+// under a system prompt of the caller's choosing, for requests other than
+// translations such as chapter summaries.
+type Completer interface {
+	// Complete answers prompt under system and adds the tokens it uses to the
+	// Usage of ctx. An empty answer is an error.
+	Complete(ctx context.Context, system, prompt string) (string, error)
+}
+
+// AsCompleter returns t, or the translator it decorates, as a Completer.
+// Completions are not cached, so a decorator's own cache is skipped.
+func AsCompleter(t Translator) (Completer, bool) {
+	for t != nil {
+		if completer, ok := t.(Completer); ok {
+			return completer, true
+		}
+		wrapper, ok := t.(interface{ Unwrap() Translator })
+		if !ok {
+			return nil, false
+		}
+		t = wrapper.Unwrap()
+	}
+	return nil, false
+}
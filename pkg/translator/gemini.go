@@ -0,0 +1,166 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/editor"
+	"google.golang.org/genai"
+)
+
+const defaultGeminiModel = "gemini-2.0-flash"
+
+// Gemini translates through the Gemini Models API. It shares the genai client
+// used by editor.Gemini unless a dedicated API key or base URL is configured.
+type Gemini struct {
+	client *genai.Client
+	config *Config
+}
+
+func init() {
+	Register("gemini", func(cfg *Config) (Translator, error) {
+		return NewGemini(cfg)
+	})
+}
+
+func NewGemini(cfg *Config) (*Gemini, error) {
+	if cfg == nil {
+		cfg = &Config{
+			Temperature: 0.3,
+			MaxTokens:   8192,
+		}
+	}
+
+	if cfg.Model == "" {
+		cfg.Model = defaultGeminiModel
+	}
+	if cfg.TranslationGuidelines == "" {
+		cfg.TranslationGuidelines = os.Getenv("TRANSLATION_GUIDELINES")
+	}
+
+	var client *genai.Client
+	var err error
+	if cfg.APIKey == "" && cfg.BaseURL == "" {
+		client, err = editor.GenAIClient()
+	} else {
+		apiKey := cfg.APIKey
+		if apiKey == "" {
+			apiKey = os.Getenv("GOOGLE_AI_API_KEY")
+		}
+		client, err = editor.NewGenAIClient(context.Background(), apiKey, cfg.BaseURL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Gemini{
+		client: client,
+		config: cfg,
+	}, nil
+}
+
+func (g *Gemini) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	translation, err := g.generate(ctx, systemPrompt(ctx, source, target, g.config.TranslationGuidelines, bookName, promptPreset), content, JSONResponse(ctx))
+	if err != nil {
+		return "", err
+	}
+	if translation == "" {
+		return "", errors.New("no translation received")
+	}
+
+	return translation, nil
+}
+
+func (g *Gemini) Complete(ctx context.Context, system, prompt string) (string, error) {
+	completion, err := g.generate(ctx, system, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	if completion == "" {
+		return "", errors.New("no completion received")
+	}
+
+	return completion, nil
+}
+
+// generate sends content under the system instruction and returns the text of
+// the response.
+func (g *Gemini) generate(ctx context.Context, system, content string, jsonMode bool) (string, error) {
+	temperature := float64(g.config.Temperature)
+	maxTokens := int64(g.config.MaxTokens)
+
+	genConfig := &genai.GenerateContentConfig{
+		SystemInstruction: &genai.Content{
+			Role: "system",
+			Parts: []*genai.Part{
+				{Text: system},
+			},
+		},
+		Temperature: &temperature,
+	}
+	if maxTokens > 0 {
+		genConfig.MaxOutputTokens = &maxTokens
+	}
+	if jsonMode {
+		genConfig.ResponseMIMEType = "application/json"
+	}
+
+	resp, err := g.client.Models.GenerateContent(ctx, g.config.Model, geminiUserContent(content), genConfig)
+	if err != nil {
+		return "", fmt.Errorf("generate content: %w", mapGeminiError(err))
+	}
+
+	if usage := resp.UsageMetadata; usage != nil {
+		var input, output int64
+		if usage.PromptTokenCount != nil {
+			input = *usage.PromptTokenCount
+		}
+		if usage.CandidatesTokenCount != nil {
+			output = *usage.CandidatesTokenCount
+		}
+		recordUsage(ctx, int(input), int(output))
+	}
+
+	text, err := resp.Text()
+	if err != nil {
+		return "", fmt.Errorf("read response text: %w", err)
+	}
+
+	return text, nil
+}
+
+// SupportsJSON reports that Gemini answers with the JSON MIME type when asked.
+func (g *Gemini) SupportsJSON() bool {
+	return true
+}
+
+func (g *Gemini) CountTokens(ctx context.Context, content string) (float32, error) {
+	resp, err := g.client.Models.CountTokens(ctx, g.config.Model, geminiUserContent(content), nil)
+	if err != nil {
+		return 0, fmt.Errorf("count tokens: %w", mapGeminiError(err))
+	}
+
+	return float32(resp.TotalTokens), nil
+}
+
+func geminiUserContent(content string) []*genai.Content {
+	return []*genai.Content{
+		{
+			Role:  "user",
+			Parts: []*genai.Part{{Text: content}},
+		},
+	}
+}
+
+// mapGeminiError turns HTTP 429 responses into ErrRateLimitExceeded.
+func mapGeminiError(err error) error {
+	var clientErr genai.ClientError
+	if errors.As(err, &clientErr) && clientErr.Code == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %s", ErrRateLimitExceeded, clientErr.Message)
+	}
+
+	return err
+}
@@ -0,0 +1,153 @@
+package translator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newGeminiStub(t *testing.T, handler http.HandlerFunc) *Gemini {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	g, err := NewGemini(&Config{
+		APIKey:      "test",
+		BaseURL:     server.URL,
+		Model:       "stub-model",
+		Temperature: 0.5,
+		MaxTokens:   1000,
+	})
+	if err != nil {
+		t.Fatalf("NewGemini() error = %v", err)
+	}
+	return g
+}
+
+// geminiRequest is the part of a generateContent request the tests check.
+type geminiRequest struct {
+	Contents []struct {
+		Role  string `json:"role"`
+		Parts []struct {
+			Text string `json:"text"`
+		} `json:"parts"`
+	} `json:"contents"`
+	SystemInstruction struct {
+		Parts []struct {
+			Text string `json:"text"`
+		} `json:"parts"`
+	} `json:"systemInstruction"`
+	GenerationConfig struct {
+		Temperature      float64 `json:"temperature"`
+		MaxOutputTokens  int     `json:"maxOutputTokens"`
+		ResponseMIMEType string  `json:"responseMimeType"`
+	} `json:"generationConfig"`
+}
+
+func TestGeminiTranslate(t *testing.T) {
+	g := newGeminiStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/stub-model:generateContent" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		var req geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if len(req.Contents) != 1 || req.Contents[0].Role != "user" || req.Contents[0].Parts[0].Text != "<p>Hello</p>" {
+			t.Errorf("unexpected contents: %+v", req.Contents)
+		}
+		if len(req.SystemInstruction.Parts) != 1 || !strings.Contains(req.SystemInstruction.Parts[0].Text, "GLOSSARY: keep API") {
+			t.Errorf("system instruction does not carry the notes: %+v", req.SystemInstruction)
+		}
+		if config := req.GenerationConfig; config.Temperature != 0.5 || config.MaxOutputTokens != 1000 || config.ResponseMIMEType != "application/json" {
+			t.Errorf("unexpected generation config: %+v", config)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"<p>Xin chào</p>"}]}}],"usageMetadata":{"promptTokenCount":12,"candidatesTokenCount":5}}`))
+	})
+
+	usage := &Usage{}
+	ctx := WithJSONResponse(WithSystemNotes(ContextWithUsage(context.Background(), usage), "GLOSSARY: keep API"))
+	got, err := g.Translate(ctx, "technical", "<p>Hello</p>", "English", "Vietnamese", "Book")
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if got != "<p>Xin chào</p>" {
+		t.Errorf("Translate() = %q, want %q", got, "<p>Xin chào</p>")
+	}
+	if *usage != (Usage{InputTokens: 12, OutputTokens: 5}) {
+		t.Errorf("usage = %+v, want the tokens reported by the response", *usage)
+	}
+}
+
+func TestGeminiCompleteWithoutJSON(t *testing.T) {
+	g := newGeminiStub(t, func(w http.ResponseWriter, r *http.Request) {
+		var req geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.SystemInstruction.Parts[0].Text != "Summarize." || req.GenerationConfig.ResponseMIMEType != "" {
+			t.Errorf("unexpected request: %+v", req)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":"A short summary."}]}}]}`))
+	})
+
+	got, err := g.Complete(context.Background(), "Summarize.", "one two three")
+	if err != nil {
+		t.Fatalf("Complete() error = %v", err)
+	}
+	if got != "A short summary." {
+		t.Errorf("Complete() = %q, want %q", got, "A short summary.")
+	}
+}
+
+func TestGeminiEmptyResponse(t *testing.T) {
+	g := newGeminiStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"candidates":[{"content":{"role":"model","parts":[{"text":""}]}}]}`))
+	})
+
+	if _, err := g.Translate(context.Background(), "technical", "<p>Hello</p>", "English", "Vietnamese", "Book"); err == nil {
+		t.Error("Translate() of an empty response returned no error")
+	}
+}
+
+func TestGeminiRateLimit(t *testing.T) {
+	g := newGeminiStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"code":429,"message":"slow down","status":"RESOURCE_EXHAUSTED"}}`))
+	})
+
+	_, err := g.Translate(context.Background(), "technical", "<p>Hello</p>", "English", "Vietnamese", "Book")
+	if !errors.Is(err, ErrRateLimitExceeded) {
+		t.Errorf("Translate() error = %v, want ErrRateLimitExceeded", err)
+	}
+}
+
+func TestGeminiCountTokens(t *testing.T) {
+	g := newGeminiStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1beta/models/stub-model:countTokens" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"totalTokens":7}`))
+	})
+
+	got, err := g.CountTokens(context.Background(), "<p>Hello</p>")
+	if err != nil {
+		t.Fatalf("CountTokens() error = %v", err)
+	}
+	if got != 7 {
+		t.Errorf("CountTokens() = %v, want 7", got)
+	}
+}
@@ -0,0 +1,361 @@
+package translator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	localAPIOllama   = "ollama"
+	localAPILlamaCpp = "llamacpp"
+
+	defaultOllamaURL   = "http://localhost:11434"
+	defaultOllamaModel = "llama3.1"
+	defaultLlamaCppURL = "http://localhost:8080"
+)
+
+func init() {
+	Register(localAPIOllama, func(cfg *Config) (Translator, error) {
+		return NewLocal(localAPIOllama, cfg)
+	})
+	Register(localAPILlamaCpp, func(cfg *Config) (Translator, error) {
+		return NewLocal(localAPILlamaCpp, cfg)
+	})
+}
+
+// IsLocal reports whether the named provider keeps the book on this machine:
+// the local servers and the offline mock.
+func IsLocal(provider string) bool {
+	return provider == localAPIOllama || provider == localAPILlamaCpp || provider == "mock"
+}
+
+// Local translates with a model served on the local machine, either through
+// Ollama's /api/chat endpoint or llama.cpp's /completion endpoint, so the book
+// never leaves the machine. Responses are streamed unless the "stream" option
+// is set to false.
+type Local struct {
+	client *http.Client
+	config *Config
+	api    string
+	stream bool
+}
+
+// NewLocal creates a local translator for api, which is "ollama" or "llamacpp".
+// The base URL defaults to OLLAMA_HOST or LLAMACPP_HOST, then to the server's
+// default port on localhost.
+func NewLocal(api string, cfg *Config) (*Local, error) {
+	if cfg == nil {
+		cfg = &Config{
+			Temperature: 0.3,
+			MaxTokens:   8192,
+		}
+	}
+
+	switch api {
+	case localAPIOllama:
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = os.Getenv("OLLAMA_HOST")
+		}
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = defaultOllamaURL
+		}
+		if cfg.Model == "" {
+			cfg.Model = defaultOllamaModel
+		}
+	case localAPILlamaCpp:
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = os.Getenv("LLAMACPP_HOST")
+		}
+		if cfg.BaseURL == "" {
+			cfg.BaseURL = defaultLlamaCppURL
+		}
+		// llama.cpp serves whatever model it was started with
+		if cfg.Model == "" {
+			cfg.Model = localAPILlamaCpp
+		}
+	default:
+		return nil, fmt.Errorf("unknown local API %q", api)
+	}
+
+	if !strings.Contains(cfg.BaseURL, "://") {
+		cfg.BaseURL = "http://" + cfg.BaseURL
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+
+	if cfg.TranslationGuidelines == "" {
+		cfg.TranslationGuidelines = os.Getenv("TRANSLATION_GUIDELINES")
+	}
+
+	stream := true
+	if value, ok := cfg.Options["stream"]; ok {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("stream option must be a boolean, got %q", value)
+		}
+		stream = parsed
+	}
+
+	return &Local{
+		client: &http.Client{},
+		config: cfg,
+		api:    api,
+		stream: stream,
+	}, nil
+}
+
+type ollamaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type ollamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Format   string          `json:"format,omitempty"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	Error           string        `json:"error,omitempty"`
+	PromptEvalCount int           `json:"prompt_eval_count,omitempty"`
+	EvalCount       int           `json:"eval_count,omitempty"`
+}
+
+type llamaCppCompletionRequest struct {
+	Prompt      string  `json:"prompt"`
+	NPredict    int     `json:"n_predict,omitempty"`
+	Temperature float32 `json:"temperature"`
+	Stream      bool    `json:"stream"`
+}
+
+type llamaCppCompletionResponse struct {
+	Content         string `json:"content"`
+	Stop            bool   `json:"stop"`
+	TokensEvaluated int    `json:"tokens_evaluated,omitempty"`
+	TokensPredicted int    `json:"tokens_predicted,omitempty"`
+}
+
+func (l *Local) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	system := systemPrompt(ctx, source, target, l.config.TranslationGuidelines, bookName, promptPreset)
+
+	translation, err := l.respond(ctx, system, content, JSONResponse(ctx))
+	if err != nil {
+		return "", err
+	}
+	if translation == "" {
+		return "", errors.New("no translation received")
+	}
+
+	return translation, nil
+}
+
+func (l *Local) Complete(ctx context.Context, system, prompt string) (string, error) {
+	completion, err := l.respond(ctx, system, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	if completion == "" {
+		return "", errors.New("no completion received")
+	}
+
+	return completion, nil
+}
+
+// respond sends content under system to the server's API and returns the
+// trimmed response.
+func (l *Local) respond(ctx context.Context, system, content string, jsonFormat bool) (string, error) {
+	var response string
+	var err error
+	if l.api == localAPIOllama {
+		response, err = l.chatOllama(ctx, system, content, jsonFormat)
+	} else {
+		response, err = l.completeLlamaCpp(ctx, system, content)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(response), nil
+}
+
+// SupportsJSON reports whether the server constrains its output to JSON, which
+// Ollama does with its format parameter.
+func (l *Local) SupportsJSON() bool {
+	return l.api == localAPIOllama
+}
+
+func (l *Local) chatOllama(ctx context.Context, system, content string, jsonFormat bool) (string, error) {
+	options := map[string]any{"temperature": l.config.Temperature}
+	if l.config.MaxTokens > 0 {
+		options["num_predict"] = l.config.MaxTokens
+	}
+
+	request := ollamaChatRequest{
+		Model: l.config.Model,
+		Messages: []ollamaMessage{
+			{Role: "system", Content: system},
+			{Role: "user", Content: content},
+		},
+		Stream:  l.stream,
+		Options: options,
+	}
+	if jsonFormat {
+		request.Format = "json"
+	}
+
+	resp, err := l.post(ctx, "/api/chat", request)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	// Streaming and non-streaming responses are both newline-delimited JSON objects
+	var result strings.Builder
+	scanner := newLineScanner(resp.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			return "", fmt.Errorf("decode ollama response: %w", err)
+		}
+		if chunk.Error != "" {
+			return "", fmt.Errorf("ollama error: %s", chunk.Error)
+		}
+
+		result.WriteString(chunk.Message.Content)
+		if chunk.Done {
+			recordUsage(ctx, chunk.PromptEvalCount, chunk.EvalCount)
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read ollama response: %w", err)
+	}
+
+	return result.String(), nil
+}
+
+func (l *Local) completeLlamaCpp(ctx context.Context, system, content string) (string, error) {
+	resp, err := l.post(ctx, "/completion", llamaCppCompletionRequest{
+		Prompt:      system + "\n\n" + content,
+		NPredict:    l.config.MaxTokens,
+		Temperature: l.config.Temperature,
+		Stream:      l.stream,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if !l.stream {
+		var completion llamaCppCompletionResponse
+		if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+			return "", fmt.Errorf("decode llama.cpp response: %w", err)
+		}
+		recordUsage(ctx, completion.TokensEvaluated, completion.TokensPredicted)
+		return completion.Content, nil
+	}
+
+	// Streaming responses are server-sent events: "data: {...}"
+	var result strings.Builder
+	scanner := newLineScanner(resp.Body)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		data, ok := bytes.CutPrefix(line, []byte("data:"))
+		if !ok {
+			continue
+		}
+
+		var chunk llamaCppCompletionResponse
+		if err := json.Unmarshal(bytes.TrimSpace(data), &chunk); err != nil {
+			return "", fmt.Errorf("decode llama.cpp stream: %w", err)
+		}
+
+		result.WriteString(chunk.Content)
+		if chunk.Stop {
+			recordUsage(ctx, chunk.TokensEvaluated, chunk.TokensPredicted)
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("read llama.cpp stream: %w", err)
+	}
+
+	return result.String(), nil
+}
+
+// CountTokens uses llama.cpp's /tokenize endpoint when available and falls
+// back to EstimateTokens otherwise; Ollama has no tokenizer endpoint.
+func (l *Local) CountTokens(ctx context.Context, content string) (float32, error) {
+	if l.api != localAPILlamaCpp {
+		return EstimateTokens(content), nil
+	}
+
+	resp, err := l.post(ctx, "/tokenize", map[string]string{"content": content})
+	if err != nil {
+		return EstimateTokens(content), nil
+	}
+	defer resp.Body.Close()
+
+	var tokenResp struct {
+		Tokens []json.RawMessage `json:"tokens"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return EstimateTokens(content), nil
+	}
+
+	return float32(len(tokenResp.Tokens)), nil
+}
+
+func (l *Local) post(ctx context.Context, endpoint string, body any) (*http.Response, error) {
+	jsonBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request body: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, l.config.BaseURL+endpoint, bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("do request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+
+		// Both servers answer 503 while every slot is busy
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			return nil, fmt.Errorf("%w: %s", ErrRateLimitExceeded, string(respBody))
+		}
+		return nil, fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return resp, nil
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	return scanner
+}
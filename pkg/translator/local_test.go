@@ -0,0 +1,125 @@
+package translator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newLocalStub(t *testing.T, api string, options map[string]string, handler http.HandlerFunc) *Local {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	l, err := NewLocal(api, &Config{BaseURL: server.URL, Options: options})
+	if err != nil {
+		t.Fatalf("NewLocal() error = %v", err)
+	}
+	return l
+}
+
+func TestLocalOllamaStreaming(t *testing.T) {
+	l := newLocalStub(t, "ollama", nil, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/chat" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		var req ollamaChatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if !req.Stream || req.Model != defaultOllamaModel || len(req.Messages) != 2 {
+			t.Errorf("unexpected request %+v", req)
+		}
+
+		for _, part := range []string{"<p>Xin", " chào", "</p>"} {
+			fmt.Fprintf(w, `{"message":{"role":"assistant","content":%q},"done":false}`+"\n", part)
+		}
+		fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true}`)
+	})
+
+	got, err := l.Translate(context.Background(), "technical", "<p>Hello</p>", "English", "Vietnamese", "Book")
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if got != "<p>Xin chào</p>" {
+		t.Errorf("Translate() = %q, want %q", got, "<p>Xin chào</p>")
+	}
+}
+
+func TestLocalLlamaCppStreaming(t *testing.T) {
+	l := newLocalStub(t, "llamacpp", nil, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/completion" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		for _, part := range []string{"Xin", " chào"} {
+			fmt.Fprintf(w, "data: {\"content\":%q,\"stop\":false}\n\n", part)
+		}
+		fmt.Fprint(w, "data: {\"content\":\"\",\"stop\":true}\n\n")
+	})
+
+	got, err := l.Translate(context.Background(), "technical", "Hello", "English", "Vietnamese", "Book")
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if got != "Xin chào" {
+		t.Errorf("Translate() = %q, want %q", got, "Xin chào")
+	}
+}
+
+func TestLocalLlamaCppWithoutStreaming(t *testing.T) {
+	l := newLocalStub(t, "llamacpp", map[string]string{"stream": "false"}, func(w http.ResponseWriter, r *http.Request) {
+		var req llamaCppCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.Stream {
+			t.Error("expected a non-streaming request")
+		}
+		w.Write([]byte(`{"content":"Xin chào","stop":true}`))
+	})
+
+	got, err := l.Translate(context.Background(), "technical", "Hello", "English", "Vietnamese", "Book")
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if got != "Xin chào" {
+		t.Errorf("Translate() = %q, want %q", got, "Xin chào")
+	}
+}
+
+func TestLocalBusyServerIsRateLimited(t *testing.T) {
+	l := newLocalStub(t, "ollama", nil, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	_, err := l.Translate(context.Background(), "technical", "Hello", "English", "Vietnamese", "Book")
+	if !errors.Is(err, ErrRateLimitExceeded) {
+		t.Errorf("Translate() error = %v, want ErrRateLimitExceeded", err)
+	}
+}
+
+func TestLocalCountTokens(t *testing.T) {
+	llamaCpp := newLocalStub(t, "llamacpp", nil, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tokenize" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		w.Write([]byte(`{"tokens":[1,2,3]}`))
+	})
+	if got, err := llamaCpp.CountTokens(context.Background(), "Hello world"); err != nil || got != 3 {
+		t.Errorf("CountTokens() = %v, %v, want 3", got, err)
+	}
+
+	unavailable := newLocalStub(t, "llamacpp", nil, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	if got, err := unavailable.CountTokens(context.Background(), "abcdefgh"); err != nil || got != 2 {
+		t.Errorf("CountTokens() = %v, %v, want estimate 2", got, err)
+	}
+}
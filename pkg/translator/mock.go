@@ -0,0 +1,256 @@
+package translator
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+func init() {
+	Register("mock", func(cfg *Config) (Translator, error) {
+		return NewMock(cfg)
+	})
+}
+
+// MockOptions controls the faults the mock translator injects. Each value N
+// makes every Nth call misbehave; zero disables the fault.
+type MockOptions struct {
+	RateLimitEvery int // fail with ErrRateLimitExceeded
+	DropEvery      int // omit the last segment of the response
+	ReorderEvery   int // return the segments in reverse order
+	BreakHTMLEvery int // remove the first closing tag inside a segment
+	RenameEvery    int // answer the first segment under an index or id that was not asked for
+}
+
+// Mock is a deterministic, offline translator for tests. It pseudo-localises
+// the text of every segment, leaving tags and entities untouched, so the
+// original can be recovered with DePseudoLocalize. Batches requested with
+// WithJSONResponse are answered as JSON.
+type Mock struct {
+	config  *Config
+	options MockOptions
+	calls   atomic.Int64
+}
+
+// NewMock creates a mock translator. Faults are read from cfg.Options using the
+// keys rate_limit_every, drop_every, reorder_every, break_html_every and
+// rename_every.
+func NewMock(cfg *Config) (*Mock, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	if cfg.Model == "" {
+		cfg.Model = "mock"
+	}
+
+	m := &Mock{config: cfg}
+	fields := map[string]*int{
+		"rate_limit_every": &m.options.RateLimitEvery,
+		"drop_every":       &m.options.DropEvery,
+		"reorder_every":    &m.options.ReorderEvery,
+		"break_html_every": &m.options.BreakHTMLEvery,
+		"rename_every":     &m.options.RenameEvery,
+	}
+	for key, value := range cfg.Options {
+		field, ok := fields[key]
+		if !ok {
+			return nil, fmt.Errorf("unknown mock option %q", key)
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("mock option %s must be a non-negative integer, got %q", key, value)
+		}
+		*field = n
+	}
+
+	return m, nil
+}
+
+func (m *Mock) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	call := int(m.calls.Add(1))
+	if shouldInject(call, m.options.RateLimitEvery) {
+		return "", fmt.Errorf("mock call %d: %w", call, ErrRateLimitExceeded)
+	}
+
+	// Pseudo-localised text costs as many tokens as its source on a real model
+	tokens := int(EstimateTokens(content))
+	recordUsage(ctx, tokens, tokens)
+
+	if JSONResponse(ctx) {
+		if batch, err := ParseJSONBatch(content); err == nil && len(batch.Segments) > 0 {
+			return m.translateJSON(call, batch)
+		}
+	}
+
+	translation := PseudoLocalize(content)
+
+	segments := mockSegmentRegex.FindAllString(translation, -1)
+	if len(segments) == 0 {
+		return translation, nil
+	}
+
+	if shouldInject(call, m.options.BreakHTMLEvery) {
+		for i, segment := range segments {
+			if broken := removeFirstClosingTag(segment); broken != segment {
+				segments[i] = broken
+				break
+			}
+		}
+	}
+	if shouldInject(call, m.options.ReorderEvery) {
+		for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+			segments[i], segments[j] = segments[j], segments[i]
+		}
+	}
+	if shouldInject(call, m.options.DropEvery) {
+		segments = segments[:len(segments)-1]
+	}
+	if shouldInject(call, m.options.RenameEvery) && len(segments) > 0 {
+		index := fmt.Sprintf("SEGMENT_%d>", len(segments)+1)
+		segments[0] = mockSegmentIndexRegex.ReplaceAllString(segments[0], index)
+	}
+
+	return strings.Join(segments, "\n\n"), nil
+}
+
+// translateJSON answers a batch requested as JSON, with the same faults as
+// the tag protocol.
+func (m *Mock) translateJSON(call int, batch JSONBatch) (string, error) {
+	segments := batch.Segments
+	for i := range segments {
+		segments[i].Text = PseudoLocalize(segments[i].Text)
+	}
+
+	if shouldInject(call, m.options.BreakHTMLEvery) {
+		for i, segment := range segments {
+			if broken := removeFirstClosingTag(segment.Text); broken != segment.Text {
+				segments[i].Text = broken
+				break
+			}
+		}
+	}
+	if shouldInject(call, m.options.ReorderEvery) {
+		for i, j := 0, len(segments)-1; i < j; i, j = i+1, j-1 {
+			segments[i], segments[j] = segments[j], segments[i]
+		}
+	}
+	if shouldInject(call, m.options.DropEvery) {
+		segments = segments[:len(segments)-1]
+	}
+	if shouldInject(call, m.options.RenameEvery) && len(segments) > 0 {
+		segments[0].ID += "-renamed"
+	}
+
+	return MarshalJSONBatch(JSONBatch{Segments: segments})
+}
+
+// Complete answers any prompt with a fixed sentence that counts its words,
+// without the faults of Translate.
+func (m *Mock) Complete(ctx context.Context, system, prompt string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	completion := fmt.Sprintf("Mock completion of %d words.", len(strings.Fields(prompt)))
+	recordUsage(ctx, int(EstimateTokens(system+prompt)), int(EstimateTokens(completion)))
+	return completion, nil
+}
+
+func (m *Mock) CountTokens(ctx context.Context, content string) (float32, error) {
+	return EstimateTokens(content), nil
+}
+
+// SupportsJSON reports that the mock answers in JSON when asked.
+func (m *Mock) SupportsJSON() bool {
+	return true
+}
+
+// Calls returns the number of Translate calls made so far.
+func (m *Mock) Calls() int {
+	return int(m.calls.Load())
+}
+
+func shouldInject(call, every int) bool {
+	return every > 0 && call%every == 0
+}
+
+var (
+	mockSegmentRegex      = regexp.MustCompile(`(?s)<SEGMENT_\d+>.*?</SEGMENT_\d+>`)
+	mockSegmentIndexRegex = regexp.MustCompile(`SEGMENT_\d+>`)
+	mockClosingTagRegex   = regexp.MustCompile(`</[a-zA-Z][a-zA-Z0-9]*>`)
+	pseudoLocalizeTable   = buildPseudoTable()
+	pseudoDelocalizeTable = invertPseudoTable(pseudoLocalizeTable)
+)
+
+func removeFirstClosingTag(segment string) string {
+	loc := mockClosingTagRegex.FindStringIndex(segment)
+	if loc == nil {
+		return segment
+	}
+	return segment[:loc[0]] + segment[loc[1]:]
+}
+
+func buildPseudoTable() map[rune]rune {
+	lower := []rune("àƀçđéƒĝĥîĵķļɱñöþǫŕšţüṽŵẋýž")
+	upper := []rune("ÀƁÇĐÉƑĜĤÎĴĶĻṀÑÖÞǪŔŠŢÜṼŴẊÝŽ")
+
+	table := make(map[rune]rune, 52)
+	for i := 0; i < 26; i++ {
+		table['a'+rune(i)] = lower[i]
+		table['A'+rune(i)] = upper[i]
+	}
+	return table
+}
+
+func invertPseudoTable(table map[rune]rune) map[rune]rune {
+	inverted := make(map[rune]rune, len(table))
+	for from, to := range table {
+		inverted[to] = from
+	}
+	return inverted
+}
+
+// PseudoLocalize replaces ASCII letters with accented look-alikes outside of
+// tags and character references.
+func PseudoLocalize(content string) string {
+	return mapText(content, pseudoLocalizeTable)
+}
+
+// DePseudoLocalize reverses PseudoLocalize for text that was ASCII before.
+func DePseudoLocalize(content string) string {
+	return mapText(content, pseudoDelocalizeTable)
+}
+
+func mapText(content string, table map[rune]rune) string {
+	var b strings.Builder
+	b.Grow(len(content) * 2)
+
+	inTag, inEntity := false, false
+	for _, r := range content {
+		switch {
+		case inTag:
+			inTag = r != '>'
+		case inEntity:
+			inEntity = r != ';' && r != ' ' && r != '<'
+			inTag = r == '<'
+		case r == '<':
+			inTag = true
+		case r == '&':
+			inEntity = true
+		default:
+			if mapped, ok := table[r]; ok {
+				r = mapped
+			}
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
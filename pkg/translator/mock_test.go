@@ -0,0 +1,148 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const mockBatch = "Translate these segments.\n\n<SEGMENT_0>\n<b>Hello</b> world\n</SEGMENT_0>\n\n<SEGMENT_1>\nTom &amp; Jerry\n</SEGMENT_1>\n\n<SEGMENT_2>\nThe end\n</SEGMENT_2>"
+
+func TestPseudoLocalizeRoundTrip(t *testing.T) {
+	inputs := []string{
+		"Hello, world!",
+		`<a href="chapter.xhtml#Anchor">Link text</a>`,
+		"Tom &amp; Jerry &#8212; friends",
+	}
+
+	for _, input := range inputs {
+		localized := PseudoLocalize(input)
+		if got := DePseudoLocalize(localized); got != input {
+			t.Errorf("DePseudoLocalize(PseudoLocalize(%q)) = %q", input, got)
+		}
+	}
+
+	if got := PseudoLocalize(`<a href="x">ab</a>&amp;`); got != `<a href="x">àƀ</a>&amp;` {
+		t.Errorf("PseudoLocalize() changed markup: %q", got)
+	}
+}
+
+func TestMockFaults(t *testing.T) {
+	tests := []struct {
+		name    string
+		options map[string]string
+		check   func(t *testing.T, got string, err error)
+	}{
+		{
+			name: "clean",
+			check: func(t *testing.T, got string, err error) {
+				if err != nil {
+					t.Fatalf("Translate() error = %v", err)
+				}
+				if strings.Count(got, "<SEGMENT_") != 3 || !strings.Contains(got, "<b>Ĥéļļö</b> ŵöŕļđ") {
+					t.Errorf("unexpected translation %q", got)
+				}
+			},
+		},
+		{
+			name:    "rate limit",
+			options: map[string]string{"rate_limit_every": "1"},
+			check: func(t *testing.T, got string, err error) {
+				if !errors.Is(err, ErrRateLimitExceeded) {
+					t.Errorf("Translate() error = %v, want ErrRateLimitExceeded", err)
+				}
+			},
+		},
+		{
+			name:    "drop",
+			options: map[string]string{"drop_every": "1"},
+			check: func(t *testing.T, got string, err error) {
+				if strings.Contains(got, "<SEGMENT_2>") || strings.Count(got, "<SEGMENT_") != 2 {
+					t.Errorf("expected last segment to be dropped, got %q", got)
+				}
+			},
+		},
+		{
+			name:    "reorder",
+			options: map[string]string{"reorder_every": "1"},
+			check: func(t *testing.T, got string, err error) {
+				if strings.Index(got, "<SEGMENT_2>") > strings.Index(got, "<SEGMENT_0>") {
+					t.Errorf("expected segments in reverse order, got %q", got)
+				}
+			},
+		},
+		{
+			name:    "rename",
+			options: map[string]string{"rename_every": "1"},
+			check: func(t *testing.T, got string, err error) {
+				if strings.Contains(got, "<SEGMENT_0>") || !strings.Contains(got, "<SEGMENT_4>") || !strings.Contains(got, "</SEGMENT_4>") {
+					t.Errorf("expected the first segment under an unknown index, got %q", got)
+				}
+			},
+		},
+		{
+			name:    "broken html",
+			options: map[string]string{"break_html_every": "1"},
+			check: func(t *testing.T, got string, err error) {
+				if strings.Contains(got, "</b>") {
+					t.Errorf("expected closing tag to be removed, got %q", got)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := NewMock(&Config{Options: tt.options})
+			if err != nil {
+				t.Fatalf("NewMock() error = %v", err)
+			}
+			got, err := m.Translate(context.Background(), "technical", mockBatch, "English", "Vietnamese", "Book")
+			tt.check(t, got, err)
+		})
+	}
+}
+
+func TestMockJSONResponse(t *testing.T) {
+	request, err := MarshalJSONBatch(JSONBatch{Segments: []JSONSegment{
+		{ID: "a", Text: "<b>Hello</b> world"},
+		{ID: "b", Text: "Tom &amp; Jerry"},
+		{ID: "c", Text: "The end"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMock(&Config{Options: map[string]string{"drop_every": "1", "rename_every": "1"}})
+	if err != nil {
+		t.Fatalf("NewMock() error = %v", err)
+	}
+	got, err := m.Translate(WithJSONResponse(context.Background()), "technical", "Translate the texts.\n\n"+request, "English", "Vietnamese", "Book")
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+
+	batch, err := ParseJSONBatch("```json\n" + got + "\n```")
+	if err != nil {
+		t.Fatalf("ParseJSONBatch() error = %v\n%s", err, got)
+	}
+	want := []JSONSegment{
+		{ID: "a-renamed", Text: "<b>Ĥéļļö</b> ŵöŕļđ"},
+		{ID: "b", Text: "Ţöɱ &amp; Ĵéŕŕý"},
+	}
+	if len(batch.Segments) != len(want) {
+		t.Fatalf("segments = %+v, want %+v", batch.Segments, want)
+	}
+	for i := range want {
+		if batch.Segments[i] != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, batch.Segments[i], want[i])
+		}
+	}
+}
+
+func TestNewMockRejectsUnknownOption(t *testing.T) {
+	if _, err := NewMock(&Config{Options: map[string]string{"explode": "1"}}); err == nil {
+		t.Error("NewMock() error = nil, want error for unknown option")
+	}
+}
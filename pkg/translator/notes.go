@@ -0,0 +1,76 @@
+package translator
+
+import (
+	"context"
+	"slices"
+	"strings"
+)
+
+type systemNotesKey struct{}
+
+type contextNotesKey struct{}
+
+// WithSystemNotes returns a context whose translation requests append notes,
+// such as glossary entries, to the system prompt. Notes accumulate across
+// nested calls.
+func WithSystemNotes(ctx context.Context, notes ...string) context.Context {
+	return context.WithValue(ctx, systemNotesKey{}, appendNotes(keyedNotes(ctx), notes))
+}
+
+// WithContextNotes returns a context whose translation requests append notes
+// after the system notes, like WithSystemNotes, but leave them out of cache
+// keys. It is for notes that change between runs of the same batch, such as
+// the preceding context and translation memory examples.
+func WithContextNotes(ctx context.Context, notes ...string) context.Context {
+	return context.WithValue(ctx, contextNotesKey{}, appendNotes(contextNotes(ctx), notes))
+}
+
+// SystemNotes returns the notes added to ctx with WithSystemNotes followed by
+// those added with WithContextNotes.
+func SystemNotes(ctx context.Context) []string {
+	notes := keyedNotes(ctx)
+	if extra := contextNotes(ctx); len(extra) > 0 {
+		return append(slices.Clip(notes), extra...)
+	}
+	return notes
+}
+
+// appendNotes returns a copy of existing followed by the non-blank notes.
+func appendNotes(existing, notes []string) []string {
+	var all []string
+	all = append(all, existing...)
+	for _, note := range notes {
+		if strings.TrimSpace(note) != "" {
+			all = append(all, note)
+		}
+	}
+	return all
+}
+
+// keyedNotes returns the notes added to ctx with WithSystemNotes.
+func keyedNotes(ctx context.Context) []string {
+	notes, _ := ctx.Value(systemNotesKey{}).([]string)
+	return notes
+}
+
+// contextNotes returns the notes added to ctx with WithContextNotes.
+func contextNotes(ctx context.Context) []string {
+	notes, _ := ctx.Value(contextNotesKey{}).([]string)
+	return notes
+}
+
+// systemPrompt is createTranslationSystem followed by the notes in ctx.
+func systemPrompt(ctx context.Context, source, target, guidelines, bookName, promptPreset string) string {
+	system := createTranslationSystem(source, target, guidelines, bookName, promptPreset)
+	if notes := SystemNotes(ctx); len(notes) > 0 {
+		system += "\n\n" + strings.Join(notes, "\n\n")
+	}
+	return system
+}
+
+// notesKey is the part of a cache key that depends on the notes in ctx, so
+// the same content translated with different notes is cached separately.
+// Notes added with WithContextNotes are left out.
+func notesKey(ctx context.Context) string {
+	return strings.Join(keyedNotes(ctx), "\n")
+}
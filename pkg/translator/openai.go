@@ -0,0 +1,152 @@
+package translator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+const defaultOpenAIModel = openai.GPT4o
+
+// OpenAI translates through the Chat Completions API. Setting Config.BaseURL
+// points it at any OpenAI-compatible server.
+type OpenAI struct {
+	client *openai.Client
+	config *Config
+}
+
+func init() {
+	Register("openai", func(cfg *Config) (Translator, error) {
+		return NewOpenAI(cfg)
+	})
+}
+
+// NewOpenAI creates an OpenAI translator. The key and base URL default to
+// OPENAI_API_KEY and OPENAI_BASE_URL.
+func NewOpenAI(cfg *Config) (*OpenAI, error) {
+	if cfg == nil {
+		cfg = &Config{
+			Temperature: 0.3,
+			MaxTokens:   8192,
+		}
+	}
+
+	if cfg.APIKey == "" {
+		cfg.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = os.Getenv("OPENAI_BASE_URL")
+	}
+
+	// Self-hosted compatible servers usually accept any key, the official API does not
+	if cfg.APIKey == "" && cfg.BaseURL == "" {
+		return nil, errors.New("missing OPENAI_API_KEY")
+	}
+
+	if cfg.Model == "" {
+		cfg.Model = defaultOpenAIModel
+	}
+	if cfg.TranslationGuidelines == "" {
+		cfg.TranslationGuidelines = os.Getenv("TRANSLATION_GUIDELINES")
+	}
+
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = cfg.BaseURL
+	}
+
+	return &OpenAI{
+		client: openai.NewClientWithConfig(clientConfig),
+		config: cfg,
+	}, nil
+}
+
+func (o *OpenAI) Translate(ctx context.Context, promptPreset, content, source, target, bookName string) (string, error) {
+	translation, err := o.chat(ctx, systemPrompt(ctx, source, target, o.config.TranslationGuidelines, bookName, promptPreset), content, JSONResponse(ctx))
+	if err != nil {
+		return "", err
+	}
+	if translation == "" {
+		return "", errors.New("no translation received")
+	}
+
+	return translation, nil
+}
+
+func (o *OpenAI) Complete(ctx context.Context, system, prompt string) (string, error) {
+	completion, err := o.chat(ctx, system, prompt, false)
+	if err != nil {
+		return "", err
+	}
+	if completion == "" {
+		return "", errors.New("no completion received")
+	}
+
+	return completion, nil
+}
+
+// chat sends content under system and returns the text of the first choice.
+func (o *OpenAI) chat(ctx context.Context, system, content string, jsonMode bool) (string, error) {
+	req := openai.ChatCompletionRequest{
+		Model: o.config.Model,
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: system,
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: content,
+			},
+		},
+		Temperature: o.config.Temperature,
+		MaxTokens:   o.config.MaxTokens,
+	}
+	if jsonMode {
+		req.ResponseFormat = &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject}
+	}
+
+	resp, err := o.client.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return "", fmt.Errorf("create chat completion: %w", mapOpenAIError(err))
+	}
+
+	recordUsage(ctx, resp.Usage.PromptTokens, resp.Usage.CompletionTokens)
+
+	if len(resp.Choices) == 0 {
+		return "", nil
+	}
+
+	return resp.Choices[0].Message.Content, nil
+}
+
+// SupportsJSON reports that OpenAI answers in JSON mode when asked.
+func (o *OpenAI) SupportsJSON() bool {
+	return true
+}
+
+// CountTokens estimates the token count locally because the Chat Completions
+// API has no token counting endpoint.
+func (o *OpenAI) CountTokens(ctx context.Context, content string) (float32, error) {
+	return EstimateTokens(content), nil
+}
+
+// mapOpenAIError turns HTTP 429 responses into ErrRateLimitExceeded so callers
+// can back off the same way they do for the other providers.
+func mapOpenAIError(err error) error {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) && apiErr.HTTPStatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %s", ErrRateLimitExceeded, apiErr.Message)
+	}
+
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) && reqErr.HTTPStatusCode == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %v", ErrRateLimitExceeded, reqErr.Err)
+	}
+
+	return err
+}
@@ -0,0 +1,96 @@
+package translator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newOpenAIStub(t *testing.T, handler http.HandlerFunc) *OpenAI {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	o, err := NewOpenAI(&Config{
+		APIKey:  "test",
+		BaseURL: server.URL + "/v1",
+		Model:   "stub-model",
+	})
+	if err != nil {
+		t.Fatalf("NewOpenAI() error = %v", err)
+	}
+	return o
+}
+
+func TestOpenAITranslate(t *testing.T) {
+	o := newOpenAIStub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+
+		var req struct {
+			Model    string `json:"model"`
+			Messages []struct {
+				Role    string `json:"role"`
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatalf("decode request: %v", err)
+		}
+		if req.Model != "stub-model" {
+			t.Errorf("model = %q, want stub-model", req.Model)
+		}
+		if len(req.Messages) != 2 || req.Messages[0].Role != "system" || req.Messages[1].Content != "<p>Hello</p>" {
+			t.Errorf("unexpected messages: %+v", req.Messages)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"<p>Xin chào</p>"},"finish_reason":"stop"}]}`))
+	})
+
+	got, err := o.Translate(context.Background(), "technical", "<p>Hello</p>", "English", "Vietnamese", "Book")
+	if err != nil {
+		t.Fatalf("Translate() error = %v", err)
+	}
+	if got != "<p>Xin chào</p>" {
+		t.Errorf("Translate() = %q, want %q", got, "<p>Xin chào</p>")
+	}
+}
+
+func TestOpenAITranslateRateLimit(t *testing.T) {
+	o := newOpenAIStub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"slow down","type":"rate_limit_error"}}`))
+	})
+
+	_, err := o.Translate(context.Background(), "technical", "<p>Hello</p>", "English", "Vietnamese", "Book")
+	if !errors.Is(err, ErrRateLimitExceeded) {
+		t.Errorf("Translate() error = %v, want ErrRateLimitExceeded", err)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    float32
+	}{
+		{name: "empty", content: "", want: 0},
+		{name: "ascii", content: "abcdefgh", want: 2},
+		{name: "non-ascii", content: "xin chào", want: 7.0/4 + 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EstimateTokens(tt.content); got != tt.want {
+				t.Errorf("EstimateTokens() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package translator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Factory builds a new, independent Translator from cfg. Factories fill in
+// provider defaults such as the model and API key on cfg.
+type Factory func(cfg *Config) (Translator, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+// Register makes a provider available under name. It panics if the name is
+// registered twice, which can only happen through a programming error.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("translator: Register factory is nil")
+	}
+	if _, exists := registry[name]; exists {
+		panic("translator: Register called twice for provider " + name)
+	}
+	registry[name] = factory
+}
+
+// New builds a translator for the named provider. Every call returns a new
+// instance, so several translators can coexist in one process.
+func New(name string, cfg *Config) (Translator, error) {
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("unknown provider %q, available providers: %v", name, Providers())
+	}
+
+	if cfg == nil {
+		cfg = &Config{
+			Temperature: 0.3,
+			MaxTokens:   8192,
+		}
+	}
+
+	return factory(cfg)
+}
+
+// Providers returns the sorted names of all registered providers.
+func Providers() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,57 @@
+package translator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewUnknownProvider(t *testing.T) {
+	if _, err := New("does-not-exist", &Config{}); err == nil {
+		t.Error("New() error = nil, want error for unknown provider")
+	}
+}
+
+func TestProvidersIncludesBuiltins(t *testing.T) {
+	registered := make(map[string]bool)
+	for _, name := range Providers() {
+		registered[name] = true
+	}
+
+	for _, name := range []string{"anthropic", "openai", "gemini"} {
+		if !registered[name] {
+			t.Errorf("Providers() is missing %q", name)
+		}
+	}
+}
+
+func TestNewBuildsIndependentInstances(t *testing.T) {
+	newServer := func(reply string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"choices":[{"index":0,"message":{"role":"assistant","content":"` + reply + `"}}]}`))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+
+	first, err := New("openai", &Config{APIKey: "test", BaseURL: newServer("first").URL, Model: "a"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	second, err := New("openai", &Config{APIKey: "test", BaseURL: newServer("second").URL, Model: "b"})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	for want, tr := range map[string]Translator{"first": first, "second": second} {
+		got, err := tr.Translate(context.Background(), "technical", "hello", "English", "Vietnamese", "Book")
+		if err != nil {
+			t.Fatalf("Translate() error = %v", err)
+		}
+		if got != want {
+			t.Errorf("Translate() = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package translator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// JSONSegment is one segment of a batch sent and returned as JSON, keyed by
+// the content ID of its element.
+type JSONSegment struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// JSONBatch is the request and the expected response of a batch translated
+// as JSON.
+type JSONBatch struct {
+	Segments []JSONSegment `json:"segments"`
+}
+
+// JSONBatchSchema is the JSON schema of a JSONBatch, for providers that
+// constrain their output to a schema.
+var JSONBatchSchema = json.RawMessage(`{
+  "type": "object",
+  "properties": {
+    "segments": {
+      "type": "array",
+      "items": {
+        "type": "object",
+        "properties": {
+          "id": {"type": "string", "description": "the id of the source segment, unchanged"},
+          "text": {"type": "string", "description": "the translated HTML of the segment"}
+        },
+        "required": ["id", "text"]
+      }
+    }
+  },
+  "required": ["segments"]
+}`)
+
+// MarshalJSONBatch encodes batch without escaping the HTML in its texts, which
+// would only cost tokens.
+func MarshalJSONBatch(batch JSONBatch) (string, error) {
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(batch); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// ParseJSONBatch decodes the JSONBatch in a response. Models without a JSON
+// mode often wrap the object in a code fence or a sentence, so only the
+// outermost braces are decoded.
+func ParseJSONBatch(response string) (JSONBatch, error) {
+	var batch JSONBatch
+
+	start, end := strings.Index(response, "{"), strings.LastIndex(response, "}")
+	if start < 0 || end < start {
+		return batch, errors.New("response has no JSON object")
+	}
+	if err := json.Unmarshal([]byte(response[start:end+1]), &batch); err != nil {
+		return batch, fmt.Errorf("decode JSON response: %w", err)
+	}
+	return batch, nil
+}
+
+type jsonResponseKey struct{}
+
+// WithJSONResponse returns a context whose translation requests ask for a
+// JSONBatch, through JSON mode or tool use where the provider supports it.
+func WithJSONResponse(ctx context.Context) context.Context {
+	return context.WithValue(ctx, jsonResponseKey{}, true)
+}
+
+// JSONResponse reports whether ctx asks for a JSONBatch response.
+func JSONResponse(ctx context.Context) bool {
+	wanted, _ := ctx.Value(jsonResponseKey{}).(bool)
+	return wanted
+}
+
+// jsonResponder is implemented by translators that can constrain their
+// response to JSON.
+type jsonResponder interface {
+	SupportsJSON() bool
+}
+
+// SupportsJSON reports whether t, or the translator it decorates, constrains
+// its response to JSON when asked with WithJSONResponse.
+func SupportsJSON(t Translator) bool {
+	for t != nil {
+		if responder, ok := t.(jsonResponder); ok {
+			return responder.SupportsJSON()
+		}
+		wrapper, ok := t.(interface{ Unwrap() Translator })
+		if !ok {
+			return false
+		}
+		t = wrapper.Unwrap()
+	}
+	return false
+}
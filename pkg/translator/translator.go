@@ -3,6 +3,8 @@ package translator
 import (
 	"context"
 	"errors"
+	"time"
+	"unicode/utf8"
 )
 
 var ErrRateLimitExceeded = errors.New("rate limit exceeded")
@@ -11,3 +13,32 @@ type Translator interface {
 	Translate(ctx context.Context, promptPreset string, content string, source string, target string, bookName string) (string, error)
 	CountTokens(ctx context.Context, content string) (float32, error)
 }
+
+type Config struct {
+	APIKey                string
+	BaseURL               string // Optional endpoint override for OpenAI-compatible servers
+	Model                 string
+	Temperature           float32
+	MaxTokens             int
+	CacheTTL              time.Duration
+	CacheMaxCost          int64
+	TranslationGuidelines string            // New field for translation guidelines
+	SystemPrompt          string            // New field for system prompt
+	Options               map[string]string // Provider-specific settings, such as the mock provider's faults
+	DataDir               string            // Where providers keep logs and usage metadata, "unpackage" in the working directory if empty
+}
+
+// EstimateTokens approximates the token count of content for providers that
+// have no token counting endpoint: about four bytes per token for ASCII text
+// and one token per rune for everything else.
+func EstimateTokens(content string) float32 {
+	var ascii, other int
+	for _, r := range content {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return float32(ascii)/4 + float32(other)
+}
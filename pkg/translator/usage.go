@@ -0,0 +1,84 @@
+package translator
+
+import (
+	"context"
+	"strings"
+)
+
+// Usage counts the tokens a provider billed for one or more requests.
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Add accumulates other into u.
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+}
+
+// Cost returns the price of u in US dollars for model, or 0 if the model has
+// no known price, such as local and mock models.
+func (u Usage) Cost(model string) float64 {
+	price, ok := PriceFor(model)
+	if !ok {
+		return 0
+	}
+	return float64(u.InputTokens)/1e6*price.InputPerMillion + float64(u.OutputTokens)/1e6*price.OutputPerMillion
+}
+
+type usageKey struct{}
+
+// ContextWithUsage returns a context in which providers add the tokens they
+// use to u. A Usage must not be shared by concurrent requests.
+func ContextWithUsage(ctx context.Context, u *Usage) context.Context {
+	return context.WithValue(ctx, usageKey{}, u)
+}
+
+func recordUsage(ctx context.Context, inputTokens, outputTokens int) {
+	if u, ok := ctx.Value(usageKey{}).(*Usage); ok && u != nil {
+		u.Add(Usage{InputTokens: inputTokens, OutputTokens: outputTokens})
+	}
+}
+
+// Price is the cost of a model in US dollars per million tokens.
+type Price struct {
+	InputPerMillion  float64
+	OutputPerMillion float64
+}
+
+// prices lists the public list prices of the hosted models we support.
+var prices = map[string]Price{
+	"claude-3-5-sonnet": {InputPerMillion: 3, OutputPerMillion: 15},
+	"claude-3-7-sonnet": {InputPerMillion: 3, OutputPerMillion: 15},
+	"claude-3-5-haiku":  {InputPerMillion: 0.8, OutputPerMillion: 4},
+	"claude-3-haiku":    {InputPerMillion: 0.25, OutputPerMillion: 1.25},
+	"claude-3-opus":     {InputPerMillion: 15, OutputPerMillion: 75},
+	"gpt-4o-mini":       {InputPerMillion: 0.15, OutputPerMillion: 0.6},
+	"gpt-4o":            {InputPerMillion: 2.5, OutputPerMillion: 10},
+	"gpt-4.1-mini":      {InputPerMillion: 0.4, OutputPerMillion: 1.6},
+	"gpt-4.1":           {InputPerMillion: 2, OutputPerMillion: 8},
+	"gemini-2.0-flash":  {InputPerMillion: 0.1, OutputPerMillion: 0.4},
+	"gemini-1.5-flash":  {InputPerMillion: 0.075, OutputPerMillion: 0.3},
+	"gemini-1.5-pro":    {InputPerMillion: 1.25, OutputPerMillion: 5},
+}
+
+// PriceFor returns the price of model. Dated and suffixed model names such as
+// claude-3-5-sonnet-20241022 use the price of their longest known prefix.
+func PriceFor(model string) (Price, bool) {
+	// Cache keys and journals record models as provider/model
+	if i := strings.LastIndex(model, "/"); i >= 0 {
+		model = model[i+1:]
+	}
+
+	var best string
+	for name := range prices {
+		if strings.HasPrefix(model, name) && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return prices[best], true
+}
@@ -4,3 +4,4 @@ const ContentIdKey = "data-content-id"
 const TranslationIdKey = "data-translation-id"
 const TranslationByIdKey = "data-translation-by-id"
 const TranslationLangKey = "data-translation-lang"
+const TranslationStateKey = "data-translation-state"
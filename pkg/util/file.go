@@ -2,6 +2,7 @@ package util
 
 import (
 	"os"
+	"path/filepath"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -14,4 +15,28 @@ func OpenAndReadFile(filePath string) (*goquery.Document, error) {
 	defer file.Close()
 
 	return goquery.NewDocumentFromReader(file)
-}
\ No newline at end of file
+}
+
+// WriteFileAtomic writes data to a temporary file next to filePath and renames
+// it into place, so readers never see a partially written file.
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filePath)
+}
@@ -0,0 +1,89 @@
+package util
+
+import "strings"
+
+// languageCodes maps the language names used on the command line to BCP 47 tags.
+var languageCodes = map[string]string{
+	"arabic":              "ar",
+	"bengali":             "bn",
+	"bulgarian":           "bg",
+	"catalan":             "ca",
+	"chinese":             "zh",
+	"simplified chinese":  "zh-Hans",
+	"traditional chinese": "zh-Hant",
+	"croatian":            "hr",
+	"czech":               "cs",
+	"danish":              "da",
+	"dutch":               "nl",
+	"english":             "en",
+	"estonian":            "et",
+	"finnish":             "fi",
+	"french":              "fr",
+	"german":              "de",
+	"greek":               "el",
+	"hebrew":              "he",
+	"hindi":               "hi",
+	"hungarian":           "hu",
+	"indonesian":          "id",
+	"italian":             "it",
+	"japanese":            "ja",
+	"korean":              "ko",
+	"latvian":             "lv",
+	"lithuanian":          "lt",
+	"malay":               "ms",
+	"norwegian":           "no",
+	"persian":             "fa",
+	"polish":              "pl",
+	"portuguese":          "pt",
+	"romanian":            "ro",
+	"russian":             "ru",
+	"serbian":             "sr",
+	"slovak":              "sk",
+	"slovenian":           "sl",
+	"spanish":             "es",
+	"swedish":             "sv",
+	"tagalog":             "tl",
+	"thai":                "th",
+	"turkish":             "tr",
+	"ukrainian":           "uk",
+	"urdu":                "ur",
+	"vietnamese":          "vi",
+}
+
+// LanguageCode returns the BCP 47 tag for a language name such as
+// "Vietnamese". Names it does not know, including values that already are
+// tags, are returned unchanged.
+func LanguageCode(name string) string {
+	if code, ok := languageCodes[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return code
+	}
+	return name
+}
+
+// LanguageName returns the English name for a BCP 47 tag such as "vi" or
+// "vi-VN", or the tag unchanged if it is not known.
+func LanguageName(code string) string {
+	primary := strings.ToLower(code)
+	for name, known := range languageCodes {
+		if strings.EqualFold(known, code) {
+			return titleCase(name)
+		}
+	}
+	if i := strings.IndexAny(primary, "-_"); i > 0 {
+		primary = primary[:i]
+	}
+	for name, known := range languageCodes {
+		if known == primary {
+			return titleCase(name)
+		}
+	}
+	return code
+}
+
+func titleCase(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, " ")
+}
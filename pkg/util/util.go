@@ -60,3 +60,12 @@ func IsNumeric(s string) bool {
 	_, err := strconv.Atoi(s)
 	return err == nil
 }
+
+// textEscaper escapes the characters that cannot appear in HTML or XML text,
+// leaving quotes alone so escaped text stays byte-identical to the book's markup.
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// EscapeText escapes text for use as the text of an HTML or XML element.
+func EscapeText(text string) string {
+	return textEscaper.Replace(text)
+}
@@ -101,3 +101,10 @@ func TestGetUnzipDestinationWindowsPaths(t *testing.T) {
 		})
 	}
 }
+
+func TestEscapeText(t *testing.T) {
+	got := EscapeText("Tom & \"Jerry\" <3\u00a0you")
+	if want := "Tom &amp; \"Jerry\" &lt;3\u00a0you"; got != want {
+		t.Errorf("EscapeText() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,498 @@
+package validator
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// Severity tells whether an issue makes the book invalid.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Checks that report issues.
+const (
+	CheckMimetype    = "mimetype"
+	CheckContainer   = "container"
+	CheckManifest    = "manifest"
+	CheckSpine       = "spine"
+	CheckXML         = "xml"
+	CheckDuplicateID = "duplicate-id"
+	CheckLink        = "link"
+	CheckNavigation  = "navigation"
+)
+
+const (
+	mimetype      = "application/epub+zip"
+	containerPath = "META-INF/container.xml"
+
+	mediaTypeXHTML = "application/xhtml+xml"
+	mediaTypeNCX   = "application/x-dtbncx+xml"
+	opsNamespace   = "http://www.idpf.org/2007/ops"
+)
+
+// Issue is one problem found in a book.
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Check    string   `json:"check"`
+	File     string   `json:"file,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// Report lists the issues found in a book, in the order they were found.
+type Report struct {
+	Issues []Issue `json:"issues"`
+}
+
+func (r *Report) add(severity Severity, check, file, format string, args ...any) {
+	r.Issues = append(r.Issues, Issue{Severity: severity, Check: check, File: file, Message: fmt.Sprintf(format, args...)})
+}
+
+// Errors returns the number of issues that make the book invalid.
+func (r *Report) Errors() int {
+	return r.count(SeverityError)
+}
+
+// Warnings returns the number of issues that do not make the book invalid.
+func (r *Report) Warnings() int {
+	return r.count(SeverityWarning)
+}
+
+func (r *Report) count(severity Severity) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == severity {
+			n++
+		}
+	}
+	return n
+}
+
+// ValidatePath validates the EPUB file or unpacked EPUB directory at bookPath.
+func ValidatePath(bookPath string) (*Report, error) {
+	info, err := os.Stat(bookPath)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return Validate(os.DirFS(bookPath)), nil
+	}
+
+	r, err := zip.OpenReader(bookPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open EPUB file: %w", err)
+	}
+	defer r.Close()
+
+	return ValidateArchive(&r.Reader), nil
+}
+
+// ValidateArchive validates a packed EPUB, including the layout of its
+// mimetype entry.
+func ValidateArchive(r *zip.Reader) *Report {
+	report := &Report{}
+
+	if len(r.File) == 0 || r.File[0].Name != "mimetype" {
+		report.add(SeverityError, CheckMimetype, "mimetype", "mimetype must be the first entry of the archive")
+	}
+	for _, f := range r.File {
+		if f.Name != "mimetype" {
+			continue
+		}
+		if f.Method != zip.Store {
+			report.add(SeverityError, CheckMimetype, f.Name, "mimetype must be stored uncompressed")
+		}
+		if len(f.Extra) > 0 {
+			report.add(SeverityError, CheckMimetype, f.Name, "mimetype must not have an extra field")
+		}
+	}
+
+	validate(report, r)
+	return report
+}
+
+// Validate validates an EPUB whose files are in fsys, such as an unpacked
+// book.
+func Validate(fsys fs.FS) *Report {
+	report := &Report{}
+	validate(report, fsys)
+	return report
+}
+
+type container struct {
+	Rootfiles []struct {
+		FullPath  string `xml:"full-path,attr"`
+		MediaType string `xml:"media-type,attr"`
+	} `xml:"rootfiles>rootfile"`
+}
+
+type opfPackage struct {
+	Version string `xml:"version,attr"`
+	Items   []struct {
+		ID         string `xml:"id,attr"`
+		Href       string `xml:"href,attr"`
+		MediaType  string `xml:"media-type,attr"`
+		Properties string `xml:"properties,attr"`
+	} `xml:"manifest>item"`
+	Spine struct {
+		Toc      string `xml:"toc,attr"`
+		ItemRefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"itemref"`
+	} `xml:"spine"`
+}
+
+// document is what validation needs to know about a parsed XHTML document.
+type document struct {
+	ids   map[string]bool
+	links []string
+	toc   bool // has a nav element of epub:type toc
+}
+
+func validate(report *Report, fsys fs.FS) {
+	if content, err := fs.ReadFile(fsys, "mimetype"); err != nil {
+		report.add(SeverityError, CheckMimetype, "mimetype", "mimetype file is missing")
+	} else if string(content) != mimetype {
+		report.add(SeverityError, CheckMimetype, "mimetype", "mimetype must contain exactly %q, found %q", mimetype, string(content))
+	}
+
+	content, err := fs.ReadFile(fsys, containerPath)
+	if err != nil {
+		report.add(SeverityError, CheckContainer, containerPath, "container document is missing")
+		return
+	}
+	var c container
+	if err := xml.Unmarshal(content, &c); err != nil {
+		report.add(SeverityError, CheckContainer, containerPath, "container document is not well-formed: %v", err)
+		return
+	}
+	if len(c.Rootfiles) == 0 || c.Rootfiles[0].FullPath == "" {
+		report.add(SeverityError, CheckContainer, containerPath, "container document has no rootfile")
+		return
+	}
+	packagePath := c.Rootfiles[0].FullPath
+	if mediaType := c.Rootfiles[0].MediaType; mediaType != "application/oebps-package+xml" {
+		report.add(SeverityWarning, CheckContainer, containerPath, "rootfile media type is %q instead of application/oebps-package+xml", mediaType)
+	}
+
+	content, err = fs.ReadFile(fsys, packagePath)
+	if err != nil {
+		report.add(SeverityError, CheckContainer, packagePath, "package document named by the container is missing")
+		return
+	}
+	var pkg opfPackage
+	if err := xml.Unmarshal(content, &pkg); err != nil {
+		report.add(SeverityError, CheckXML, packagePath, "package document is not well-formed: %v", err)
+		return
+	}
+	packageDir := path.Dir(packagePath)
+
+	// Manifest
+	items := make(map[string]int, len(pkg.Items))
+	hrefs := make(map[string]bool, len(pkg.Items))
+	for i, item := range pkg.Items {
+		if item.ID == "" {
+			report.add(SeverityError, CheckManifest, packagePath, "manifest item %q has no id", item.Href)
+		} else if _, ok := items[item.ID]; ok {
+			report.add(SeverityError, CheckManifest, packagePath, "manifest id %q is used more than once", item.ID)
+		} else {
+			items[item.ID] = i
+		}
+
+		if isRemote(item.Href) {
+			continue
+		}
+		itemPath, ok := resolve(packageDir, item.Href)
+		if !ok {
+			report.add(SeverityError, CheckManifest, packagePath, "manifest item %q has an invalid href %q", item.ID, item.Href)
+			continue
+		}
+		if hrefs[itemPath] {
+			report.add(SeverityWarning, CheckManifest, itemPath, "file is listed more than once in the manifest")
+		}
+		hrefs[itemPath] = true
+		if !exists(fsys, itemPath) {
+			report.add(SeverityError, CheckManifest, itemPath, "manifest item %q does not exist", item.ID)
+		}
+	}
+	fs.WalkDir(fsys, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if filePath == "mimetype" || filePath == packagePath || strings.HasPrefix(filePath, "META-INF/") {
+			return nil
+		}
+		if !hrefs[filePath] {
+			report.add(SeverityWarning, CheckManifest, filePath, "file is not listed in the manifest")
+		}
+		return nil
+	})
+
+	// Spine
+	if len(pkg.Spine.ItemRefs) == 0 {
+		report.add(SeverityError, CheckSpine, packagePath, "spine is empty")
+	}
+	for _, itemRef := range pkg.Spine.ItemRefs {
+		if _, ok := items[itemRef.IDRef]; !ok {
+			report.add(SeverityError, CheckSpine, packagePath, "spine itemref %q does not match a manifest item", itemRef.IDRef)
+		}
+	}
+
+	// Content documents
+	documents := make(map[string]*document)
+	var documentPaths []string
+	for _, item := range pkg.Items {
+		if item.MediaType != mediaTypeXHTML || isRemote(item.Href) {
+			continue
+		}
+		itemPath, ok := resolve(packageDir, item.Href)
+		if !ok || documents[itemPath] != nil {
+			continue
+		}
+		content, err := fs.ReadFile(fsys, itemPath)
+		if err != nil {
+			continue
+		}
+		documents[itemPath] = parseDocument(report, itemPath, content)
+		documentPaths = append(documentPaths, itemPath)
+	}
+
+	for _, documentPath := range documentPaths {
+		for _, link := range documents[documentPath].links {
+			checkLink(report, fsys, documents, documentPath, link)
+		}
+	}
+
+	// Navigation
+	checkNavigation(report, fsys, documents, &pkg, items, packagePath)
+}
+
+// parseDocument checks that an XHTML document is well-formed XML without
+// duplicate IDs, and collects its IDs and links.
+func parseDocument(report *Report, documentPath string, content []byte) *document {
+	doc := &document{ids: make(map[string]bool)}
+	duplicates := make(map[string]bool)
+
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = true
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			report.add(SeverityError, CheckXML, documentPath, "not well-formed XML: %v", err)
+			break
+		}
+
+		element, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		for _, attr := range element.Attr {
+			switch {
+			case attr.Name.Local == "id" && (attr.Name.Space == "" || attr.Name.Space == "xml"):
+				if doc.ids[attr.Value] && !duplicates[attr.Value] {
+					duplicates[attr.Value] = true
+					report.add(SeverityError, CheckDuplicateID, documentPath, "id %q is used more than once", attr.Value)
+				}
+				doc.ids[attr.Value] = true
+			case attr.Name.Local == "type" && attr.Name.Space == opsNamespace:
+				if element.Name.Local == "nav" && containsWord(attr.Value, "toc") {
+					doc.toc = true
+				}
+			case isLinkAttr(element.Name.Local, attr.Name):
+				doc.links = append(doc.links, strings.TrimSpace(attr.Value))
+			}
+		}
+	}
+
+	return doc
+}
+
+// linkAttrs are the attributes that refer to other files, by element.
+var linkAttrs = map[string]string{
+	"a":      "href",
+	"area":   "href",
+	"link":   "href",
+	"img":    "src",
+	"script": "src",
+	"source": "src",
+	"audio":  "src",
+	"video":  "src",
+	"iframe": "src",
+	"embed":  "src",
+	"image":  "href",
+}
+
+func isLinkAttr(element string, attr xml.Name) bool {
+	name, ok := linkAttrs[element]
+	if !ok || attr.Local != name {
+		return false
+	}
+	// SVG image elements link with xlink:href
+	return element != "image" || attr.Space == "http://www.w3.org/1999/xlink"
+}
+
+// checkLink reports a link of documentPath whose target file or anchor does
+// not exist. Links to other sites are not followed.
+func checkLink(report *Report, fsys fs.FS, documents map[string]*document, documentPath, link string) {
+	if link == "" || isRemote(link) {
+		return
+	}
+
+	u, err := url.Parse(link)
+	if err != nil {
+		report.add(SeverityError, CheckLink, documentPath, "invalid link %q", link)
+		return
+	}
+
+	target := documentPath
+	if u.Path != "" {
+		var ok bool
+		if target, ok = resolve(path.Dir(documentPath), u.Path); !ok {
+			report.add(SeverityError, CheckLink, documentPath, "invalid link %q", link)
+			return
+		}
+		if !exists(fsys, target) {
+			report.add(SeverityError, CheckLink, documentPath, "broken link %q: %s does not exist", link, target)
+			return
+		}
+	}
+
+	if u.Fragment == "" {
+		return
+	}
+	if doc, ok := documents[target]; ok && !doc.ids[u.Fragment] {
+		report.add(SeverityError, CheckLink, documentPath, "broken anchor %q: %s has no id %q", link, target, u.Fragment)
+	}
+}
+
+// checkNavigation checks that the book has the navigation document of its
+// version, an EPUB 3 nav document or an EPUB 2 NCX, and that their entries
+// resolve.
+func checkNavigation(report *Report, fsys fs.FS, documents map[string]*document, pkg *opfPackage, items map[string]int, packagePath string) {
+	packageDir := path.Dir(packagePath)
+
+	if strings.HasPrefix(pkg.Version, "3") {
+		navFound := false
+		for _, item := range pkg.Items {
+			if !containsWord(item.Properties, "nav") {
+				continue
+			}
+			navFound = true
+			itemPath, _ := resolve(packageDir, item.Href)
+			if item.MediaType != mediaTypeXHTML {
+				report.add(SeverityError, CheckNavigation, itemPath, "nav document must be XHTML, not %s", item.MediaType)
+			} else if doc, ok := documents[itemPath]; ok && !doc.toc {
+				report.add(SeverityError, CheckNavigation, itemPath, `nav document has no nav element of epub:type "toc"`)
+			}
+		}
+		if !navFound {
+			report.add(SeverityError, CheckNavigation, packagePath, `EPUB 3 manifest has no item with the "nav" property`)
+		}
+	}
+
+	if pkg.Spine.Toc == "" {
+		if !strings.HasPrefix(pkg.Version, "3") {
+			report.add(SeverityError, CheckNavigation, packagePath, "EPUB 2 spine has no toc attribute naming the NCX")
+		}
+		return
+	}
+
+	i, ok := items[pkg.Spine.Toc]
+	if !ok {
+		report.add(SeverityError, CheckNavigation, packagePath, "spine toc %q does not match a manifest item", pkg.Spine.Toc)
+		return
+	}
+	item := pkg.Items[i]
+	ncxPath, _ := resolve(packageDir, item.Href)
+	if item.MediaType != mediaTypeNCX {
+		report.add(SeverityError, CheckNavigation, ncxPath, "spine toc must be an NCX document, not %s", item.MediaType)
+		return
+	}
+
+	content, err := fs.ReadFile(fsys, ncxPath)
+	if err != nil {
+		return
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	decoder.Strict = true
+	var navPoints []string
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			report.add(SeverityError, CheckXML, ncxPath, "not well-formed XML: %v", err)
+			return
+		}
+		if element, ok := token.(xml.StartElement); ok && element.Name.Local == "content" {
+			for _, attr := range element.Attr {
+				if attr.Name.Local == "src" {
+					navPoints = append(navPoints, attr.Value)
+				}
+			}
+		}
+	}
+	if len(navPoints) == 0 {
+		report.add(SeverityError, CheckNavigation, ncxPath, "NCX has no navPoint entries")
+	}
+	for _, src := range navPoints {
+		checkLink(report, fsys, documents, ncxPath, src)
+	}
+}
+
+// resolve returns the path inside the book of href, relative to dir. It
+// reports false for hrefs that cannot be parsed or point outside the book.
+func resolve(dir, href string) (string, bool) {
+	if before, _, ok := strings.Cut(href, "#"); ok {
+		href = before
+	}
+	unescaped, err := url.PathUnescape(href)
+	if err != nil {
+		return "", false
+	}
+	resolved := path.Join(dir, unescaped)
+	if !fs.ValidPath(resolved) {
+		return "", false
+	}
+	return resolved, true
+}
+
+func exists(fsys fs.FS, name string) bool {
+	info, err := fs.Stat(fsys, name)
+	return err == nil && !info.IsDir()
+}
+
+// isRemote reports whether a link points outside the book: it has a scheme,
+// such as http: or mailto:, or is protocol-relative.
+func isRemote(link string) bool {
+	if strings.HasPrefix(link, "//") {
+		return true
+	}
+	u, err := url.Parse(link)
+	return err == nil && u.Scheme != ""
+}
+
+func containsWord(list, word string) bool {
+	for _, field := range strings.Fields(list) {
+		if field == word {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,154 @@
+package validator
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+	"testing/fstest"
+)
+
+func validBook() fstest.MapFS {
+	return fstest.MapFS{
+		"mimetype": {Data: []byte("application/epub+zip")},
+		"META-INF/container.xml": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/package.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`)},
+		"OEBPS/package.opf": {Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="id">urn:uuid:0000</dc:identifier>
+    <dc:title>Test Book</dc:title>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ch1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+    <item id="img" href="images/cover.png" media-type="image/png"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+  </spine>
+</package>`)},
+		"OEBPS/nav.xhtml": {Data: []byte(`<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops"><head><title>Contents</title></head><body>
+<nav epub:type="toc"><ol><li><a href="text/chapter%201.xhtml#start">Chapter One</a></li></ol></nav>
+</body></html>`)},
+		"OEBPS/text/chapter 1.xhtml": {Data: []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Chapter One</title></head><body>
+<h1 id="start">Chapter One</h1>
+<p><img src="../images/cover.png" alt=""/> See <a href="#start">the start</a> or <a href="https://example.com/">the site</a>.</p>
+</body></html>`)},
+		"OEBPS/images/cover.png": {Data: []byte("png")},
+	}
+}
+
+type issueKey struct {
+	severity Severity
+	check    string
+	file     string
+}
+
+func issueKeys(report *Report) map[issueKey]int {
+	keys := make(map[issueKey]int)
+	for _, issue := range report.Issues {
+		keys[issueKey{issue.Severity, issue.Check, issue.File}]++
+	}
+	return keys
+}
+
+func TestValidateValidBook(t *testing.T) {
+	report := Validate(validBook())
+	if len(report.Issues) != 0 {
+		t.Errorf("Validate() issues = %+v, want none", report.Issues)
+	}
+}
+
+func TestValidateReportsBrokenBook(t *testing.T) {
+	book := validBook()
+	book["mimetype"] = &fstest.MapFile{Data: []byte("application/epub+zip\n")}
+	book["OEBPS/package.opf"] = &fstest.MapFile{Data: []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <manifest>
+    <item id="ch1" href="text/chapter%201.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch2" href="text/chapter2.xhtml" media-type="application/xhtml+xml"/>
+    <item id="ch3" href="text/chapter3.xhtml" media-type="application/xhtml+xml"/>
+    <item id="img" href="images/cover.png" media-type="image/png"/>
+  </manifest>
+  <spine>
+    <itemref idref="ch1"/>
+    <itemref idref="ch2"/>
+    <itemref idref="appendix"/>
+  </spine>
+</package>`)}
+	book["OEBPS/text/chapter 1.xhtml"] = &fstest.MapFile{Data: []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><head><title>Chapter One</title></head><body>
+<h1 id="start">Chapter One</h1>
+<p id="start">Again</p>
+<p><a href="chapter2.xhtml#missing">Next</a> <a href="chapter4.xhtml">Later</a></p>
+</body></html>`)}
+	book["OEBPS/text/chapter2.xhtml"] = &fstest.MapFile{Data: []byte(`<html xmlns="http://www.w3.org/1999/xhtml"><body><p>Unclosed<br></p></body></html>`)}
+
+	report := Validate(book)
+
+	want := map[issueKey]int{
+		{SeverityError, CheckMimetype, "mimetype"}:                      1,
+		{SeverityError, CheckManifest, "OEBPS/text/chapter3.xhtml"}:     1,
+		{SeverityError, CheckSpine, "OEBPS/package.opf"}:                1,
+		{SeverityError, CheckDuplicateID, "OEBPS/text/chapter 1.xhtml"}: 1,
+		{SeverityError, CheckLink, "OEBPS/text/chapter 1.xhtml"}:        2,
+		{SeverityError, CheckXML, "OEBPS/text/chapter2.xhtml"}:          1,
+		{SeverityError, CheckNavigation, "OEBPS/package.opf"}:           1,
+		{SeverityWarning, CheckManifest, "OEBPS/nav.xhtml"}:             1,
+	}
+	got := issueKeys(report)
+	for key, count := range want {
+		if got[key] != count {
+			t.Errorf("%+v issues = %d, want %d", key, got[key], count)
+		}
+	}
+	for key, count := range got {
+		if _, ok := want[key]; !ok {
+			t.Errorf("unexpected %+v issues = %d", key, count)
+		}
+	}
+	if report.Errors() != 8 || report.Warnings() != 1 {
+		t.Errorf("Errors(), Warnings() = %d, %d, want 8, 1", report.Errors(), report.Warnings())
+	}
+}
+
+func TestValidateArchiveChecksMimetypeEntry(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, file := range validBook() {
+		// Compressed and after another entry: not a valid OCF container
+		if name == "mimetype" {
+			continue
+		}
+		entry, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write(file.Data)
+	}
+	entry, err := w.Create("mimetype")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry.Write([]byte("application/epub+zip"))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := ValidateArchive(r)
+
+	if got := issueKeys(report)[issueKey{SeverityError, CheckMimetype, "mimetype"}]; got != 2 {
+		t.Errorf("mimetype issues = %d, want 2 (not first, compressed): %+v", got, report.Issues)
+	}
+	if report.Errors() != 2 {
+		t.Errorf("Errors() = %d, want 2: %+v", report.Errors(), report.Issues)
+	}
+}
@@ -0,0 +1,236 @@
+package xliff
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenOpen
+	tokenClose
+	tokenStandalone
+)
+
+// token is a run of text or a single tag of an HTML fragment. Open and close
+// tags that balance each other point at their partner through pair.
+type token struct {
+	kind tokenKind
+	raw  string
+	name string
+	pair int
+}
+
+var htmlTagRegex = regexp.MustCompile(`<(/?)([a-zA-Z][a-zA-Z0-9:-]*)[^>]*?(/?)>|(?s:<!--.*?-->)`)
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "source": true, "track": true, "wbr": true,
+}
+
+// tokenize splits an HTML fragment into text and tags. Tags without a
+// matching partner are turned into standalone tags so that the paired codes
+// always nest.
+func tokenize(content string) []token {
+	var tokens []token
+	var open []int
+
+	last := 0
+	for _, loc := range htmlTagRegex.FindAllStringSubmatchIndex(content, -1) {
+		if loc[0] > last {
+			tokens = append(tokens, token{kind: tokenText, raw: content[last:loc[0]]})
+		}
+		last = loc[1]
+
+		tag := token{kind: tokenStandalone, raw: content[loc[0]:loc[1]], pair: -1}
+		if loc[4] < 0 {
+			// A comment
+			tokens = append(tokens, tag)
+			continue
+		}
+		tag.name = strings.ToLower(content[loc[4]:loc[5]])
+
+		closing := loc[3] > loc[2]
+		selfClosing := loc[7] > loc[6] || voidElements[tag.name]
+		switch {
+		case closing:
+			// Close the nearest open tag of the same name; tags opened after it are left unpaired
+			for i := len(open) - 1; i >= 0; i-- {
+				if tokens[open[i]].name == tag.name {
+					tag.kind = tokenClose
+					tag.pair = open[i]
+					tokens[open[i]].kind = tokenOpen
+					tokens[open[i]].pair = len(tokens)
+					open = open[:i]
+					break
+				}
+			}
+		case !selfClosing:
+			open = append(open, len(tokens))
+		}
+		tokens = append(tokens, tag)
+	}
+	if last < len(content) {
+		tokens = append(tokens, token{kind: tokenText, raw: content[last:]})
+	}
+
+	return tokens
+}
+
+// code is an inline code of a unit: a paired element or a standalone tag.
+type code struct {
+	id    string
+	kind  tokenKind
+	name  string
+	start string
+	end   string
+	used  bool
+}
+
+// unitCodes holds the inline codes of one unit and the original data they
+// refer to, shared by its source and target.
+type unitCodes struct {
+	codes  []*code
+	data   []dataItem
+	dataID map[string]string
+}
+
+func newUnitCodes() *unitCodes {
+	return &unitCodes{dataID: make(map[string]string)}
+}
+
+// ref returns the id of the original data holding raw, adding it if needed.
+func (u *unitCodes) ref(raw string) string {
+	if id, ok := u.dataID[raw]; ok {
+		return id
+	}
+	id := fmt.Sprintf("d%d", len(u.data)+1)
+	u.dataID[raw] = id
+	u.data = append(u.data, dataItem{ID: id, Value: raw})
+	return id
+}
+
+// source converts the source fragment to XLIFF inline content, creating a code
+// for every tag.
+func (u *unitCodes) source(content string) string {
+	return u.encode(content, func(kind tokenKind, name, start, end string) string {
+		c := &code{id: fmt.Sprint(len(u.codes) + 1), kind: kind, name: name, start: start, end: end}
+		u.codes = append(u.codes, c)
+		return c.id
+	})
+}
+
+// target converts the target fragment to XLIFF inline content. Tags reuse the
+// id of an identical source code, then of a source code for the same element,
+// so that CAT tools can align them.
+func (u *unitCodes) target(content string) string {
+	for _, c := range u.codes {
+		c.used = false
+	}
+
+	extra := len(u.codes)
+	return u.encode(content, func(kind tokenKind, name, start, end string) string {
+		for _, exact := range []bool{true, false} {
+			for _, c := range u.codes {
+				if c.used || c.kind != kind || c.name != name {
+					continue
+				}
+				if exact && (c.start != start || c.end != end) {
+					continue
+				}
+				c.used = true
+				return c.id
+			}
+		}
+		extra++
+		return fmt.Sprint(extra)
+	})
+}
+
+func (u *unitCodes) encode(content string, codeID func(kind tokenKind, name, start, end string) string) string {
+	tokens := tokenize(content)
+
+	var b strings.Builder
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenText:
+			xmlEscaper.WriteString(&b, html.UnescapeString(t.raw))
+		case tokenOpen:
+			end := tokens[t.pair].raw
+			id := codeID(tokenOpen, t.name, t.raw, end)
+			fmt.Fprintf(&b, `<pc id="%s" dataRefStart="%s" dataRefEnd="%s">`, id, u.ref(t.raw), u.ref(end))
+		case tokenClose:
+			b.WriteString("</pc>")
+		case tokenStandalone:
+			id := codeID(tokenStandalone, t.name, t.raw, "")
+			fmt.Fprintf(&b, `<ph id="%s" dataRef="%s"/>`, id, u.ref(t.raw))
+		}
+	}
+
+	return b.String()
+}
+
+// xmlEscaper escapes the characters that cannot appear in XML text.
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// inlineToHTML converts XLIFF inline content back to HTML, replacing every code
+// with the original data it refers to. Codes without original data, such as
+// those added in a CAT tool, are dropped and their content is kept.
+func inlineToHTML(inner string, data map[string]string) (string, error) {
+	decoder := xml.NewDecoder(strings.NewReader("<content>" + inner + "</content>"))
+
+	var b strings.Builder
+	var ends []string
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to decode inline content: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "pc":
+				b.WriteString(data[attr(t, "dataRefStart")])
+				ends = append(ends, data[attr(t, "dataRefEnd")])
+			case "ph", "sc", "ec":
+				b.WriteString(data[attr(t, "dataRef")])
+			case "cp":
+				if r, err := strconv.ParseInt(attr(t, "hex"), 16, 32); err == nil {
+					b.WriteString(util.EscapeText(string(rune(r))))
+				}
+			}
+		case xml.EndElement:
+			if t.Name.Local == "pc" && len(ends) > 0 {
+				b.WriteString(ends[len(ends)-1])
+				ends = ends[:len(ends)-1]
+			}
+		case xml.CharData:
+			b.WriteString(util.EscapeText(string(t)))
+		}
+	}
+
+	return b.String(), nil
+}
+
+func attr(element xml.StartElement, name string) string {
+	for _, a := range element.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,194 @@
+package xliff
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/segment"
+	"github.com/nguyenvanduocit/epubtrans/pkg/util"
+)
+
+// Namespace is the XML namespace of XLIFF 2.0 documents.
+const Namespace = "urn:oasis:names:tc:xliff:document:2.0"
+
+// spineNote is the note category that records a file's position in the spine.
+const spineNote = "spine"
+
+type document struct {
+	XMLName xml.Name `xml:"urn:oasis:names:tc:xliff:document:2.0 xliff"`
+	Version string   `xml:"version,attr"`
+	SrcLang string   `xml:"srcLang,attr"`
+	TrgLang string   `xml:"trgLang,attr,omitempty"`
+	Files   []file   `xml:"file"`
+}
+
+type file struct {
+	ID       string `xml:"id,attr"`
+	Original string `xml:"original,attr,omitempty"`
+	Notes    []note `xml:"notes>note"`
+	Units    []unit `xml:"unit"`
+}
+
+type note struct {
+	Category string `xml:"category,attr,omitempty"`
+	Value    string `xml:",chardata"`
+}
+
+type unit struct {
+	ID           string     `xml:"id,attr"`
+	OriginalData []dataItem `xml:"originalData>data"`
+	Parts        []unitPart `xml:",any"`
+}
+
+// unitPart is a segment or ignorable element of a unit. CAT tools may split a
+// unit into several of them.
+type unitPart struct {
+	XMLName xml.Name
+	State   string   `xml:"state,attr,omitempty"`
+	Source  content  `xml:"source"`
+	Target  *content `xml:"target,omitempty"`
+}
+
+type content struct {
+	Inner string `xml:",innerxml"`
+}
+
+// dataItem is the original HTML of an inline code.
+type dataItem struct {
+	ID    string `xml:"id,attr"`
+	Value string `xml:",chardata"`
+}
+
+// Write writes segments to w as one XLIFF 2.0 document with a file element per
+// book file. Inline HTML becomes pc and ph codes whose original tags are kept
+// in the unit's originalData. Languages are written as BCP 47 tags.
+func Write(w io.Writer, sourceLang, targetLang string, segments []segment.Segment) error {
+	doc := document{
+		Version: "2.0",
+		SrcLang: util.LanguageCode(sourceLang),
+		TrgLang: util.LanguageCode(targetLang),
+	}
+
+	for _, seg := range segments {
+		if len(doc.Files) == 0 || doc.Files[len(doc.Files)-1].Original != seg.File {
+			doc.Files = append(doc.Files, file{
+				ID:       fmt.Sprintf("f%d", len(doc.Files)+1),
+				Original: seg.File,
+				Notes:    []note{{Category: spineNote, Value: strconv.Itoa(seg.Spine)}},
+			})
+		}
+
+		codes := newUnitCodes()
+		part := unitPart{
+			XMLName: xml.Name{Local: "segment"},
+			State:   string(seg.State),
+			Source:  content{Inner: codes.source(seg.Source)},
+		}
+		if seg.Target != "" {
+			part.Target = &content{Inner: codes.target(seg.Target)}
+		}
+		u := unit{ID: seg.ID, OriginalData: codes.data, Parts: []unitPart{part}}
+
+		f := &doc.Files[len(doc.Files)-1]
+		f.Units = append(f.Units, u)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode XLIFF: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// Read reads the units of an XLIFF 2.0 document as segments, restoring their
+// inline codes to the original HTML. The segments of a unit are joined and
+// the unit takes the least advanced of their states.
+func Read(r io.Reader) (*segment.Document, error) {
+	var doc document
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode XLIFF: %w", err)
+	}
+
+	result := &segment.Document{
+		SourceLang: util.LanguageName(doc.SrcLang),
+		TargetLang: util.LanguageName(doc.TrgLang),
+	}
+	for _, f := range doc.Files {
+		spine := 0
+		for _, n := range f.Notes {
+			if n.Category == spineNote {
+				spine, _ = strconv.Atoi(strings.TrimSpace(n.Value))
+			}
+		}
+
+		for _, u := range f.Units {
+			data := make(map[string]string, len(u.OriginalData))
+			for _, item := range u.OriginalData {
+				data[item.ID] = item.Value
+			}
+
+			seg := segment.Segment{ID: u.ID, File: f.Original, Spine: spine, State: segment.StateFinal}
+			var source, target strings.Builder
+			translated := false
+			for _, part := range u.Parts {
+				if part.XMLName.Local != "segment" && part.XMLName.Local != "ignorable" {
+					continue
+				}
+
+				partSource, err := inlineToHTML(part.Source.Inner, data)
+				if err != nil {
+					return nil, fmt.Errorf("unit %s: %w", u.ID, err)
+				}
+				source.WriteString(partSource)
+
+				switch {
+				case part.Target != nil:
+					partTarget, err := inlineToHTML(part.Target.Inner, data)
+					if err != nil {
+						return nil, fmt.Errorf("unit %s: %w", u.ID, err)
+					}
+					target.WriteString(partTarget)
+					translated = translated || part.XMLName.Local == "segment"
+				case part.XMLName.Local == "ignorable":
+					// Ignorable parts are whitespace or codes that are not translated
+					target.WriteString(partSource)
+				}
+
+				if part.XMLName.Local == "segment" {
+					state := segment.ParseState(part.State)
+					if part.State == "" && part.Target != nil {
+						state = segment.StateTranslated
+					}
+					if stateRank[state] < stateRank[seg.State] {
+						seg.State = state
+					}
+				}
+			}
+
+			seg.Source = source.String()
+			if translated {
+				seg.Target = target.String()
+			} else {
+				seg.State = segment.StateInitial
+			}
+			result.Segments = append(result.Segments, seg)
+		}
+	}
+
+	return result, nil
+}
+
+var stateRank = map[segment.State]int{
+	segment.StateInitial:    0,
+	segment.StateTranslated: 1,
+	segment.StateReviewed:   2,
+	segment.StateFinal:      3,
+}
@@ -0,0 +1,101 @@
+package xliff
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nguyenvanduocit/epubtrans/pkg/segment"
+)
+
+func TestWriteInlineCodes(t *testing.T) {
+	segments := []segment.Segment{
+		{
+			ID:     "a1",
+			File:   "OEBPS/chapter1.xhtml",
+			Spine:  1,
+			Source: `Run <code class="cmd">go test</code> &amp; wait<br/> <em>now</em>`,
+			Target: `Chạy <code class="cmd">go test</code> &amp; chờ<br/> <em>ngay</em>`,
+			State:  segment.StateTranslated,
+		},
+		{
+			ID:     "a2",
+			File:   "OEBPS/chapter1.xhtml",
+			Spine:  1,
+			Source: `An <b>unclosed tag`,
+			State:  segment.StateInitial,
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "English", "Vietnamese", segments); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		`<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="vi">`,
+		`<file id="f1" original="OEBPS/chapter1.xhtml">`,
+		`<note category="spine">1</note>`,
+		`<data id="d1">&lt;code class=&#34;cmd&#34;&gt;</data>`,
+		`<segment state="translated">`,
+		`<source>Run <pc id="1" dataRefStart="d1" dataRefEnd="d2">go test</pc> &amp; wait<ph id="2" dataRef="d3"/> <pc id="3" dataRefStart="d4" dataRefEnd="d5">now</pc></source>`,
+		`<target>Chạy <pc id="1" dataRefStart="d1" dataRefEnd="d2">go test</pc> &amp; chờ<ph id="2" dataRef="d3"/> <pc id="3" dataRefStart="d4" dataRefEnd="d5">ngay</pc></target>`,
+		`<source>An <ph id="1" dataRef="d1"/>unclosed tag</source>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Write() output is missing %s\n%s", want, got)
+		}
+	}
+	if strings.Count(got, "<file ") != 1 {
+		t.Errorf("expected one file element for one book file\n%s", got)
+	}
+}
+
+func TestReadRestoresHTML(t *testing.T) {
+	segments := []segment.Segment{
+		{ID: "a1", File: "OEBPS/chapter1.xhtml", Spine: 1, Source: `Run <code class="cmd">go test</code> &amp; wait<br/> <em>now</em>`, Target: `<em>Ngay</em> chạy <code class="cmd">go test</code><br/>`, State: segment.StateReviewed},
+		// goquery serializes a no-break space as the character itself
+		{ID: "a2", File: "OEBPS/chapter2.xhtml", Spine: 2, Source: "An\u00a0<b>unclosed tag", Target: "Một\u00a0<b>thẻ mở", State: segment.StateTranslated},
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "English", "Vietnamese", segments); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	doc, err := Read(&buf)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	if doc.SourceLang != "English" || doc.TargetLang != "Vietnamese" {
+		t.Errorf("Read() languages = %q, %q", doc.SourceLang, doc.TargetLang)
+	}
+	if !reflect.DeepEqual(doc.Segments, segments) {
+		t.Errorf("Read() segments = %+v, want %+v", doc.Segments, segments)
+	}
+}
+
+func TestReadJoinsSegmentsOfAUnit(t *testing.T) {
+	input := `<xliff xmlns="urn:oasis:names:tc:xliff:document:2.0" version="2.0" srcLang="en" trgLang="vi">
+  <file id="f1" original="OEBPS/chapter1.xhtml">
+    <unit id="a1">
+      <originalData><data id="d1">&lt;em&gt;</data><data id="d2">&lt;/em&gt;</data></originalData>
+      <segment state="final"><source>One.</source><target>Một.</target></segment>
+      <ignorable><source> </source></ignorable>
+      <segment state="translated"><source><pc id="1" dataRefStart="d1" dataRefEnd="d2">Two</pc>.</source><target><pc id="1" dataRefStart="d1" dataRefEnd="d2">Hai</pc>.</target></segment>
+    </unit>
+  </file>
+</xliff>`
+
+	doc, err := Read(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+
+	want := segment.Segment{ID: "a1", File: "OEBPS/chapter1.xhtml", Source: "One. <em>Two</em>.", Target: "Một. <em>Hai</em>.", State: segment.StateTranslated}
+	if len(doc.Segments) != 1 || doc.Segments[0] != want {
+		t.Errorf("Read() segments = %+v, want %+v", doc.Segments, want)
+	}
+}